@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/blackmamoth/cloudmesh/pkg/config"
@@ -36,7 +37,7 @@ func (s *APIServer) Run() error {
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(timeoutUnlessStreaming(60 * time.Second))
 	r.Use(middleware.Heartbeat("/health"))
 	r.Use(middleware.Compress(6, "gzip", "brotli"))
 
@@ -82,15 +83,33 @@ func (s *APIServer) Run() error {
 	return http.ListenAndServe(fmt.Sprintf("%s:%s", s.host, s.addr), r)
 }
 
+// timeoutUnlessStreaming applies middleware.Timeout to every request except event streams, which stay open for as
+// long as the client listens.
+func timeoutUnlessStreaming(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withTimeout := middleware.Timeout(timeout)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			withTimeout.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (s *APIServer) registerRoutes() *chi.Mux {
 	r := chi.NewRouter()
 
 	authMiddleware := middlewares.NewAuthMiddleware(s.connPool)
 	fileMiddleware := middlewares.NewFileMiddleware()
 
-	linkHandler := handlers.NewLinkHandler(s.connPool)
+	linkHandler := handlers.NewLinkHandler(s.connPool, authMiddleware)
 	accountHandler := handlers.NewAccountHandler(s.connPool, authMiddleware)
 	filesHandler := handlers.NewFilesHandler(s.connPool, authMiddleware, fileMiddleware)
+	webhooksHandler := handlers.NewWebhooksHandler(s.connPool)
 
 	r.Mount("/link", linkHandler.RegisterRoutes())
 	config.LOGGER.Info("Mounted /link routes")
@@ -101,5 +120,8 @@ func (s *APIServer) registerRoutes() *chi.Mux {
 	r.Mount("/files", filesHandler.RegisterRoutes())
 	config.LOGGER.Info("Mounted /files routes")
 
+	r.Mount("/webhooks", webhooksHandler.RegisterRoutes())
+	config.LOGGER.Info("Mounted /webhooks routes")
+
 	return r
 }
@@ -4,12 +4,21 @@ import (
 	"github.com/blackmamoth/cloudmesh/cmd/api"
 	"github.com/blackmamoth/cloudmesh/pkg/config"
 	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
 	"go.uber.org/zap"
 )
 
 func main() {
 	defer config.LOGGER.Sync()
 
+	if config.APIConfig.PUBLIC_URL == "" {
+		config.LOGGER.Warn("PUBLIC_URL is not set, provider webhooks are disabled and changes only arrive with scheduled syncs")
+	}
+
+	if config.APIConfig.METRICS_ADDR != "" {
+		utils.ServeMetrics(config.APIConfig.METRICS_ADDR)
+	}
+
 	apiServer := api.NewAPIServer(config.APIConfig.HOST, config.APIConfig.PORT, db.ConnPool)
 
 	if err := apiServer.Run(); err != nil {
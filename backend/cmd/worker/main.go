@@ -1,29 +1,68 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/blackmamoth/cloudmesh/pkg/config"
 	"github.com/blackmamoth/cloudmesh/pkg/tasks"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
 	"github.com/hibiken/asynq"
 	"go.uber.org/zap"
 )
 
 func main() {
 	defer config.LOGGER.Sync()
+
+	if config.APIConfig.PUBLIC_URL == "" {
+		config.LOGGER.Warn("PUBLIC_URL is not set, provider webhooks are disabled and changes only arrive with scheduled syncs")
+	}
+
+	if config.APIConfig.METRICS_ADDR != "" {
+		utils.ServeMetrics(config.APIConfig.METRICS_ADDR)
+	}
+
 	redisAddr := fmt.Sprintf("%s:%s", config.RedisConfig.HOST, config.RedisConfig.PORT)
 
 	srv := asynq.NewServer(asynq.RedisClientOpt{Addr: redisAddr, Password: config.RedisConfig.PASS}, asynq.Config{
 		Concurrency: config.AsynqConfig.CONCURRENCY,
 		Queues: map[string]int{
-			"critical": 6,
-			"default":  3,
-			"low":      1,
+			tasks.QUEUE_CRITICAL: 6,
+			tasks.QUEUE_DEFAULT:  3,
+			tasks.QUEUE_LOW:      1,
 		},
 	})
 
 	mux := asynq.NewServeMux()
 	mux.HandleFunc(tasks.TypeFileSync, tasks.HandleFileSyncTask)
+	mux.HandleFunc(tasks.TypeAuthTokenRenewal, tasks.HandleAuthTokenRenewalTask)
+	mux.HandleFunc(tasks.TypeGoogleChannelRenewal, tasks.HandleGoogleChannelRenewalTask)
+	mux.HandleFunc(tasks.TypeFileSyncSchedule, tasks.HandleFileSyncScheduleTask)
+	mux.HandleFunc(tasks.TypeSyncOverdueCheck, tasks.HandleSyncOverdueCheckTask)
+
+	if config.AsynqConfig.SYNC_SCHEDULER {
+		scheduler, err := tasks.NewSyncScheduler()
+		if err != nil {
+			config.LOGGER.Fatal("failed to create sync scheduler", zap.Error(err))
+		}
+
+		if err := scheduler.Start(); err != nil {
+			config.LOGGER.Fatal("failed to start sync scheduler", zap.Error(err))
+		}
+		defer scheduler.Shutdown()
+	}
+
+	if config.AsynqConfig.DROPBOX_WATCHER {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		watcher, err := tasks.NewDropboxWatcher()
+		if err != nil {
+			config.LOGGER.Fatal("failed to start dropbox watcher", zap.Error(err))
+		}
+
+		go watcher.Run(ctx)
+	}
 
 	config.LOGGER.Info("Asynq server started")
 
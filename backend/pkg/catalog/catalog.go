@@ -0,0 +1,511 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/progress"
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// SYNC_CHECKPOINT_MAX_AGE bounds how long an interrupted sync can be resumed, provider page tokens do not live forever.
+const SYNC_CHECKPOINT_MAX_AGE = 24 * time.Hour
+
+// Sync pulls the pages of a provider sync into synced_items and returns the number of rows written. Parent references
+// and paths of the account are resolved once the sync finished, rows written in between only show up after that.
+//
+// Providers with incremental sync get the stored cursor and every page is committed together with the cursor it ends
+// on. A sync without a cursor is a full listing, items are compared against the stored content hashes and whatever
+// the listing did not return is removed once the last page was written.
+//
+// Every page also moves the sync checkpoint of the account in the same transaction. When a sync fails midway the next
+// run continues from the checkpoint instead of listing everything again.
+//
+// Providers with selective sync get the sync rules of the account. A sync after the rules changed is a full listing,
+// the items the new rules let through are only in the listing.
+//
+// Every call is recorded in sync_runs along with what it added, updated and deleted, so a missing file can be traced
+// back to the run that should have stored it.
+//
+// A cursor the provider no longer accepts is reported as providers.ErrCursorReset. It is dropped together with the
+// checkpoint and the sync starts over as a full listing, otherwise every later sync would send it again.
+//
+// Progress of the sync is published through the reporter, which may be nil.
+func Sync(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, provider string, syncer providers.Syncer, account providers.Account, reporter *progress.Reporter) (int, error) {
+	itemCount, err := runSync(ctx, conn, accountID, provider, syncer, account, reporter)
+	if !errors.Is(err, providers.ErrCursorReset) {
+		return itemCount, err
+	}
+
+	config.LOGGER.Warn("sync cursor was reset, starting a full sync", zap.String("provider", provider), zap.String("account_id", accountID.String()))
+
+	err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		qx := repository.New(conn).WithTx(tx)
+
+		if err := qx.ClearSyncPageToken(ctx, accountID); err != nil {
+			return err
+		}
+
+		return qx.DeleteSyncCheckpoint(ctx, accountID)
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to drop reset sync cursor", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+		return itemCount, err
+	}
+
+	fullSyncCount, err := runSync(ctx, conn, accountID, provider, syncer, account, reporter)
+
+	return itemCount + fullSyncCount, err
+}
+
+// runSync is a single attempt of Sync.
+func runSync(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, provider string, syncer providers.Syncer, account providers.Account, reporter *progress.Reporter) (int, error) {
+	queries := repository.New(conn)
+
+	var (
+		cursor         string
+		fullSync       bool
+		resumed        bool
+		startedAt      pgtype.Timestamptz
+		totalItemCount = 0
+		pageCount      = 0
+		deletedCount   = 0
+	)
+
+	syncDetails, err := queries.GetLatestSyncTimeAndPagetoken(ctx, accountID)
+	if err != nil {
+		config.LOGGER.Error("failed to fetch last sync details", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+		return 0, err
+	}
+
+	rulesChanged := syncDetails.SyncRulesVersion != syncDetails.SyncedRulesVersion
+
+	if syncer.Capabilities().SelectiveSync {
+		account.Rules, err = LoadSyncRules(ctx, queries, accountID)
+		if err != nil {
+			config.LOGGER.Error("failed to fetch sync rules", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+			return 0, err
+		}
+	}
+
+	checkpoint, err := queries.GetSyncCheckpoint(ctx, accountID)
+
+	switch {
+	case err == nil && checkpoint.Checkpoint != "" && time.Since(checkpoint.UpdatedAt.Time) < SYNC_CHECKPOINT_MAX_AGE && (checkpoint.FullSync || !rulesChanged):
+		cursor = checkpoint.Checkpoint
+		fullSync = checkpoint.FullSync
+		resumed = true
+		startedAt = checkpoint.StartedAt
+		totalItemCount = int(checkpoint.ItemsSynced)
+		pageCount = int(checkpoint.PagesSynced)
+		deletedCount = int(checkpoint.ItemsDeleted)
+
+		config.LOGGER.Info("resuming sync from checkpoint", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Bool("full_sync", fullSync), zap.Int32("pages_synced", checkpoint.PagesSynced), zap.Int64("items_synced", checkpoint.ItemsSynced))
+	case err != nil && !errors.Is(err, pgx.ErrNoRows):
+		config.LOGGER.Error("failed to fetch sync checkpoint", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+		return 0, err
+	default:
+		if syncer.Capabilities().IncrementalSync && syncDetails.LastSyncedAt.Valid && syncDetails.SyncPageToken.Valid && !rulesChanged {
+			cursor = syncDetails.SyncPageToken.String
+		}
+
+		fullSync = cursor == ""
+
+		startedAt, err = queries.StartSyncCheckpoint(ctx, repository.StartSyncCheckpointParams{
+			AccountID: accountID,
+			FullSync:  fullSync,
+		})
+
+		if err != nil {
+			config.LOGGER.Error("failed to start sync checkpoint", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+			return 0, err
+		}
+	}
+
+	reporter.Publish(ctx, progress.SyncEvent{
+		Phase:          progress.PHASE_STARTED,
+		Page:           pageCount,
+		ItemsProcessed: totalItemCount,
+		ItemsDeleted:   deletedCount,
+	})
+
+	run := startSyncRun(ctx, queries, accountID, provider, reporter.JobID(), fullSync, resumed, cursor)
+
+	var storedHashes map[string]string
+
+	if fullSync {
+		storedItems, err := queries.GetSyncedItemHashes(ctx, accountID)
+		if err != nil {
+			config.LOGGER.Error("could not fetch stored content hashes", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+			run.finish(ctx, queries, err)
+			return 0, err
+		}
+
+		storedHashes = make(map[string]string, len(storedItems))
+		for _, item := range storedItems {
+			storedHashes[item.ProviderFileID] = item.ContentHash.String
+		}
+	}
+
+	var lastCursor string
+
+	err = syncer.SyncFiles(ctx, account, cursor, func(ctx context.Context, page providers.SyncPage) error {
+		var (
+			changedItems   = page.Items
+			unchangedIDs   []string
+			insertedRows   int64
+			replacedRows   int64
+			removedRows    int64
+			pageCheckpoint = page.Checkpoint
+		)
+
+		if pageCheckpoint == "" {
+			pageCheckpoint = page.Cursor
+		}
+
+		if page.Cursor != "" {
+			lastCursor = page.Cursor
+		}
+
+		// unchanged items of a full listing are only touched, rows left untouched by the end of the listing are gone remotely
+		if fullSync {
+			changedItems = nil
+
+			for _, item := range page.Items {
+				// items with expiring links are always rewritten so the links stay fresh
+				if storedHash, ok := storedHashes[item.ProviderFileID]; ok && item.ContentHash != "" && storedHash == item.ContentHash && item.LinkExpiresAt.IsZero() {
+					unchangedIDs = append(unchangedIDs, item.ProviderFileID)
+					continue
+				}
+
+				changedItems = append(changedItems, item)
+			}
+		}
+
+		err := utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+			qx := queries.WithTx(tx)
+
+			removedByID, err := removeItems(ctx, qx, accountID, page.DeletedIDs)
+			if err != nil {
+				config.LOGGER.Error("an error occured while deleting removed files", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+				return err
+			}
+
+			removedByPath, err := removePaths(ctx, qx, accountID, page.DeletedPaths)
+			if err != nil {
+				config.LOGGER.Error("an error occured while deleting removed paths", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+				return err
+			}
+
+			removedRows = removedByID + removedByPath
+
+			if len(unchangedIDs) > 0 {
+				err := qx.TouchSyncedItems(ctx, repository.TouchSyncedItemsParams{
+					AccountID:       accountID,
+					ProviderFileIds: unchangedIDs,
+				})
+
+				if err != nil {
+					return err
+				}
+			}
+
+			insertedRows, replacedRows, err = saveItems(ctx, qx, accountID, changedItems)
+			if err != nil {
+				return err
+			}
+
+			err = qx.UpdateSyncCheckpoint(ctx, repository.UpdateSyncCheckpointParams{
+				AccountID:    accountID,
+				Checkpoint:   pageCheckpoint,
+				ItemsSynced:  insertedRows,
+				ItemsDeleted: int64(len(page.DeletedIDs) + len(page.DeletedPaths)),
+			})
+
+			if err != nil {
+				return err
+			}
+
+			// a full listing only stores its cursor once every page is in, an incremental one moves it with every page
+			if fullSync || page.Cursor == "" {
+				return nil
+			}
+
+			return qx.UpdateLastSyncedTimestamp(ctx, repository.UpdateLastSyncedTimestampParams{
+				AccountID:     accountID,
+				SyncPageToken: db.PGTextField(page.Cursor),
+			})
+		})
+
+		if err != nil {
+			config.LOGGER.Error("failed to insert synced files", zap.String("provider", provider), zap.Error(err))
+			return err
+		}
+
+		config.LOGGER.Info("batch inserted", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Int64("item_count", insertedRows), zap.Int("deleted_count", len(page.DeletedIDs)+len(page.DeletedPaths)))
+
+		totalItemCount += int(insertedRows)
+		deletedCount += len(page.DeletedIDs) + len(page.DeletedPaths)
+		pageCount++
+
+		run.pagesFetched++
+		run.added += insertedRows - replacedRows
+		run.updated += replacedRows
+		run.unchanged += int64(len(unchangedIDs))
+		run.deleted += removedRows
+		run.skipped += int64(page.Skipped)
+
+		for _, item := range page.Items {
+			run.bytesSeen += item.Size
+		}
+
+		if page.Cursor != "" {
+			run.cursorAfter = page.Cursor
+		}
+
+		reporter.Publish(ctx, progress.SyncEvent{
+			Phase:          progress.PHASE_SYNCING,
+			Page:           pageCount,
+			ItemsProcessed: totalItemCount,
+			ItemsDeleted:   deletedCount,
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		run.finish(ctx, queries, err)
+		return totalItemCount, err
+	}
+
+	reporter.Publish(ctx, progress.SyncEvent{
+		Phase:          progress.PHASE_FINALIZING,
+		Page:           pageCount,
+		ItemsProcessed: totalItemCount,
+		ItemsDeleted:   deletedCount,
+	})
+
+	var removedRows int64
+
+	err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		qx := queries.WithTx(tx)
+
+		if fullSync {
+			var err error
+
+			removedRows, err = qx.DeleteItemsNotSyncedSince(ctx, repository.DeleteItemsNotSyncedSinceParams{
+				AccountID:   accountID,
+				SyncedSince: startedAt,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if removedRows > 0 {
+				config.LOGGER.Info("removed items deleted", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Int64("item_count", removedRows))
+			}
+
+			err = qx.UpdateLastSyncedTimestamp(ctx, repository.UpdateLastSyncedTimestampParams{
+				AccountID:     accountID,
+				SyncPageToken: db.PGTextField(lastCursor),
+			})
+
+			if err != nil {
+				return err
+			}
+
+			// rules changed while this sync ran are applied by the next one
+			err = qx.UpdateSyncedRulesVersion(ctx, repository.UpdateSyncedRulesVersionParams{
+				AccountID:          accountID,
+				SyncedRulesVersion: syncDetails.SyncRulesVersion,
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := qx.RefreshItemHierarchy(ctx, accountID); err != nil {
+			return err
+		}
+
+		return qx.DeleteSyncCheckpoint(ctx, accountID)
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to finish sync", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+		run.finish(ctx, queries, err)
+		return totalItemCount, err
+	}
+
+	run.deleted += removedRows
+	run.finish(ctx, queries, nil)
+
+	return totalItemCount, nil
+}
+
+// SaveItems writes items returned by a provider call, rows already stored under the same provider file id are updated.
+func SaveItems(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, items []providers.Item) (int64, error) {
+	var insertedRows int64
+
+	err := utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		var err error
+
+		qx := repository.New(conn).WithTx(tx)
+
+		insertedRows, _, err = saveItems(ctx, qx, accountID, items)
+		if err != nil {
+			return err
+		}
+
+		_, err = qx.RefreshItemHierarchy(ctx, accountID)
+
+		return err
+	})
+
+	return insertedRows, err
+}
+
+// RemoveItems deletes the rows of the given provider file ids along with everything stored below them.
+func RemoveItems(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, providerFileIDs []string) error {
+	return utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		_, err := removeItems(ctx, repository.New(conn).WithTx(tx), accountID, providerFileIDs)
+		return err
+	})
+}
+
+// ReplaceItem swaps the row of a moved or renamed item, an item that kept its provider file id is updated in place and
+// keeps its row. Providers that address items by path hand out a new id for a moved folder, its children keep the old
+// path as parent and are dropped until the next sync lists them again. Parent references and paths are resolved again
+// for the item and everything below it.
+func ReplaceItem(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, previousID string, item providers.Item) error {
+	return utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		qx := repository.New(conn).WithTx(tx)
+
+		if item.IsFolder && previousID != item.ProviderFileID {
+			if _, err := removeItems(ctx, qx, accountID, []string{previousID}); err != nil {
+				return err
+			}
+		} else if previousID != item.ProviderFileID {
+			_, err := qx.DeleteConflictingItems(ctx, repository.DeleteConflictingItemsParams{
+				ProviderFileIds: []string{previousID},
+				AccountID:       accountID,
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, _, err := saveItems(ctx, qx, accountID, []providers.Item{item}); err != nil {
+			return err
+		}
+
+		_, err := qx.RefreshItemHierarchy(ctx, accountID)
+
+		return err
+	})
+}
+
+// saveItems writes items in place of the rows stored under the same provider file ids, which keep their id, and
+// returns the number of rows written along with how many of them replaced a stored row.
+func saveItems(ctx context.Context, qx *repository.Queries, accountID pgtype.UUID, items []providers.Item) (int64, int64, error) {
+	if len(items) == 0 {
+		return 0, 0, nil
+	}
+
+	// a row can only be written once per statement, an item listed twice is written as listed last
+	positions := make(map[string]int, len(items))
+	unique := make([]providers.Item, 0, len(items))
+
+	for _, item := range items {
+		if position, ok := positions[item.ProviderFileID]; ok {
+			unique[position] = item
+			continue
+		}
+
+		positions[item.ProviderFileID] = len(unique)
+		unique = append(unique, item)
+	}
+
+	result, err := qx.UpsertSyncedItems(ctx, toSyncedItems(accountID, unique))
+	if err != nil {
+		config.LOGGER.Error("an error occured while writing synced files", zap.String("account_id", accountID.String()), zap.Error(err))
+		return 0, 0, err
+	}
+
+	return result.Written, result.Replaced, nil
+}
+
+// removeItems deletes the rows of providerFileIDs along with everything below them and returns the number of rows
+// deleted.
+func removeItems(ctx context.Context, qx *repository.Queries, accountID pgtype.UUID, providerFileIDs []string) (int64, error) {
+	if len(providerFileIDs) == 0 {
+		return 0, nil
+	}
+
+	descendantRows, err := qx.DeleteDescendantItems(ctx, repository.DeleteDescendantItemsParams{
+		AccountID: accountID,
+		ParentIds: providerFileIDs,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	itemRows, err := qx.DeleteConflictingItems(ctx, repository.DeleteConflictingItemsParams{
+		ProviderFileIds: providerFileIDs,
+		AccountID:       accountID,
+	})
+
+	return descendantRows + itemRows, err
+}
+
+func removePaths(ctx context.Context, qx *repository.Queries, accountID pgtype.UUID, paths []string) (int64, error) {
+	if len(paths) == 0 {
+		return 0, nil
+	}
+
+	return qx.DeleteItemsByPath(ctx, repository.DeleteItemsByPathParams{
+		AccountID: accountID,
+		Paths:     paths,
+	})
+}
+
+func toSyncedItems(accountID pgtype.UUID, items []providers.Item) repository.UpsertSyncedItemsParams {
+	params := repository.UpsertSyncedItemsParams{AccountID: accountID}
+
+	for _, item := range items {
+		params.ProviderFileIds = append(params.ProviderFileIds, item.ProviderFileID)
+		params.Names = append(params.Names, item.Name)
+		params.Extensions = append(params.Extensions, item.Extension)
+		params.Sizes = append(params.Sizes, item.Size)
+		params.MimeTypes = append(params.MimeTypes, item.MimeType)
+		params.ParentFolders = append(params.ParentFolders, item.ParentFolder)
+		params.IsFolders = append(params.IsFolders, item.IsFolder)
+		params.ContentHashes = append(params.ContentHashes, item.ContentHash)
+		params.CreatedTimes = append(params.CreatedTimes, db.PGTimestamptzField(item.CreatedTime))
+		params.ModifiedTimes = append(params.ModifiedTimes, db.PGTimestamptzField(item.ModifiedTime))
+		params.ThumbnailLinks = append(params.ThumbnailLinks, item.ThumbnailLink)
+		params.PreviewLinks = append(params.PreviewLinks, item.PreviewLink)
+		params.WebViewLinks = append(params.WebViewLinks, item.WebViewLink)
+		params.WebContentLinks = append(params.WebContentLinks, item.WebContentLink)
+		params.LinkExpiresAts = append(params.LinkExpiresAts, db.PGTimestamptzField(item.LinkExpiresAt))
+		params.Owners = append(params.Owners, item.Owner)
+		params.IsShareds = append(params.IsShareds, item.Shared)
+		params.SharedWithMes = append(params.SharedWithMes, item.SharedWithMe)
+	}
+
+	return params
+}
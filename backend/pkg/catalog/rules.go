@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoadSyncRules returns the compiled sync rules of an account, nil when it has none.
+func LoadSyncRules(ctx context.Context, queries *repository.Queries, accountID pgtype.UUID) (*providers.SyncRules, error) {
+	storedRules, err := queries.GetSyncRules(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]providers.SyncRule, 0, len(storedRules))
+
+	for _, rule := range storedRules {
+		rules = append(rules, providers.SyncRule{
+			Action:  string(rule.Action),
+			Type:    string(rule.Type),
+			Pattern: rule.Pattern,
+		})
+	}
+
+	return providers.NewSyncRules(rules), nil
+}
+
+// ReplaceSyncRules stores rules in place of the current rules of an account and returns them. Items below excluded
+// folders are purged right away. Everything else a change affects is settled by the next sync, which turns into a
+// full listing since the rules version moved and the sync checkpoint is dropped.
+func ReplaceSyncRules(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, rules []providers.SyncRule) ([]repository.SyncRule, error) {
+	var storedRules []repository.SyncRule
+
+	err := utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		qx := repository.New(conn).WithTx(tx)
+
+		if err := qx.DeleteSyncRules(ctx, accountID); err != nil {
+			return err
+		}
+
+		if len(rules) > 0 {
+			params := make([]repository.AddSyncRulesParams, 0, len(rules))
+
+			for _, rule := range rules {
+				params = append(params, repository.AddSyncRulesParams{
+					AccountID: accountID,
+					Action:    repository.SyncRuleActionEnum(rule.Action),
+					Type:      repository.SyncRuleTypeEnum(rule.Type),
+					Pattern:   rule.Pattern,
+				})
+			}
+
+			if _, err := qx.AddSyncRules(ctx, params); err != nil {
+				return err
+			}
+		}
+
+		if _, err := qx.BumpSyncRulesVersion(ctx, accountID); err != nil {
+			return err
+		}
+
+		if err := qx.DeleteSyncCheckpoint(ctx, accountID); err != nil {
+			return err
+		}
+
+		compiled := providers.NewSyncRules(rules)
+
+		_, excludeIDs := compiled.IDs()
+		if _, err := removeItems(ctx, qx, accountID, excludeIDs); err != nil {
+			return err
+		}
+
+		if _, excludePaths := compiled.Paths(); len(excludePaths) > 0 {
+			_, err := qx.DeleteItemsUnderPaths(ctx, repository.DeleteItemsUnderPathsParams{
+				AccountID: accountID,
+				Paths:     excludePaths,
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+
+		storedRules, err = qx.GetSyncRules(ctx, accountID)
+
+		return err
+	})
+
+	return storedRules, err
+}
@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// syncRun collects the statistics of one Sync call for its sync_runs row. Counts cover this call only, a run that
+// resumed from a checkpoint does not repeat what the interrupted run already stored.
+type syncRun struct {
+	id           pgtype.UUID
+	accountID    pgtype.UUID
+	provider     string
+	added        int64
+	updated      int64
+	unchanged    int64
+	deleted      int64
+	skipped      int64
+	bytesSeen    int64
+	pagesFetched int32
+	cursorAfter  string
+}
+
+// startSyncRun records the start of a sync. Statistics are only there to debug syncs, a run that could not be
+// recorded does not stop the sync.
+func startSyncRun(ctx context.Context, queries *repository.Queries, accountID pgtype.UUID, provider, jobID string, fullSync, resumed bool, cursor string) *syncRun {
+	run := &syncRun{accountID: accountID, provider: provider, cursorAfter: cursor}
+
+	id, err := queries.StartSyncRun(ctx, repository.StartSyncRunParams{
+		AccountID:    accountID,
+		JobID:        db.PGTextField(jobID),
+		FullSync:     fullSync,
+		Resumed:      resumed,
+		CursorBefore: db.PGTextField(cursor),
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to record sync run", zap.String("provider", provider), zap.String("account_id", accountID.String()), zap.Error(err))
+		return run
+	}
+
+	run.id = id
+
+	return run
+}
+
+// finish stores the statistics of the run, syncErr marks it as failed. The row is written even when ctx was cancelled
+// since that is usually what failed the sync.
+func (r *syncRun) finish(ctx context.Context, queries *repository.Queries, syncErr error) {
+	if !r.id.Valid {
+		return
+	}
+
+	status := repository.JobStatusEnumSucceeded
+
+	var errMessage string
+
+	if syncErr != nil {
+		status = repository.JobStatusEnumFailed
+		errMessage = syncErr.Error()
+	}
+
+	err := queries.FinishSyncRun(context.WithoutCancel(ctx), repository.FinishSyncRunParams{
+		ID:             r.id,
+		Status:         status,
+		ItemsAdded:     r.added,
+		ItemsUpdated:   r.updated,
+		ItemsUnchanged: r.unchanged,
+		ItemsDeleted:   r.deleted,
+		ItemsSkipped:   r.skipped,
+		BytesSeen:      r.bytesSeen,
+		PagesFetched:   r.pagesFetched,
+		CursorAfter:    db.PGTextField(r.cursorAfter),
+		Error:          db.PGTextField(errMessage),
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to record finished sync run", zap.String("provider", r.provider), zap.String("account_id", r.accountID.String()), zap.Error(err))
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"testing"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -12,6 +13,8 @@ type APIConfiguration struct {
 	HOST          string `envconfig:"HOST"                          default:"127.0.0.1"`
 	PORT          string `envconfig:"PORT"                          default:"8080"`
 	FRONTEND_HOST string `envconfig:"FRONTEND_HOST" required:"true"`
+	PUBLIC_URL    string `envconfig:"PUBLIC_URL"`
+	METRICS_ADDR  string `envconfig:"METRICS_ADDR"`
 }
 
 type AESConfiguration struct {
@@ -41,8 +44,19 @@ type RedisConfiguration struct {
 }
 
 type AsynqConfiguration struct {
-	CONCURRENCY        int `envconfig:"ASYNQ_CONCURRENCY" default:"10"`
-	FILE_SYNC_INTERVAL int `envconfig:"ASYNQ_FILE_SYNC_INTERVAL" default:"30"`
+	CONCURRENCY        int  `envconfig:"ASYNQ_CONCURRENCY" default:"10"`
+	FILE_SYNC_INTERVAL int  `envconfig:"ASYNQ_FILE_SYNC_INTERVAL" default:"30"`
+	DROPBOX_WATCHER    bool `envconfig:"ASYNQ_DROPBOX_WATCHER" default:"true"`
+	SYNC_SCHEDULER     bool `envconfig:"ASYNQ_SYNC_SCHEDULER" default:"true"`
+}
+
+// ProviderHTTPConfiguration tunes the transport shared by provider API calls. RATE_LIMITS holds the requests per
+// second every provider app may send across all processes, providers without an entry are not limited.
+type ProviderHTTPConfiguration struct {
+	DIAL_TIMEOUT     int                `envconfig:"PROVIDER_HTTP_DIAL_TIMEOUT" default:"10"`
+	RESPONSE_TIMEOUT int                `envconfig:"PROVIDER_HTTP_RESPONSE_TIMEOUT" default:"60"`
+	MAX_RETRIES      int                `envconfig:"PROVIDER_HTTP_MAX_RETRIES" default:"5"`
+	RATE_LIMITS      map[string]float64 `envconfig:"PROVIDER_HTTP_RATE_LIMITS" default:"google:50,dropbox:20,onedrive:20,box:15"`
 }
 
 type OAuthConfiguration struct {
@@ -58,6 +72,20 @@ type OAuthConfiguration struct {
 		OAUTH_SCOPES  string `envconfig:"DROPBOX_OAUTH_SCOPES" required:"true"`
 		REDIRECT_URI  string `envconfig:"DROPBOX_REDIRECT_URI" required:"true"`
 	} `envconfig:"DROPBOX_"`
+	// ONEDRIVE is optional, the provider is only offered when CLIENT_ID is set
+	ONEDRIVE struct {
+		CLIENT_ID     string `envconfig:"ONEDRIVE_ID"`
+		CLIENT_SECRET string `envconfig:"ONEDRIVE_SECRET"`
+		OAUTH_SCOPES  string `envconfig:"ONEDRIVE_OAUTH_SCOPES"`
+		REDIRECT_URI  string `envconfig:"ONEDRIVE_REDIRECT_URI"`
+	} `envconfig:"ONEDRIVE_"`
+	// BOX is optional, the provider is only offered when CLIENT_ID is set
+	BOX struct {
+		CLIENT_ID     string `envconfig:"BOX_ID"`
+		CLIENT_SECRET string `envconfig:"BOX_SECRET"`
+		OAUTH_SCOPES  string `envconfig:"BOX_OAUTH_SCOPES"`
+		REDIRECT_URI  string `envconfig:"BOX_REDIRECT_URI"`
+	} `envconfig:"BOX_"`
 }
 
 type CookieStoreConfiguration struct {
@@ -66,13 +94,14 @@ type CookieStoreConfiguration struct {
 }
 
 var (
-	APIConfig         APIConfiguration
-	AESConfig         AESConfiguration
-	PostgresConfig    PostgresConfiguration
-	RedisConfig       RedisConfiguration
-	OAuthConfig       OAuthConfiguration
-	CookieStoreConfig CookieStoreConfiguration
-	AsynqConfig       AsynqConfiguration
+	APIConfig          APIConfiguration
+	AESConfig          AESConfiguration
+	PostgresConfig     PostgresConfiguration
+	RedisConfig        RedisConfiguration
+	OAuthConfig        OAuthConfiguration
+	CookieStoreConfig  CookieStoreConfiguration
+	AsynqConfig        AsynqConfiguration
+	ProviderHTTPConfig ProviderHTTPConfiguration
 )
 
 func init() {
@@ -82,32 +111,20 @@ func init() {
 func loadEnv() {
 	godotenv.Load()
 
-	if err := envconfig.Process("", &APIConfig); err != nil {
-		log.Fatalf("An error occured while loading environment variables: %v", err)
-	}
-
-	if err := envconfig.Process("AES_", &AESConfig); err != nil {
-		log.Fatalf("An error occured while loading environment variables: %v", err)
-	}
-
-	if err := envconfig.Process("POSTGRES_", &PostgresConfig); err != nil {
-		log.Fatalf("An error occured while loading environment variables: %v", err)
-	}
-
-	if err := envconfig.Process("REDIS_", &RedisConfig); err != nil {
-		log.Fatalf("An error occured while loading environment variables: %v", err)
-	}
-
-	if err := envconfig.Process("ASYNQ_", &AsynqConfig); err != nil {
-		log.Fatalf("An error occured while loading environment variables: %v", err)
-	}
-
-	if err := envconfig.Process("", &OAuthConfig); err != nil {
-		log.Fatalf("An error occured while loading environment variables: %v", err)
-	}
+	process("", &APIConfig)
+	process("AES_", &AESConfig)
+	process("POSTGRES_", &PostgresConfig)
+	process("REDIS_", &RedisConfig)
+	process("ASYNQ_", &AsynqConfig)
+	process("PROVIDER_", &ProviderHTTPConfig)
+	process("", &OAuthConfig)
+	process("COOKIE_", &CookieStoreConfig)
+}
 
-	if err := envconfig.Process("COOKIE_", &CookieStoreConfig); err != nil {
+// process loads the variables of spec. Test binaries run without the environment of a deployment, a missing variable
+// leaves the rest of spec empty there instead of stopping the tests.
+func process(prefix string, spec any) {
+	if err := envconfig.Process(prefix, spec); err != nil && !testing.Testing() {
 		log.Fatalf("An error occured while loading environment variables: %v", err)
 	}
-
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"testing"
 	"time"
 
 	"github.com/blackmamoth/cloudmesh/pkg/config"
@@ -20,23 +21,37 @@ var (
 func init() {
 	poolConfig, err := connectPostgres()
 	if err != nil {
-		config.LOGGER.Fatal("Application disconnected from PostgreSQL Server", zap.Error(err))
+		disconnected("Application disconnected from PostgreSQL Server", err)
+		return
 	}
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		config.LOGGER.Fatal("Application disconnected from PostgreSQL Server", zap.Error(err))
+		disconnected("Application disconnected from PostgreSQL Server", err)
+		return
 	}
 
+	PoolConfig = poolConfig
+
+	ConnPool = pool
+
 	if err := pingPostgresConnection(pool); err != nil {
-		config.LOGGER.Fatal("Application disconnected from PostgreSQL Server", zap.Error(err))
+		disconnected("Application disconnected from PostgreSQL Server", err)
+		return
 	}
 
 	config.LOGGER.Info("Application connected to PostgreSQL Server")
+}
 
-	PoolConfig = poolConfig
+// disconnected stops the process over a server it can not reach. Test binaries carry on, unit tests do not touch the
+// servers and the integration tests that do fail on their own.
+func disconnected(msg string, err error) {
+	if testing.Testing() {
+		config.LOGGER.Warn(msg, zap.Error(err))
+		return
+	}
 
-	ConnPool = pool
+	config.LOGGER.Fatal(msg, zap.Error(err))
 }
 
 func pingPostgresConnection(connPool *pgxpool.Pool) error {
@@ -108,3 +123,10 @@ func PGUUID(val string) (*pgtype.UUID, error) {
 func PGInt4Field(val int32) pgtype.Int4 {
 	return pgtype.Int4{Int32: val, Valid: true}
 }
+
+func PGBoolField(val *bool) pgtype.Bool {
+	if val == nil {
+		return pgtype.Bool{}
+	}
+	return pgtype.Bool{Bool: *val, Valid: true}
+}
@@ -13,9 +13,11 @@ import (
 )
 
 var (
-	RedisClient  *redis.Client
-	asyncqclient *asynq.Client
-	once         sync.Once
+	RedisClient    *redis.Client
+	asyncqclient   *asynq.Client
+	asynqinspector *asynq.Inspector
+	once           sync.Once
+	inspectorOnce  sync.Once
 )
 
 func init() {
@@ -30,7 +32,7 @@ func init() {
 	})
 
 	if status := RedisClient.Ping(context.Background()); status.Err() != nil {
-		config.LOGGER.Fatal("Application disconnected from Redis Server", zap.Error(status.Err()))
+		disconnected("Application disconnected from Redis Server", status.Err())
 	}
 }
 
@@ -44,3 +46,14 @@ func GetAsynqClient() *asynq.Client {
 	})
 	return asyncqclient
 }
+
+func GetAsynqInspector() *asynq.Inspector {
+	inspectorOnce.Do(func() {
+		asynqinspector = asynq.NewInspector(asynq.RedisClientOpt{
+			Addr:     fmt.Sprintf("%s:%s", config.RedisConfig.HOST, config.RedisConfig.PORT),
+			Password: config.RedisConfig.PASS,
+			DB:       config.RedisConfig.DB,
+		})
+	})
+	return asynqinspector
+}
@@ -1,18 +1,53 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/blackmamoth/cloudmesh/pkg/catalog"
 	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
 	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
+	"github.com/blackmamoth/cloudmesh/pkg/progress"
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/tasks"
+	"github.com/blackmamoth/cloudmesh/pkg/tokens"
 	"github.com/blackmamoth/cloudmesh/pkg/utils"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
+const (
+	// SYNC_EVENTS_HEARTBEAT_INTERVAL keeps idle event streams from being closed by proxies.
+	SYNC_EVENTS_HEARTBEAT_INTERVAL = 15 * time.Second
+	SYNC_RUNS_MAX_LIMIT            = 100
+)
+
+type SyncRuleValidation struct {
+	Action  string `validate:"required,oneof=include exclude" json:"action"`
+	Type    string `validate:"required,oneof=path id name extension" json:"type"`
+	Pattern string `validate:"required,max=1024" json:"pattern"`
+}
+
+type SyncRulesValidation struct {
+	Rules []SyncRuleValidation `validate:"max=100" json:"rules"`
+}
+
+type SyncScheduleValidation struct {
+	IntervalMinutes int  `validate:"required,min=5,max=1440" json:"interval_minutes"`
+	Paused          bool `json:"paused"`
+}
+
 type AccountHandler struct {
 	connPool       *pgxpool.Pool
 	authMiddleware *middlewares.AuthMiddleware
@@ -31,6 +66,14 @@ func (h *AccountHandler) RegisterRoutes() *chi.Mux {
 	r.Use(h.authMiddleware.VerifyAccessToken)
 
 	r.Get("/get-accounts", h.getAccounts)
+	r.Delete("/{id}", h.unlinkAccount)
+	r.Post("/{id}/sync", h.syncAccount)
+	r.Get("/{id}/sync/events", h.streamSyncEvents)
+	r.Get("/{id}/sync-rules", h.getSyncRules)
+	r.Put("/{id}/sync-rules", h.replaceSyncRules)
+	r.Get("/{id}/sync-runs", h.getSyncRuns)
+	r.Get("/{id}/sync-schedule", h.getSyncSchedule)
+	r.Put("/{id}/sync-schedule", h.updateSyncSchedule)
 
 	return r
 }
@@ -81,3 +124,584 @@ func (h *AccountHandler) groupAccountsByProvider(accounts []repository.GetLinked
 
 	return grouped
 }
+
+// unlinkAccount removes a linked account. Its waiting and running tasks are cancelled, its change channel is stopped
+// and its grant is revoked at the provider before the linked_account row is deleted, which takes the synced items, job
+// logs and every other row of the account with it. A revoke that fails keeps the account, it is unlinked once the
+// grant is gone, a grant revoked already does not hold it back. Cancelling and stopping are best effort, the summary
+// says what went through.
+func (h *AccountHandler) unlinkAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.UserKey).(string)
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, authTokens, ok := h.getAccount(w, r, conn)
+	if !ok {
+		return
+	}
+
+	providerName := string(authTokens.Provider)
+
+	// a sync or renewal still running could store tokens or items of the account while it is being removed
+	tasksCancelled, err := tasks.CancelAccountTasks(r.Context(), *accountID, queries)
+	if err != nil {
+		config.LOGGER.Warn("failed to cancel tasks of unlinked account", zap.String("provider", providerName), zap.String("account_id", accountID.String()), zap.Error(err))
+	}
+
+	// the provider calls renew an expired access token first, the renewed token is stored on the row deleted below
+	account := tokens.New(conn, *accountID, authTokens).Account()
+
+	channel, err := queries.GetGoogleChannelByAccountID(r.Context(), *accountID)
+
+	if watcher, ok := providers.GetChangeWatcher(providerName); ok && err == nil && time.Now().Before(channel.ExpiresAt.Time) {
+		if err := watcher.Stop(r.Context(), account, channel.ChannelID, channel.ResourceID); err != nil {
+			config.LOGGER.Warn("failed to stop google channel of unlinked account", zap.String("account_id", accountID.String()), zap.String("channel_id", channel.ChannelID), zap.Error(err))
+		}
+	}
+
+	tokenRevoked := false
+
+	// a grant the user revoked already has nothing left to revoke
+	if revoker, ok := providers.GetRevoker(providerName); ok && authTokens.Status != repository.AccountStatusEnumNeedsReauth {
+		err := revoker.RevokeToken(r.Context(), account)
+
+		switch {
+		case errors.Is(err, providers.ErrInvalidGrant):
+			config.LOGGER.Info("grant of unlinked account was revoked already", zap.String("provider", providerName), zap.String("account_id", accountID.String()), zap.Error(err))
+		case err != nil:
+			config.LOGGER.Error("failed to revoke token of unlinked account", zap.String("provider", providerName), zap.String("account_id", accountID.String()), zap.Error(err))
+			utils.SendAPIErrorResponse(w, http.StatusBadGateway, fmt.Errorf("access to the account could not be revoked at the provider, please try again later"))
+			return
+		default:
+			tokenRevoked = true
+		}
+	}
+
+	var counts repository.GetAccountDataCountsRow
+
+	err = utils.WithTransaction(r.Context(), conn, func(tx pgx.Tx) error {
+		qx := queries.WithTx(tx)
+
+		var err error
+
+		counts, err = qx.GetAccountDataCounts(r.Context(), *accountID)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := qx.DeleteLinkedAccount(r.Context(), repository.DeleteLinkedAccountParams{
+			UserID:    userID,
+			AccountID: *accountID,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return pgx.ErrNoRows
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.SendAPIErrorResponse(w, http.StatusNotFound, fmt.Errorf("account not found"))
+			return
+		}
+		config.LOGGER.Error("failed to delete linked account", zap.String("provider", providerName), zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	config.LOGGER.Info("account unlinked", zap.String("provider", providerName), zap.String("user_id", userID), zap.String("account_id", accountID.String()), zap.Bool("token_revoked", tokenRevoked), zap.Int("tasks_cancelled", tasksCancelled))
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{
+		"account_id":           accountID.String(),
+		"provider":             providerName,
+		"token_revoked":        tokenRevoked,
+		"tasks_cancelled":      tasksCancelled,
+		"synced_items_removed": counts.SyncedItems,
+		"job_logs_removed":     counts.JobLogs,
+		"sync_runs_removed":    counts.SyncRuns,
+	})
+}
+
+// syncAccount enqueues an on demand sync on the critical queue. When a sync of the account is already queued or running
+// its job id is returned instead of enqueueing another one.
+func (h *AccountHandler) syncAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.UserKey).(string)
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, authTokens, ok := h.getAccount(w, r, conn)
+	if !ok {
+		return
+	}
+
+	providerName := string(authTokens.Provider)
+
+	if _, ok := providers.GetSyncer(providerName); !ok {
+		utils.SendAPIErrorResponse(w, http.StatusNotImplemented, providers.ErrUnsupportedAction)
+		return
+	}
+
+	if authTokens.Status == repository.AccountStatusEnumNeedsReauth {
+		utils.SendAPIErrorResponse(w, http.StatusConflict, fmt.Errorf("this account has to be linked again before it can be synced"))
+		return
+	}
+
+	info, alreadyQueued, err := tasks.EnqueueFileSyncOnce(r.Context(), userID, accountID.String(), providerName, tasks.QUEUE_CRITICAL, queries)
+
+	if err != nil {
+		if errors.Is(err, asynq.ErrTaskIDConflict) {
+			utils.SendAPIErrorResponse(w, http.StatusConflict, fmt.Errorf("a sync for this account could not be scheduled, please try again later"))
+			return
+		}
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("your sync could not be scheduled, please try again later"))
+		return
+	}
+
+	status := http.StatusAccepted
+	if alreadyQueued {
+		status = http.StatusOK
+	}
+
+	utils.SendAPIResponse(w, status, map[string]any{
+		"job_id":         info.ID,
+		"queue":          info.Queue,
+		"already_queued": alreadyQueued,
+	})
+}
+
+// streamSyncEvents streams the sync progress of an account as server-sent events until the client goes away. A status
+// event with the current job status is sent first when a sync is queued or running.
+func (h *AccountHandler) streamSyncEvents(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	// the stream can stay open for a long time, the connection is released on every path before it starts instead of
+	// being deferred
+	queries := repository.New(conn)
+
+	accountID, _, ok := h.getAccount(w, r, conn)
+	if !ok {
+		conn.Release()
+		return
+	}
+
+	// subscribe before looking up the current job so no transition falls in between
+	pubsub := progress.Subscribe(r.Context(), accountID.String())
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(r.Context()); err != nil {
+		conn.Release()
+		config.LOGGER.Error("failed to subscribe to sync events", zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	activeJob, err := queries.GetActiveJobLog(r.Context(), repository.GetActiveJobLogParams{
+		AccountID: *accountID,
+		Type:      tasks.TypeFileSync,
+	})
+
+	conn.Release()
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		config.LOGGER.Error("failed to fetch active sync job", zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err == nil {
+		event, _ := json.Marshal(progress.SyncEvent{
+			AccountID: accountID.String(),
+			JobID:     activeJob.JobID,
+			Phase:     progress.PHASE_STATUS,
+			Status:    string(activeJob.Status),
+			Time:      time.Now(),
+		})
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", progress.PHASE_STATUS, event)
+	}
+
+	if err := rc.Flush(); err != nil {
+		config.LOGGER.Error("response writer does not support streaming", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(SYNC_EVENTS_HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+
+	messages := pubsub.Channel()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var event progress.SyncEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				config.LOGGER.Warn("dropping malformed sync event", zap.String("account_id", accountID.String()), zap.Error(err))
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Phase, msg.Payload)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (h *AccountHandler) getSyncRules(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, _, ok := h.getAccount(w, r, conn)
+	if !ok {
+		return
+	}
+
+	rules, err := queries.GetSyncRules(r.Context(), *accountID)
+	if err != nil {
+		config.LOGGER.Error("failed to fetch sync rules", zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{"rules": rules})
+}
+
+// replaceSyncRules swaps the sync rules of an account for the ones in the request and schedules the full sync that
+// applies them. An empty list syncs everything again.
+func (h *AccountHandler) replaceSyncRules(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.UserKey).(string)
+
+	var payload SyncRulesValidation
+
+	defer r.Body.Close()
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		config.LOGGER.Error("could not parse json payload", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed"))
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errs := utils.GenerateValidationErrorObject(err.(validator.ValidationErrors), payload)
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, errs)
+		return
+	}
+
+	rules := make([]providers.SyncRule, 0, len(payload.Rules))
+
+	for i, rule := range payload.Rules {
+		if err := utils.Validate.Struct(rule); err != nil {
+			errs := utils.GenerateValidationErrorObject(err.(validator.ValidationErrors), rule)
+			utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, errs)
+			return
+		}
+
+		if !providers.ValidSyncRulePattern(rule.Type, rule.Pattern) {
+			utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("rule %d has an invalid `pattern`, paths start with / and names and extensions are glob patterns", i))
+			return
+		}
+
+		rules = append(rules, providers.SyncRule{
+			Action:  rule.Action,
+			Type:    rule.Type,
+			Pattern: rule.Pattern,
+		})
+	}
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, authTokens, ok := h.getAccount(w, r, conn)
+	if !ok {
+		return
+	}
+
+	providerName := string(authTokens.Provider)
+
+	syncer, ok := providers.GetSyncer(providerName)
+	if !ok || !syncer.Capabilities().SelectiveSync {
+		utils.SendAPIErrorResponse(w, http.StatusNotImplemented, providers.ErrUnsupportedAction)
+		return
+	}
+
+	storedRules, err := catalog.ReplaceSyncRules(r.Context(), conn, *accountID, rules)
+	if err != nil {
+		config.LOGGER.Error("failed to replace sync rules", zap.String("provider", providerName), zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	info, alreadyQueued, err := tasks.EnqueueFileSyncOnce(r.Context(), userID, accountID.String(), providerName, tasks.QUEUE_CRITICAL, queries)
+	if err != nil {
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("your sync rules were saved but a sync could not be scheduled, they apply from the next sync"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{
+		"rules":          storedRules,
+		"job_id":         info.ID,
+		"queue":          info.Queue,
+		"already_queued": alreadyQueued,
+	})
+}
+
+// getSyncRuns lists the sync runs of an account, newest first. limit and offset are taken from the query string.
+func (h *AccountHandler) getSyncRuns(w http.ResponseWriter, r *http.Request) {
+	var (
+		limit, offset = DEFAULT_LIMIT, DEFAULT_OFFSET
+		err           error
+	)
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > SYNC_RUNS_MAX_LIMIT {
+			utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("`limit` should be between 1 and %d", SYNC_RUNS_MAX_LIMIT))
+			return
+		}
+	}
+
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("`offset` should be a positive number"))
+			return
+		}
+	}
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, _, ok := h.getAccount(w, r, conn)
+	if !ok {
+		return
+	}
+
+	runs, err := queries.GetSyncRuns(r.Context(), repository.GetSyncRunsParams{
+		AccountID: *accountID,
+		LimitBy:   int32(limit),
+		OffsetBy:  int32(offset),
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to fetch sync runs", zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{
+		"runs":   runs,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// getSyncSchedule returns how often an account is synced and whether its scheduled syncs are paused. Accounts without
+// a schedule of their own sync on the default interval.
+func (h *AccountHandler) getSyncSchedule(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, _, ok := h.getAccount(w, r, conn)
+	if !ok {
+		return
+	}
+
+	schedule, err := queries.GetSyncSchedule(r.Context(), repository.GetSyncScheduleParams{
+		DefaultInterval: int32(config.AsynqConfig.FILE_SYNC_INTERVAL),
+		AccountID:       *accountID,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to fetch sync schedule", zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{
+		"interval_minutes": schedule.IntervalMinutes,
+		"paused":           schedule.Status == repository.AccountStatusEnumPaused,
+		"status":           schedule.Status,
+	})
+}
+
+// updateSyncSchedule stores the sync interval of an account and pauses or resumes its scheduled syncs. Workers pick
+// the change up the next time they reload the schedules. Syncs requested by hand still run while paused. Accounts
+// that need to be linked again or ran into an error keep their status, linking them restores it.
+func (h *AccountHandler) updateSyncSchedule(w http.ResponseWriter, r *http.Request) {
+	var payload SyncScheduleValidation
+
+	defer r.Body.Close()
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		config.LOGGER.Error("could not parse json payload", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed"))
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errs := utils.GenerateValidationErrorObject(err.(validator.ValidationErrors), payload)
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, errs)
+		return
+	}
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, authTokens, ok := h.getAccount(w, r, conn)
+	if !ok {
+		return
+	}
+
+	status := authTokens.Status
+
+	err = utils.WithTransaction(r.Context(), conn, func(tx pgx.Tx) error {
+		qx := queries.WithTx(tx)
+
+		err := qx.SaveSyncSchedule(r.Context(), repository.SaveSyncScheduleParams{
+			AccountID:       *accountID,
+			IntervalMinutes: int32(payload.IntervalMinutes),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		updated, err := qx.SetAccountPaused(r.Context(), repository.SetAccountPausedParams{
+			Paused:    payload.Paused,
+			AccountID: *accountID,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if updated > 0 {
+			status = repository.AccountStatusEnumActive
+
+			if payload.Paused {
+				status = repository.AccountStatusEnumPaused
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to save sync schedule", zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{
+		"interval_minutes": payload.IntervalMinutes,
+		"paused":           status == repository.AccountStatusEnumPaused,
+		"status":           status,
+	})
+}
+
+// getAccount loads the linked account named in the url along with its tokens, the account has to belong to the
+// requesting user. The error response is already sent when ok is false.
+func (h *AccountHandler) getAccount(w http.ResponseWriter, r *http.Request, conn *pgxpool.Conn) (*pgtype.UUID, repository.GetAuthTokensRow, bool) {
+	userID := r.Context().Value(middlewares.UserKey).(string)
+
+	accountID, err := db.PGUUID(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.SendAPIErrorResponse(w, http.StatusBadRequest, fmt.Errorf("invalid account id or UUID"))
+		return nil, repository.GetAuthTokensRow{}, false
+	}
+
+	authTokens, err := repository.New(conn).GetAuthTokens(r.Context(), repository.GetAuthTokensParams{
+		UserID:    userID,
+		AccountID: *accountID,
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.SendAPIErrorResponse(w, http.StatusNotFound, fmt.Errorf("account not found"))
+			return nil, authTokens, false
+		}
+		config.LOGGER.Error("failed to fetch account", zap.String("user_id", userID), zap.String("account_id", accountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return nil, authTokens, false
+	}
+
+	return accountID, authTokens, true
+}
@@ -4,16 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 
+	"github.com/blackmamoth/cloudmesh/pkg/catalog"
 	"github.com/blackmamoth/cloudmesh/pkg/config"
 	"github.com/blackmamoth/cloudmesh/pkg/db"
 	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
 	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/tokens"
 	"github.com/blackmamoth/cloudmesh/pkg/utils"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
@@ -32,10 +37,17 @@ type FilesHandler struct {
 	fileMiddleware *middlewares.FileMiddleware
 }
 
+// GetFilesValidation is the payload of POST /files. ParentFolder takes the id of a synced folder as returned in
+// parent_id, or "/" for the root. Clients written before parent_id existed send the provider folder id instead, which
+// is still matched against the parent reported by the provider but is not resolved across providers or renames.
 type GetFilesValidation struct {
-	Provider     string `validate:"omitempty,oneof=google dropbox" json:"provider"`
+	Provider     string `validate:"omitempty,oneof=google dropbox onedrive s3 webdav sftp box azure_blob" json:"provider"`
 	ParentFolder string `validate:"omitempty" json:"parent_folder"`
+	Path         string `validate:"omitempty,startswith=/" json:"path"`
 	Search       string `validate:"omitempty" json:"search"`
+	Owner        string `validate:"omitempty" json:"owner"`
+	Shared       *bool  `validate:"omitempty" json:"shared"`
+	SharedWithMe *bool  `validate:"omitempty" json:"shared_with_me"`
 	SortOn       string `validate:"omitempty" json:"sort_on"`
 	SortBy       string `validate:"omitempty" json:"sort_by"`
 	Limit        int32  `validate:"omitempty" json:"limit"`
@@ -46,6 +58,11 @@ type UploadFilesValidation struct {
 	AccountID string `validate:"required" json:"account_id"`
 }
 
+type MoveFileValidation struct {
+	ParentID string `validate:"omitempty" json:"parent_id"`
+	Name     string `validate:"omitempty,excludesall=/\\" json:"name"`
+}
+
 func (v *GetFilesValidation) setDefaults() {
 	if v.Limit == 0 {
 		v.Limit = DEFAULT_LIMIT
@@ -55,7 +72,8 @@ func (v *GetFilesValidation) setDefaults() {
 		v.Offset = DEFAULT_OFFSET
 	}
 
-	if v.ParentFolder == "" && v.Search == "" {
+	// filters search across folders, only a plain listing starts at the root
+	if v.ParentFolder == "" && v.Path == "" && v.Search == "" && v.Owner == "" && v.Shared == nil && v.SharedWithMe == nil {
 		v.ParentFolder = DEFAULT_PARENT_FOLDER
 	}
 
@@ -87,6 +105,10 @@ func (h *FilesHandler) RegisterRoutes() *chi.Mux {
 	})
 
 	r.Post("/", h.getFiles)
+	r.Get("/{id}/breadcrumbs", h.getBreadcrumbs)
+	r.Get("/{id}/download", h.downloadFile)
+	r.Patch("/{id}", h.moveFile)
+	r.Delete("/{id}", h.deleteFile)
 
 	return r
 }
@@ -125,10 +147,14 @@ func (h *FilesHandler) getFiles(w http.ResponseWriter, r *http.Request) {
 	files, err := queries.GetSyncedItems(r.Context(), repository.GetSyncedItemsParams{
 		UserID:       userID,
 		ParentFolder: db.PGTextField(payload.ParentFolder),
+		Path:         db.PGTextField(payload.Path),
 		Provider:     repository.ProviderEnum(payload.Provider),
 		SortOn:       payload.SortOn,
 		SortBy:       payload.SortBy,
 		Search:       payload.Search,
+		Owner:        payload.Owner,
+		IsShared:     db.PGBoolField(payload.Shared),
+		SharedWithMe: db.PGBoolField(payload.SharedWithMe),
 		LimitBy:      payload.Limit,
 		OffsetBy:     payload.Offset,
 	})
@@ -142,8 +168,12 @@ func (h *FilesHandler) getFiles(w http.ResponseWriter, r *http.Request) {
 	totalFileCount, err := queries.CountFilesWithFilters(r.Context(), repository.CountFilesWithFiltersParams{
 		UserID:       userID,
 		ParentFolder: db.PGTextField(payload.ParentFolder),
+		Path:         db.PGTextField(payload.Path),
 		Provider:     repository.ProviderEnum(payload.Provider),
 		Search:       payload.Search,
+		Owner:        payload.Owner,
+		IsShared:     db.PGBoolField(payload.Shared),
+		SharedWithMe: db.PGBoolField(payload.SharedWithMe),
 	})
 
 	if err != nil {
@@ -205,6 +235,7 @@ func (h *FilesHandler) uploadFilesToProvider(w http.ResponseWriter, r *http.Requ
 		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed, please try again later"))
 		return
 	}
+	defer conn.Release()
 
 	queries := repository.New(conn)
 
@@ -219,13 +250,13 @@ func (h *FilesHandler) uploadFilesToProvider(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	provider, ok := providers.OAuthProviders[string(authTokens.Provider)]
+	uploader, ok := providers.GetUploader(string(authTokens.Provider))
 	if !ok {
-		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, providers.ErrUnsupportedProvider)
+		utils.SendAPIErrorResponse(w, http.StatusNotImplemented, providers.ErrUnsupportedAction)
 		return
 	}
 
-	err = provider.UploadFiles(r.Context(), accountID, conn, queries, authTokens, uploadedFiles)
+	items, err := uploader.UploadFiles(r.Context(), tokens.New(conn, *accountID, authTokens).Account(), uploadedFiles)
 
 	if err != nil {
 		config.LOGGER.Error("failed to upload files", zap.Error(err), zap.String("user_id", userID), zap.String("account_id", accountID.String()))
@@ -233,5 +264,273 @@ func (h *FilesHandler) uploadFilesToProvider(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if _, err := catalog.SaveItems(r.Context(), conn, *accountID, items); err != nil {
+		config.LOGGER.Error("failed to insert uploaded files", zap.Error(err), zap.String("user_id", userID), zap.String("account_id", accountID.String()))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("your files were uploaded but could not be saved, they will show up after the next sync"))
+		return
+	}
+
 	utils.SendAPIResponse(w, http.StatusOK, "files uploaded successfully")
 }
+
+func (h *FilesHandler) getBreadcrumbs(w http.ResponseWriter, r *http.Request) {
+	itemID, err := db.PGUUID(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.SendAPIErrorResponse(w, http.StatusBadRequest, fmt.Errorf("invalid file id or UUID"))
+		return
+	}
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	userID := r.Context().Value(middlewares.UserKey).(string)
+
+	breadcrumbs, err := repository.New(conn).GetItemBreadcrumbs(r.Context(), repository.GetItemBreadcrumbsParams{
+		ID:     *itemID,
+		UserID: userID,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to fetch breadcrumbs", zap.String("user_id", userID), zap.String("file_id", itemID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("we could not fetch your files details, please try again later"))
+		return
+	}
+
+	if len(breadcrumbs) == 0 {
+		utils.SendAPIErrorResponse(w, http.StatusNotFound, fmt.Errorf("file not found"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{
+		"breadcrumbs": breadcrumbs,
+	})
+}
+
+// getItem loads a synced item of the requesting user along with the tokens of the account it belongs to. The error
+// response is already sent when ok is false.
+func (h *FilesHandler) getItem(w http.ResponseWriter, r *http.Request, conn *pgxpool.Conn) (repository.GetSyncedItemByIDRow, *tokens.AccountTokens, bool) {
+	userID := r.Context().Value(middlewares.UserKey).(string)
+
+	itemID, err := db.PGUUID(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.SendAPIErrorResponse(w, http.StatusBadRequest, fmt.Errorf("invalid file id or UUID"))
+		return repository.GetSyncedItemByIDRow{}, nil, false
+	}
+
+	queries := repository.New(conn)
+
+	item, err := queries.GetSyncedItemByID(r.Context(), repository.GetSyncedItemByIDParams{
+		ID:     *itemID,
+		UserID: userID,
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.SendAPIErrorResponse(w, http.StatusNotFound, fmt.Errorf("file not found"))
+			return item, nil, false
+		}
+		config.LOGGER.Error("failed to fetch file", zap.String("user_id", userID), zap.String("file_id", itemID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed, please try again later"))
+		return item, nil, false
+	}
+
+	authTokens, err := queries.GetAuthTokens(r.Context(), repository.GetAuthTokensParams{
+		UserID:    userID,
+		AccountID: item.AccountID,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to fetch auth tokens from db", zap.Error(err), zap.String("user_id", userID), zap.String("account_id", item.AccountID.String()))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed, please try again later"))
+		return item, nil, false
+	}
+
+	return item, tokens.New(conn, item.AccountID, authTokens), true
+}
+
+func toProviderItem(item repository.GetSyncedItemByIDRow) providers.Item {
+	return providers.Item{
+		ProviderFileID: item.ProviderFileID,
+		Name:           item.Name,
+		Extension:      item.Extension,
+		Size:           item.Size,
+		MimeType:       item.MimeType.String,
+		ParentFolder:   item.ParentFolder.String,
+		IsFolder:       item.IsFolder,
+	}
+}
+
+func (h *FilesHandler) downloadFile(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	item, accountTokens, ok := h.getItem(w, r, conn)
+	if !ok {
+		return
+	}
+
+	if item.IsFolder {
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("folders can not be downloaded"))
+		return
+	}
+
+	downloader, ok := providers.GetDownloader(string(item.Provider))
+	if !ok {
+		utils.SendAPIErrorResponse(w, http.StatusNotImplemented, providers.ErrUnsupportedAction)
+		return
+	}
+
+	download, err := downloader.DownloadFile(r.Context(), accountTokens.Account(), toProviderItem(item))
+	if err != nil {
+		config.LOGGER.Error("failed to download file", zap.String("provider", string(item.Provider)), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusBadGateway, fmt.Errorf("your file could not be downloaded, please try again later"))
+		return
+	}
+	defer download.Body.Close()
+
+	contentType := download.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": download.Name}))
+
+	if download.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(download.Size, 10))
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, download.Body); err != nil {
+		config.LOGGER.Error("failed to stream file download", zap.String("provider", string(item.Provider)), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+	}
+}
+
+func (h *FilesHandler) deleteFile(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	item, accountTokens, ok := h.getItem(w, r, conn)
+	if !ok {
+		return
+	}
+
+	deleter, ok := providers.GetDeleter(string(item.Provider))
+	if !ok {
+		utils.SendAPIErrorResponse(w, http.StatusNotImplemented, providers.ErrUnsupportedAction)
+		return
+	}
+
+	if err := deleter.DeleteFile(r.Context(), accountTokens.Account(), toProviderItem(item)); err != nil {
+		config.LOGGER.Error("failed to delete file", zap.String("provider", string(item.Provider)), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusBadGateway, fmt.Errorf("your file could not be deleted, please try again later"))
+		return
+	}
+
+	if err := catalog.RemoveItems(r.Context(), conn, item.AccountID, []string{item.ProviderFileID}); err != nil {
+		config.LOGGER.Error("failed to remove deleted file", zap.String("provider", string(item.Provider)), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("your file was deleted but could not be removed, it will disappear after the next sync"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, "file deleted successfully")
+}
+
+func (h *FilesHandler) moveFile(w http.ResponseWriter, r *http.Request) {
+	var payload MoveFileValidation
+
+	defer r.Body.Close()
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		config.LOGGER.Error("could not parse json payload", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed"))
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errs := utils.GenerateValidationErrorObject(err.(validator.ValidationErrors), payload)
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, errs)
+		return
+	}
+
+	if payload.ParentID == "" && payload.Name == "" {
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("`parent_id` or `name` is required"))
+		return
+	}
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	item, accountTokens, ok := h.getItem(w, r, conn)
+	if !ok {
+		return
+	}
+
+	mover, ok := providers.GetMover(string(item.Provider))
+	if !ok {
+		utils.SendAPIErrorResponse(w, http.StatusNotImplemented, providers.ErrUnsupportedAction)
+		return
+	}
+
+	parentID := payload.ParentID
+
+	if parentID != "" && parentID != DEFAULT_PARENT_FOLDER {
+		destinationID, err := db.PGUUID(parentID)
+		if err != nil {
+			utils.SendAPIErrorResponse(w, http.StatusBadRequest, fmt.Errorf("invalid parent id or UUID"))
+			return
+		}
+
+		destination, err := repository.New(conn).GetSyncedItemByID(r.Context(), repository.GetSyncedItemByIDParams{
+			ID:     *destinationID,
+			UserID: r.Context().Value(middlewares.UserKey).(string),
+		})
+
+		if err != nil || !destination.IsFolder || destination.AccountID != item.AccountID {
+			utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("the destination must be a folder of the same account"))
+			return
+		}
+
+		parentID = destination.ProviderFileID
+	}
+
+	movedItem, err := mover.MoveFile(r.Context(), accountTokens.Account(), toProviderItem(item), parentID, payload.Name)
+	if err != nil {
+		if errors.Is(err, providers.ErrUnsupportedAction) {
+			utils.SendAPIErrorResponse(w, http.StatusNotImplemented, err)
+			return
+		}
+		config.LOGGER.Error("failed to move file", zap.String("provider", string(item.Provider)), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusBadGateway, fmt.Errorf("your file could not be moved, please try again later"))
+		return
+	}
+
+	if err := catalog.ReplaceItem(r.Context(), conn, item.AccountID, item.ProviderFileID, *movedItem); err != nil {
+		config.LOGGER.Error("failed to update moved file", zap.String("provider", string(item.Provider)), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("your file was moved but could not be updated, it will show up after the next sync"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, "file moved successfully")
+}
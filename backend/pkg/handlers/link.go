@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -14,13 +13,14 @@ import (
 
 	"github.com/blackmamoth/cloudmesh/pkg/config"
 	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
 	"github.com/blackmamoth/cloudmesh/pkg/providers"
 	"github.com/blackmamoth/cloudmesh/pkg/tasks"
 	"github.com/blackmamoth/cloudmesh/pkg/utils"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/sessions"
-	"github.com/hibiken/asynq"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
@@ -28,7 +28,8 @@ import (
 )
 
 type LinkHandler struct {
-	connPool *pgxpool.Pool
+	connPool       *pgxpool.Pool
+	authMiddleware *middlewares.AuthMiddleware
 }
 
 type OAuthState struct {
@@ -60,9 +61,10 @@ func init() {
 	}
 }
 
-func NewLinkHandler(connPool *pgxpool.Pool) *LinkHandler {
+func NewLinkHandler(connPool *pgxpool.Pool, authMiddleware *middlewares.AuthMiddleware) *LinkHandler {
 	return &LinkHandler{
-		connPool: connPool,
+		connPool:       connPool,
+		authMiddleware: authMiddleware,
 	}
 }
 
@@ -71,6 +73,12 @@ func (h *LinkHandler) RegisterRoutes() *chi.Mux {
 
 	r.Get("/{provider}", h.linkAccount)
 	r.Get("/{provider}/callback", h.linkAccountCallback)
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.authMiddleware.VerifyAccessToken)
+		r.Post("/{provider}/credentials", h.linkAccountWithCredentials)
+	})
+
 	return r
 }
 
@@ -79,7 +87,7 @@ func (h *LinkHandler) linkAccount(w http.ResponseWriter, r *http.Request) {
 
 	providerName = strings.ToLower(providerName)
 
-	provider, ok := providers.OAuthProviders[providerName]
+	provider, ok := providers.GetAuthenticator(providerName)
 	if !ok {
 		h.errorRedirect(w, r)
 		return
@@ -131,7 +139,7 @@ func (h *LinkHandler) linkAccountCallback(w http.ResponseWriter, r *http.Request
 
 	providerName = strings.ToLower(providerName)
 
-	provider, ok := providers.OAuthProviders[providerName]
+	provider, ok := providers.GetAuthenticator(providerName)
 	if !ok {
 		h.errorRedirect(w, r)
 		return
@@ -157,19 +165,6 @@ func (h *LinkHandler) linkAccountCallback(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	addCountParams := repository.AddAccountDetailsParams{
-		UserID:         userId,
-		Provider:       repository.ProviderEnum(providerName),
-		ProviderUserID: accountInfo.ProviderUserID,
-		AccessToken:    encryptedAccessToken,
-		RefreshToken:   encryptedRefreshToken,
-		TokenType:      db.PGTextField(token.TokenType),
-		Expiry:         db.PGTimestamptzField(token.Expiry),
-		Email:          accountInfo.Email,
-		Name:           accountInfo.Name,
-		AvatarUrl:      db.PGTextField(accountInfo.AvatarURL),
-	}
-
 	conn, err := h.connPool.Acquire(r.Context())
 	if err != nil {
 		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.String("provider", providerName), zap.Error(err))
@@ -180,206 +175,216 @@ func (h *LinkHandler) linkAccountCallback(w http.ResponseWriter, r *http.Request
 
 	queries := repository.New(conn)
 
-	existingAccountID, err := queries.GetAccountByProviderID(r.Context(), repository.GetAccountByProviderIDParams{
+	accountID, successQuery, err := h.saveLinkedAccount(r.Context(), conn, queries, repository.AddAccountDetailsParams{
 		UserID:         userId,
 		Provider:       repository.ProviderEnum(providerName),
 		ProviderUserID: accountInfo.ProviderUserID,
+		AccessToken:    encryptedAccessToken,
+		RefreshToken:   encryptedRefreshToken,
+		TokenType:      db.PGTextField(token.TokenType),
+		Expiry:         db.PGTimestamptzField(token.Expiry),
+		Email:          accountInfo.Email,
+		Name:           accountInfo.Name,
+		AvatarUrl:      db.PGTextField(accountInfo.AvatarURL),
 	})
 
-	var accountID string
-	successQuery := "newAccount"
-
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			err = utils.WithTransaction(r.Context(), conn, func(tx pgx.Tx) error {
-				qx := queries.WithTx(tx)
-
-				id, err := qx.AddAccountDetails(r.Context(), addCountParams)
-
-				if err != nil {
-					return err
-				}
-
-				accountID = id.String()
-
-				return nil
-			})
-
-			if err != nil {
-				config.LOGGER.Error("an error occured while inserting account details", zap.String("provider", providerName), zap.Error(err))
-				h.errorRedirect(w, r)
-				return
-			}
-		} else {
-			config.LOGGER.Error("failed to fetch existing account details", zap.Error(err))
-			h.errorRedirect(w, r)
-			return
-		}
-	} else {
-		accountID = existingAccountID.String()
-
-		err = utils.WithTransaction(r.Context(), conn, func(tx pgx.Tx) error {
-			qx := queries.WithTx(tx)
-
-			err := qx.UpdateAuthTokens(r.Context(), repository.UpdateAuthTokensParams{
-				AccessToken:  encryptedAccessToken,
-				RefreshToken: encryptedRefreshToken,
-				TokenType:    db.PGTextField(token.TokenType),
-				Expiry:       db.PGTimestamptzField(token.Expiry),
-				AccountID:    existingAccountID,
-			})
-
-			return err
-		})
-
-		if err != nil {
-			config.LOGGER.Error("an error occured while updating auth tokens", zap.String("provider", providerName), zap.Error(err))
-			h.errorRedirect(w, r)
-			return
-		}
-
-		successQuery = "existingAccount"
+		h.errorRedirect(w, r)
+		return
 	}
 
 	asynqClient := db.GetAsynqClient()
 
-	if err = h.enqueueFileSyncTaskAndLog(r.Context(), userId, accountID, providerName, asynqClient, queries); err != nil {
-		config.LOGGER.Error("enqueueFileSyncTaskAndLog failed", zap.Error(err))
+	if _, err = tasks.EnqueueFileSyncTaskAndLog(r.Context(), userId, accountID, providerName, asynqClient, queries); err != nil {
+		config.LOGGER.Error("EnqueueFileSyncTaskAndLog failed", zap.Error(err))
 		h.errorRedirect(w, r)
 		return
 	}
 
-	if err = h.enqueueAuthTokenRenewalTaskAndLog(r.Context(), userId, accountID, providerName, time.Duration(token.ExpiresIn), asynqClient, queries); err != nil {
-		config.LOGGER.Error("enqueueAuthTokenRenewalTaskAndLog failed", zap.Error(err))
+	if err = tasks.EnqueueAuthTokenRenewalTaskAndLog(r.Context(), userId, accountID, providerName, token.Expiry, asynqClient, queries); err != nil {
+		config.LOGGER.Error("EnqueueAuthTokenRenewalTaskAndLog failed", zap.Error(err))
 		h.errorRedirect(w, r)
 		return
 	}
 
+	// without a channel drive changes still arrive with the scheduled syncs, the link does not fail over it
+	if _, ok := providers.GetChangeWatcher(providerName); ok && config.APIConfig.PUBLIC_URL != "" {
+		if err = tasks.EnqueueGoogleChannelRenewalTask(userId, accountID, time.Now(), asynqClient); err != nil {
+			config.LOGGER.Error("EnqueueGoogleChannelRenewalTask failed", zap.String("provider", providerName), zap.Error(err))
+		}
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("%s/accounts?successQuery=%s", config.APIConfig.FRONTEND_HOST, successQuery), http.StatusFound)
 }
 
-func (h *LinkHandler) errorRedirect(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, fmt.Sprintf("%s/error", config.APIConfig.FRONTEND_HOST), http.StatusFound)
-}
+func (h *LinkHandler) linkAccountWithCredentials(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
 
-func (h *LinkHandler) validateNonce(ctx context.Context, nonce string) error {
-	key := fmt.Sprintf("link-nonce:%s", nonce)
-	val, err := db.RedisClient.Get(ctx, key).Result()
+	providerName := strings.ToLower(chi.URLParam(r, "provider"))
 
-	if err != nil {
-		if err == redis.Nil {
-			return fmt.Errorf("nonce not found or expired")
-		}
-		config.LOGGER.Error("error querying redis for nonce", zap.Error(err))
-		return err
+	provider, ok := providers.GetCredentialAuthenticator(providerName)
+	if !ok {
+		utils.SendAPIErrorResponse(w, http.StatusNotFound, providers.ErrUnsupportedProvider)
+		return
 	}
 
-	if val != nonce {
-		return fmt.Errorf("nonce mismatch")
-	}
+	credentials := provider.NewCredentials()
 
-	if delErr := db.RedisClient.Del(ctx, key).Err(); delErr != nil {
-		config.LOGGER.Warn("failed to delete used nonce", zap.Error(delErr))
+	if err := utils.ParseJSON(r, credentials); err != nil {
+		config.LOGGER.Error("could not parse json payload", zap.String("provider", providerName), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("your request could not be processed"))
+		return
 	}
 
-	return nil
-}
+	if err := utils.Validate.Struct(credentials); err != nil {
+		errs := utils.GenerateValidationErrorObject(err.(validator.ValidationErrors), credentials)
+		utils.SendAPIErrorResponse(w, http.StatusUnprocessableEntity, errs)
+		return
+	}
 
-func (h *LinkHandler) enqueueFileSyncTaskAndLog(
-	ctx context.Context,
-	userId, accountID, providerName string,
-	asynqClient *asynq.Client,
-	queries *repository.Queries,
-) error {
-	task, err := tasks.NewFileSyncTask(userId, accountID)
+	accountInfo, err := provider.VerifyCredentials(r.Context(), credentials)
 	if err != nil {
-		config.LOGGER.Error("failed to create file sync task", zap.String("provider", providerName), zap.String("task_type", tasks.TypeFileSync), zap.Error(err))
-		return err
+		config.LOGGER.Warn("credential verification failed", zap.String("provider", providerName), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusBadRequest, err)
+		return
 	}
 
-	info, err := asynqClient.Enqueue(task, asynq.MaxRetry(3))
+	credentialsJSON, err := json.Marshal(credentials)
 	if err != nil {
-		config.LOGGER.Error("failed to enqueue file sync task", zap.String("provider", providerName), zap.String("task_type", tasks.TypeFileSync), zap.Error(err))
-		return err
+		config.LOGGER.Error("failed to marshal credentials", zap.String("provider", providerName), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
 	}
 
-	config.LOGGER.Info("file sync task successfully enqueued", zap.String("provider", providerName), zap.String("task_type", tasks.TypeFileSync), zap.String("task_id", info.ID), zap.String("queue", info.Queue))
-
-	params, err := json.Marshal(tasks.FileSyncPayload{UserID: userId, AccountID: accountID})
+	encryptedCredentials, err := utils.Encrypt(string(credentialsJSON))
 	if err != nil {
-		config.LOGGER.Error("failed to marshal file sync task params", zap.String("provider", providerName), zap.Error(err))
-		return nil
+		config.LOGGER.Error("failed to encrypt credentials", zap.String("provider", providerName), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
 	}
 
-	accountUUID, err := db.PGUUID(accountID)
+	userID := r.Context().Value(middlewares.UserKey).(string)
+
+	conn, err := h.connPool.Acquire(r.Context())
 	if err != nil {
-		config.LOGGER.Error("invalid accountID UUID format", zap.String("provider", providerName), zap.String("accountID", accountID), zap.Error(err))
-		return nil
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.String("provider", providerName), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
 	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
 
-	err = queries.AddNewJobLog(ctx, repository.AddNewJobLogParams{
-		JobID:     info.ID,
-		AccountID: *accountUUID,
-		Type:      info.Type,
-		Status:    repository.JobStatusEnumQueued,
-		Queue:     info.Queue,
-		Params:    params,
+	accountID, status, err := h.saveLinkedAccount(r.Context(), conn, queries, repository.AddAccountDetailsParams{
+		UserID:         userID,
+		Provider:       repository.ProviderEnum(providerName),
+		ProviderUserID: accountInfo.ProviderUserID,
+		AccessToken:    encryptedCredentials,
+		RefreshToken:   "",
+		Email:          accountInfo.Email,
+		Name:           accountInfo.Name,
+		AvatarUrl:      db.PGTextField(accountInfo.AvatarURL),
 	})
 
 	if err != nil {
-		config.LOGGER.Error("failed to insert job log", zap.String("provider", providerName), zap.String("task_type", tasks.TypeFileSync), zap.String("task_id", info.ID), zap.String("queue", info.Queue), zap.Error(err))
-		return err
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
 	}
 
-	return nil
+	if _, err = tasks.EnqueueFileSyncTaskAndLog(r.Context(), userID, accountID, providerName, db.GetAsynqClient(), queries); err != nil {
+		config.LOGGER.Error("EnqueueFileSyncTaskAndLog failed", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("your account was linked but the initial sync could not be scheduled"))
+		return
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{
+		"account_id": accountID,
+		"status":     status,
+	})
 }
 
-func (h *LinkHandler) enqueueAuthTokenRenewalTaskAndLog(
-	ctx context.Context,
-	userId, accountID, providerName string,
-	expiresIn time.Duration,
-	asynqClient *asynq.Client,
-	queries *repository.Queries,
-) error {
-	task, err := tasks.NewAuthTokenRenewalTask(userId, accountID)
-	if err != nil {
-		config.LOGGER.Error("failed to create auth token renewal task", zap.String("provider", providerName), zap.String("task_type", tasks.TypeAuthTokenRenewal), zap.Error(err))
-		return err
-	}
+// saveLinkedAccount inserts a newly linked account, or refreshes the stored tokens when the same
+// provider account was linked before. It returns the account id and whether the account is new.
+func (h *LinkHandler) saveLinkedAccount(ctx context.Context, conn *pgxpool.Conn, queries *repository.Queries, params repository.AddAccountDetailsParams) (string, string, error) {
+	existingAccountID, err := queries.GetAccountByProviderID(ctx, repository.GetAccountByProviderIDParams{
+		UserID:         params.UserID,
+		Provider:       params.Provider,
+		ProviderUserID: params.ProviderUserID,
+	})
 
-	info, err := asynqClient.Enqueue(task, asynq.MaxRetry(3), asynq.ProcessIn(expiresIn))
 	if err != nil {
-		config.LOGGER.Error("failed to enqueue auth token renewal task", zap.String("provider", providerName), zap.String("task_type", tasks.TypeAuthTokenRenewal), zap.Error(err))
-		return err
-	}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			config.LOGGER.Error("failed to fetch existing account details", zap.String("provider", string(params.Provider)), zap.Error(err))
+			return "", "", err
+		}
 
-	config.LOGGER.Info("auth token renewal task successfully enqueued", zap.String("provider", providerName), zap.String("task_type", tasks.TypeAuthTokenRenewal), zap.String("task_id", info.ID), zap.String("queue", info.Queue))
+		var accountID string
 
-	params, err := json.Marshal(tasks.AuthTokenRenewalPayload{UserID: userId, AccountID: accountID})
-	if err != nil {
-		config.LOGGER.Error("failed to marshal auth token renewal task params", zap.String("provider", providerName), zap.Error(err))
-		return nil
+		err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+			qx := queries.WithTx(tx)
+
+			id, err := qx.AddAccountDetails(ctx, params)
+
+			if err != nil {
+				return err
+			}
+
+			accountID = id.String()
+
+			return nil
+		})
+
+		if err != nil {
+			config.LOGGER.Error("an error occured while inserting account details", zap.String("provider", string(params.Provider)), zap.Error(err))
+			return "", "", err
+		}
+
+		return accountID, "newAccount", nil
 	}
 
-	accountUUID, err := db.PGUUID(accountID)
+	err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		qx := queries.WithTx(tx)
+
+		return qx.UpdateAuthTokens(ctx, repository.UpdateAuthTokensParams{
+			AccessToken:  params.AccessToken,
+			RefreshToken: params.RefreshToken,
+			TokenType:    params.TokenType,
+			Expiry:       params.Expiry,
+			AccountID:    existingAccountID,
+		})
+	})
+
 	if err != nil {
-		config.LOGGER.Error("invalid accountID UUID format", zap.String("provider", providerName), zap.String("accountID", accountID), zap.Error(err))
-		return nil
+		config.LOGGER.Error("an error occured while updating auth tokens", zap.String("provider", string(params.Provider)), zap.Error(err))
+		return "", "", err
 	}
 
-	err = queries.AddNewJobLog(ctx, repository.AddNewJobLogParams{
-		JobID:     info.ID,
-		AccountID: *accountUUID,
-		Type:      info.Type,
-		Status:    repository.JobStatusEnumQueued,
-		Queue:     info.Queue,
-		Params:    params,
-	})
+	return existingAccountID.String(), "existingAccount", nil
+}
+
+func (h *LinkHandler) errorRedirect(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, fmt.Sprintf("%s/error", config.APIConfig.FRONTEND_HOST), http.StatusFound)
+}
+
+func (h *LinkHandler) validateNonce(ctx context.Context, nonce string) error {
+	key := fmt.Sprintf("link-nonce:%s", nonce)
+	val, err := db.RedisClient.Get(ctx, key).Result()
 
 	if err != nil {
-		config.LOGGER.Error("failed to insert job log", zap.String("provider", providerName), zap.String("task_type", tasks.TypeAuthTokenRenewal), zap.String("task_id", info.ID), zap.String("queue", info.Queue), zap.Error(err))
+		if err == redis.Nil {
+			return fmt.Errorf("nonce not found or expired")
+		}
+		config.LOGGER.Error("error querying redis for nonce", zap.Error(err))
 		return err
 	}
 
+	if val != nonce {
+		return fmt.Errorf("nonce mismatch")
+	}
+
+	if delErr := db.RedisClient.Del(ctx, key).Err(); delErr != nil {
+		config.LOGGER.Warn("failed to delete used nonce", zap.Error(delErr))
+	}
+
 	return nil
 }
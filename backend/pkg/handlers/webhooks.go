@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/tasks"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// WEBHOOK_MAX_BODY_SIZE caps notification bodies, providers only send account ids.
+const WEBHOOK_MAX_BODY_SIZE = 1 << 20
+
+type WebhooksHandler struct {
+	connPool *pgxpool.Pool
+}
+
+type DropboxWebhookNotification struct {
+	ListFolder struct {
+		Accounts []string `json:"accounts"`
+	} `json:"list_folder"`
+}
+
+func NewWebhooksHandler(connPool *pgxpool.Pool) *WebhooksHandler {
+	return &WebhooksHandler{
+		connPool: connPool,
+	}
+}
+
+// RegisterRoutes mounts the provider notification endpoints. They are public, every request is verified against the
+// signature or channel token of the provider instead.
+func (h *WebhooksHandler) RegisterRoutes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/dropbox", h.verifyDropboxWebhook)
+	r.Post("/dropbox", h.receiveDropboxWebhook)
+	r.Post("/google", h.receiveGoogleWebhook)
+
+	return r
+}
+
+// verifyDropboxWebhook answers the challenge Dropbox sends when the webhook uri is registered.
+func (h *WebhooksHandler) verifyDropboxWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, r.URL.Query().Get("challenge"))
+}
+
+// receiveDropboxWebhook enqueues a sync for every linked account Dropbox reported changes for. Notifications of the
+// same account coalesce into one pending sync.
+func (h *WebhooksHandler) receiveDropboxWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, WEBHOOK_MAX_BODY_SIZE))
+	if err != nil {
+		utils.SendAPIErrorResponse(w, http.StatusBadRequest, fmt.Errorf("could not read request body"))
+		return
+	}
+
+	if !validDropboxSignature(body, r.Header.Get("X-Dropbox-Signature")) {
+		config.LOGGER.Warn("rejected dropbox webhook with invalid signature", zap.String("provider", providers.DROPBOX_PROVIDER_NAME))
+		utils.SendAPIErrorResponse(w, http.StatusForbidden, fmt.Errorf("invalid signature"))
+		return
+	}
+
+	var notification DropboxWebhookNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		utils.SendAPIErrorResponse(w, http.StatusBadRequest, fmt.Errorf("invalid notification body"))
+		return
+	}
+
+	if len(notification.ListFolder.Accounts) == 0 {
+		utils.SendAPIResponse(w, http.StatusOK, map[string]any{"enqueued": 0})
+		return
+	}
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accounts, err := queries.GetAccountsByProviderUserIDs(r.Context(), repository.GetAccountsByProviderUserIDsParams{
+		Provider:        repository.ProviderEnumDropbox,
+		ProviderUserIds: notification.ListFolder.Accounts,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to fetch accounts for dropbox webhook", zap.String("provider", providers.DROPBOX_PROVIDER_NAME), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	enqueued := 0
+
+	for _, account := range accounts {
+		info, alreadyQueued, err := tasks.EnqueueFileSyncOnce(r.Context(), account.UserID, account.ID.String(), providers.DROPBOX_PROVIDER_NAME, tasks.QUEUE_DEFAULT, queries)
+		if err != nil {
+			config.LOGGER.Error("failed to enqueue sync for dropbox webhook", zap.String("provider", providers.DROPBOX_PROVIDER_NAME), zap.String("account_id", account.ID.String()), zap.Error(err))
+			continue
+		}
+
+		if !alreadyQueued {
+			enqueued++
+		}
+
+		config.LOGGER.Info("dropbox webhook received", zap.String("account_id", account.ID.String()), zap.String("task_id", info.ID), zap.Bool("already_queued", alreadyQueued))
+	}
+
+	utils.SendAPIResponse(w, http.StatusOK, map[string]any{"enqueued": enqueued})
+}
+
+// receiveGoogleWebhook enqueues a sync for the account a Drive change channel belongs to. The channel token sent with
+// every notification has to match the one the channel was opened with.
+func (h *WebhooksHandler) receiveGoogleWebhook(w http.ResponseWriter, r *http.Request) {
+	channelID := r.Header.Get("X-Goog-Channel-ID")
+	if channelID == "" {
+		utils.SendAPIErrorResponse(w, http.StatusBadRequest, fmt.Errorf("missing channel id"))
+		return
+	}
+
+	conn, err := h.connPool.Acquire(r.Context())
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	channel, err := queries.GetGoogleChannel(r.Context(), channelID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.SendAPIErrorResponse(w, http.StatusNotFound, fmt.Errorf("unknown channel"))
+			return
+		}
+		config.LOGGER.Error("failed to fetch google channel", zap.String("provider", providers.GOOGLE_PROVIDER_NAME), zap.String("channel_id", channelID), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	valid, err := validGoogleChannel(channel, r.Header)
+	if err != nil {
+		config.LOGGER.Error("could not decrypt channel token", zap.String("provider", providers.GOOGLE_PROVIDER_NAME), zap.String("channel_id", channelID))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	if !valid {
+		config.LOGGER.Warn("rejected google webhook with invalid channel token", zap.String("provider", providers.GOOGLE_PROVIDER_NAME), zap.String("channel_id", channelID))
+		utils.SendAPIErrorResponse(w, http.StatusForbidden, fmt.Errorf("invalid channel token"))
+		return
+	}
+
+	// drive confirms a new channel with a sync message, there is nothing to fetch yet
+	if r.Header.Get("X-Goog-Resource-State") == "sync" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	info, alreadyQueued, err := tasks.EnqueueFileSyncOnce(r.Context(), channel.UserID, channel.AccountID.String(), providers.GOOGLE_PROVIDER_NAME, tasks.QUEUE_DEFAULT, queries)
+	if err != nil {
+		config.LOGGER.Error("failed to enqueue sync for google webhook", zap.String("provider", providers.GOOGLE_PROVIDER_NAME), zap.String("account_id", channel.AccountID.String()), zap.Error(err))
+		utils.SendAPIErrorResponse(w, http.StatusInternalServerError, fmt.Errorf("failed to process your request, please try again later"))
+		return
+	}
+
+	config.LOGGER.Info("google webhook received", zap.String("account_id", channel.AccountID.String()), zap.String("task_id", info.ID), zap.Bool("already_queued", alreadyQueued))
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// validDropboxSignature checks the hex encoded HMAC-SHA256 of the body keyed with the app secret.
+func validDropboxSignature(body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.OAuthConfig.DROPBOX.CLIENT_SECRET))
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// validGoogleChannel checks the channel token and resource id a notification was sent with against the stored channel.
+func validGoogleChannel(channel repository.GetGoogleChannelRow, header http.Header) (bool, error) {
+	channelToken, err := utils.Decrypt(channel.Token)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(channelToken), []byte(header.Get("X-Goog-Channel-Token"))) == 1 && channel.ResourceID == header.Get("X-Goog-Resource-ID"), nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
+	"github.com/blackmamoth/cloudmesh/repository"
+)
+
+// withDropboxSecret sets the app secret notifications are signed with for the duration of the test.
+func withDropboxSecret(t *testing.T, secret string) {
+	t.Helper()
+
+	previous := config.OAuthConfig.DROPBOX.CLIENT_SECRET
+	config.OAuthConfig.DROPBOX.CLIENT_SECRET = secret
+
+	t.Cleanup(func() {
+		config.OAuthConfig.DROPBOX.CLIENT_SECRET = previous
+	})
+}
+
+func signDropbox(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestDropboxWebhookSignature(t *testing.T) {
+	withDropboxSecret(t, "app-secret")
+
+	server := httptest.NewServer(NewWebhooksHandler(nil).RegisterRoutes())
+	defer server.Close()
+
+	// a notification without accounts is answered without touching the database
+	const body = `{"list_folder": {"accounts": []}, "delta": {"users": []}}`
+
+	tests := []struct {
+		name      string
+		signature string
+		status    int
+	}{
+		{name: "valid signature", signature: signDropbox("app-secret", body), status: http.StatusOK},
+		{name: "signed with another secret", signature: signDropbox("other-secret", body), status: http.StatusForbidden},
+		{name: "signature of another body", signature: signDropbox("app-secret", body+" "), status: http.StatusForbidden},
+		{name: "not hex", signature: "not-a-signature", status: http.StatusForbidden},
+		{name: "missing signature", signature: "", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/dropbox", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.signature != "" {
+				req.Header.Set("X-Dropbox-Signature", tt.signature)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("webhook answered %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestDropboxWebhookChallenge(t *testing.T) {
+	server := httptest.NewServer(NewWebhooksHandler(nil).RegisterRoutes())
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/dropbox?challenge=abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusOK || string(body) != "abc123" {
+		t.Fatalf("challenge answered %d %q, want 200 with the challenge", res.StatusCode, body)
+	}
+}
+
+func TestValidGoogleChannel(t *testing.T) {
+	previous := config.AESConfig.MASTER_KEY
+	config.AESConfig.MASTER_KEY = strings.Repeat("ab", 32)
+
+	t.Cleanup(func() {
+		config.AESConfig.MASTER_KEY = previous
+	})
+
+	token, err := utils.Encrypt("channel-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := repository.GetGoogleChannelRow{ResourceID: "resource", Token: token}
+
+	tests := []struct {
+		name       string
+		token      string
+		resourceID string
+		valid      bool
+	}{
+		{name: "matching token and resource", token: "channel-token", resourceID: "resource", valid: true},
+		{name: "another token", token: "channel-tokem", resourceID: "resource"},
+		{name: "prefix of the token", token: "channel", resourceID: "resource"},
+		{name: "missing token", resourceID: "resource"},
+		{name: "another resource", token: "channel-token", resourceID: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Goog-Channel-Token", tt.token)
+			header.Set("X-Goog-Resource-ID", tt.resourceID)
+
+			valid, err := validGoogleChannel(channel, header)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if valid != tt.valid {
+				t.Fatalf("validGoogleChannel returned %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+
+	// a token that can not be decrypted is an error of ours, not a forged notification
+	if _, err := validGoogleChannel(repository.GetGoogleChannelRow{ResourceID: "resource", Token: "garbage"}, http.Header{}); err == nil {
+		t.Fatal("validGoogleChannel accepted a token it could not decrypt")
+	}
+}
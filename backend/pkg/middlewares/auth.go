@@ -44,44 +44,12 @@ func (m *AuthMiddleware) VerifyAccessToken(next http.Handler) http.Handler {
 			return
 		}
 
-		var publicKeyJWK string
-
-		conn, err := m.connPool.Acquire(r.Context())
+		userID, err := m.authenticate(r.Context(), tokenString)
 		if err != nil {
-			config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
-			utils.SendAPIErrorResponse(w, http.StatusInternalServerError, ErrUnexpected)
-			return
-		}
-		defer conn.Release()
-
-		publicKeyJWKCache := db.RedisClient.Get(r.Context(), "public_key_jwk")
-		if publicKeyJWKCache.Err() != nil {
-			if publicKeyJWKCache.Err() != redis.Nil {
-				config.LOGGER.Warn("could not fetch public key from redis cache", zap.Error(err))
-			}
-
-			publicKeyJWK, err := m.getJWKSPublicKey(r.Context(), conn)
-			if err != nil {
-				config.LOGGER.Error("could not fetch public key from database", zap.Error(err))
+			if errors.Is(err, ErrUnexpected) {
 				utils.SendAPIErrorResponse(w, http.StatusInternalServerError, ErrUnexpected)
 				return
 			}
-
-			db.RedisClient.Set(r.Context(), "public_key_jwk", publicKeyJWK, time.Hour)
-		} else {
-			publicKeyJWK = publicKeyJWKCache.Val()
-		}
-
-		jwtClaims, err := utils.ParseJWT(tokenString, publicKeyJWK)
-		if err != nil {
-			config.LOGGER.Error("could not parse jwt token", zap.Error(err))
-			utils.SendAPIErrorResponse(w, http.StatusUnauthorized, ErrUnauthorized)
-			return
-		}
-
-		userID := jwtClaims.UserID
-
-		if err := m.checkUserExists(r.Context(), conn, userID); err != nil {
 			utils.SendAPIErrorResponse(w, http.StatusUnauthorized, ErrUnauthorized)
 			return
 		}
@@ -97,6 +65,51 @@ func (m *AuthMiddleware) VerifyAccessToken(next http.Handler) http.Handler {
 	})
 }
 
+// authenticate returns the id of the user the token was issued to. The connection it needs is back in the pool by the
+// time it returns, long running handlers such as event streams would otherwise hold it until they return. Failures
+// are ErrUnexpected or ErrUnauthorized.
+func (m *AuthMiddleware) authenticate(ctx context.Context, tokenString string) (string, error) {
+	var publicKeyJWK string
+
+	conn, err := m.connPool.Acquire(ctx)
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		return "", ErrUnexpected
+	}
+	defer conn.Release()
+
+	publicKeyJWKCache := db.RedisClient.Get(ctx, "public_key_jwk")
+	if publicKeyJWKCache.Err() != nil {
+		if publicKeyJWKCache.Err() != redis.Nil {
+			config.LOGGER.Warn("could not fetch public key from redis cache", zap.Error(err))
+		}
+
+		publicKeyJWK, err := m.getJWKSPublicKey(ctx, conn)
+		if err != nil {
+			config.LOGGER.Error("could not fetch public key from database", zap.Error(err))
+			return "", ErrUnexpected
+		}
+
+		db.RedisClient.Set(ctx, "public_key_jwk", publicKeyJWK, time.Hour)
+	} else {
+		publicKeyJWK = publicKeyJWKCache.Val()
+	}
+
+	jwtClaims, err := utils.ParseJWT(tokenString, publicKeyJWK)
+	if err != nil {
+		config.LOGGER.Error("could not parse jwt token", zap.Error(err))
+		return "", ErrUnauthorized
+	}
+
+	userID := jwtClaims.UserID
+
+	if err := m.checkUserExists(ctx, conn, userID); err != nil {
+		return "", ErrUnauthorized
+	}
+
+	return userID, nil
+}
+
 func (m *AuthMiddleware) checkUserExists(ctx context.Context, conn *pgxpool.Conn, userId string) error {
 	queries := repository.New(conn)
 
@@ -0,0 +1,99 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	PHASE_STARTED    = "started"
+	PHASE_SYNCING    = "syncing"
+	PHASE_FINALIZING = "finalizing"
+	PHASE_STATUS     = "status"
+)
+
+// SyncEvent is a progress update of a running file sync. Status events carry the job_logs status of the sync job,
+// a succeeded or failed status is the last event of a job.
+type SyncEvent struct {
+	AccountID      string    `json:"account_id"`
+	JobID          string    `json:"job_id,omitempty"`
+	Phase          string    `json:"phase"`
+	Page           int       `json:"page"`
+	ItemsProcessed int       `json:"items_processed"`
+	ItemsDeleted   int       `json:"items_deleted"`
+	Status         string    `json:"status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// Channel is the redis pub/sub channel sync events of an account are published on.
+func Channel(accountID string) string {
+	return fmt.Sprintf("sync:events:%s", accountID)
+}
+
+// Reporter publishes the events of a single sync job, a nil Reporter drops them.
+type Reporter struct {
+	accountID string
+	jobID     string
+}
+
+func NewReporter(accountID, jobID string) *Reporter {
+	return &Reporter{
+		accountID: accountID,
+		jobID:     jobID,
+	}
+}
+
+// JobID returns the id of the job the reporter publishes for, empty for a nil Reporter.
+func (r *Reporter) JobID() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.jobID
+}
+
+// Publish sends the event to subscribers of the account, events are best effort and a failed publish never fails the
+// sync.
+func (r *Reporter) Publish(ctx context.Context, event SyncEvent) {
+	if r == nil {
+		return
+	}
+
+	event.AccountID = r.accountID
+	event.JobID = r.jobID
+	event.Time = time.Now()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		config.LOGGER.Error("failed to marshal sync event", zap.String("account_id", r.accountID), zap.Error(err))
+		return
+	}
+
+	if err := db.RedisClient.Publish(ctx, Channel(r.accountID), payload).Err(); err != nil {
+		config.LOGGER.Warn("failed to publish sync event", zap.String("account_id", r.accountID), zap.String("phase", event.Phase), zap.Error(err))
+	}
+}
+
+// PublishStatus publishes a job_logs status transition of the job.
+func (r *Reporter) PublishStatus(ctx context.Context, status string, jobErr error) {
+	event := SyncEvent{Phase: PHASE_STATUS, Status: status}
+
+	if jobErr != nil {
+		event.Error = jobErr.Error()
+	}
+
+	r.Publish(ctx, event)
+}
+
+// Subscribe listens to the sync events of an account, the caller closes the returned subscription.
+func Subscribe(ctx context.Context, accountID string) *redis.PubSub {
+	return db.RedisClient.Subscribe(ctx, Channel(accountID))
+}
@@ -0,0 +1,406 @@
+package providers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+type AzureBlobProvider struct{}
+
+type AzureBlobCredentials struct {
+	AccountName string `validate:"required" json:"account_name"`
+	AccountKey  string `validate:"required_without=SASToken" json:"account_key"`
+	SASToken    string `validate:"required_without=AccountKey" json:"sas_token"`
+	Container   string `validate:"required" json:"container"`
+	// Endpoint overrides the public blob endpoint, e.g. http://127.0.0.1:10000/devstoreaccount1 for azurite
+	Endpoint string `validate:"omitempty,url" json:"endpoint"`
+}
+
+const (
+	AZURE_BLOB_PROVIDER_NAME   = string(repository.ProviderEnumAzureBlob)
+	AZURE_BLOB_SYNC_BATCH_SIZE = 1000
+	AZURE_BLOB_DELIMITER       = "/"
+	AZURE_BLOB_UPLOAD_BLOCK    = 4 * 1024 * 1024
+)
+
+func NewAzureBlobProvider() *AzureBlobProvider {
+	return &AzureBlobProvider{}
+}
+
+func (p *AzureBlobProvider) NewCredentials() any {
+	return &AzureBlobCredentials{}
+}
+
+func (p *AzureBlobProvider) VerifyCredentials(ctx context.Context, creds any) (*UserAccountInfo, error) {
+	azureCredentials, ok := creds.(*AzureBlobCredentials)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	client, err := p.newClient(azureCredentials)
+	if err != nil {
+		config.LOGGER.Error("failed to create azure blob client", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.Error(err))
+		return nil, ErrInvalidCredentials
+	}
+
+	// listing a single blob works for both account keys and container scoped SAS tokens
+	maxResults := int32(1)
+	pager := client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{MaxResults: &maxResults})
+
+	if _, err := pager.NextPage(ctx); err != nil {
+		config.LOGGER.Error("failed to verify azure blob container", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.String("container", azureCredentials.Container), zap.Error(err))
+		return nil, ErrInvalidCredentials
+	}
+
+	return &UserAccountInfo{
+		Provider:       AZURE_BLOB_PROVIDER_NAME,
+		ProviderUserID: fmt.Sprintf("%s/%s", azureCredentials.AccountName, azureCredentials.Container),
+		Email:          azureCredentials.AccountName,
+		Name:           azureCredentials.Container,
+	}, nil
+}
+
+func (p *AzureBlobProvider) newClient(creds *AzureBlobCredentials) (*container.Client, error) {
+	endpoint := creds.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", creds.AccountName)
+	}
+
+	containerURL := fmt.Sprintf("%s/%s", strings.TrimSuffix(endpoint, "/"), creds.Container)
+
+	if creds.AccountKey != "" {
+		sharedKey, err := container.NewSharedKeyCredential(creds.AccountName, creds.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return container.NewClientWithSharedKeyCredential(containerURL, sharedKey, nil)
+	}
+
+	return container.NewClientWithNoCredential(fmt.Sprintf("%s?%s", containerURL, strings.TrimPrefix(creds.SASToken, "?")), nil)
+}
+
+// Capabilities leaves out Move, blob storage can only copy server side and copies between blobs
+// complete asynchronously.
+func (p *AzureBlobProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Credentials: true,
+		Sync:        true,
+		Upload:      true,
+		Download:    true,
+		Delete:      true,
+	}
+}
+
+func (p *AzureBlobProvider) clientForAccount(ctx context.Context, account Account) (*container.Client, error) {
+	var azureCredentials AzureBlobCredentials
+
+	if err := account.credentials(ctx, &azureCredentials); err != nil {
+		config.LOGGER.Error("could not decrypt credentials", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
+
+	client, err := p.newClient(&azureCredentials)
+	if err != nil {
+		config.LOGGER.Error("failed to create azure blob client", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// SyncFiles lists the whole container, blob storage has no change feed without extra account configuration.
+func (p *AzureBlobProvider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
+
+	client, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	var (
+		items          []Item
+		pending        = []string{""}
+		totalItemCount = 0
+	)
+
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+
+		if err := emit(ctx, SyncPage{Items: items}); err != nil {
+			return err
+		}
+
+		totalItemCount += len(items)
+
+		items = []Item{}
+
+		return nil
+	}
+
+	// every virtual directory is listed separately with "/" as delimiter, its sub directories come back as blob prefixes
+	for len(pending) > 0 {
+		prefix := pending[0]
+		pending = pending[1:]
+
+		pager := client.NewListBlobsHierarchyPager(AZURE_BLOB_DELIMITER, &container.ListBlobsHierarchyOptions{
+			Prefix: &prefix,
+		})
+
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				config.LOGGER.Error("an error occured while listing azure blobs", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.String("prefix", prefix), zap.Error(err))
+				return err
+			}
+
+			if page.Segment == nil {
+				continue
+			}
+
+			for _, blobPrefix := range page.Segment.BlobPrefixes {
+				if blobPrefix.Name == nil {
+					continue
+				}
+
+				pending = append(pending, *blobPrefix.Name)
+
+				items = append(items, p.toFolderItem(*blobPrefix.Name))
+			}
+
+			for _, blobItem := range page.Segment.BlobItems {
+				if blobItem.Name == nil || strings.HasSuffix(*blobItem.Name, AZURE_BLOB_DELIMITER) {
+					continue
+				}
+
+				items = append(items, p.toItem(*blobItem.Name, blobItem.Properties))
+			}
+
+			if len(items) >= AZURE_BLOB_SYNC_BATCH_SIZE {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	config.LOGGER.Info("Azure Blob sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
+
+	return nil
+}
+
+func (p *AzureBlobProvider) toItem(name string, properties *container.BlobProperties) Item {
+	fileName := path.Base(name)
+	ext := filepath.Ext(fileName)
+
+	item := Item{
+		ProviderFileID: name,
+		Name:           fileName,
+		Extension:      ext,
+		MimeType:       mime.TypeByExtension(ext),
+		ParentFolder:   objectParentFolder(name),
+	}
+
+	if properties != nil {
+		if properties.ContentLength != nil {
+			item.Size = *properties.ContentLength
+		}
+		if properties.ContentType != nil && *properties.ContentType != "" {
+			item.MimeType = *properties.ContentType
+		}
+		// Content-MD5 is only set by the service for single shot uploads, block list uploads carry it only when the client sent it
+		if len(properties.ContentMD5) > 0 {
+			item.ContentHash = hex.EncodeToString(properties.ContentMD5)
+		}
+		if properties.CreationTime != nil {
+			item.CreatedTime = *properties.CreationTime
+		}
+		if properties.LastModified != nil {
+			item.ModifiedTime = *properties.LastModified
+		}
+	}
+
+	return item
+}
+
+func (p *AzureBlobProvider) toFolderItem(prefix string) Item {
+	return Item{
+		ProviderFileID: prefix,
+		Name:           path.Base(strings.TrimSuffix(prefix, AZURE_BLOB_DELIMITER)),
+		ParentFolder:   objectParentFolder(prefix),
+		IsFolder:       true,
+	}
+}
+
+func (p *AzureBlobProvider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
+	client, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu    sync.Mutex
+		items []Item
+		g, _  = errgroup.WithContext(ctx)
+		sem   = make(chan struct{}, 10)
+	)
+
+	for _, f := range uploadedFiles {
+		file := f
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			properties, err := p.uploadBlockBlob(ctx, client, file)
+			if err != nil {
+				config.LOGGER.Error("upload failed", zap.String("file", file.FileHeader.Filename), zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.Error(err))
+				return fmt.Errorf("upload failed for file '%s': %v", file.FileHeader.Filename, err)
+			}
+
+			mu.Lock()
+			items = append(items, p.toItem(file.FileHeader.Filename, properties))
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// uploading to an existing blob name replaces the blob, the caller replaces the row for the previous version
+	return items, nil
+}
+
+// uploadBlockBlob stages the file as blocks and commits them. The MD5 is computed up front and sent as the blob's
+// Content-MD5, because the service does not compute one for blobs committed from a block list.
+func (p *AzureBlobProvider) uploadBlockBlob(ctx context.Context, client *container.Client, file middlewares.UploadedFile) (*container.BlobProperties, error) {
+	hash := md5.New()
+
+	if _, err := io.Copy(hash, file.File); err != nil {
+		return nil, err
+	}
+
+	if _, err := file.File.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	contentMD5 := hash.Sum(nil)
+	contentType := file.ContentType
+
+	res, err := client.NewBlockBlobClient(file.FileHeader.Filename).UploadStream(ctx, file.File, &blockblob.UploadStreamOptions{
+		BlockSize:   AZURE_BLOB_UPLOAD_BLOCK,
+		Concurrency: 4,
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: &contentType,
+			BlobContentMD5:  contentMD5,
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	size := file.FileHeader.Size
+
+	return &container.BlobProperties{
+		ContentLength: &size,
+		ContentType:   &contentType,
+		ContentMD5:    contentMD5,
+		LastModified:  res.LastModified,
+	}, nil
+}
+
+func (p *AzureBlobProvider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	client, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.NewBlobClient(item.ProviderFileID).DownloadStream(ctx, nil)
+	if err != nil {
+		config.LOGGER.Error("failed to download azure blob", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.String("blob", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	download := &Download{
+		Body: res.Body,
+		Name: item.Name,
+	}
+
+	if res.ContentType != nil {
+		download.ContentType = *res.ContentType
+	}
+
+	if res.ContentLength != nil {
+		download.Size = *res.ContentLength
+	}
+
+	return download, nil
+}
+
+// DeleteFile deletes a blob, or every blob under the prefix when item is a virtual directory.
+func (p *AzureBlobProvider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	client, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	names := []string{item.ProviderFileID}
+
+	if item.IsFolder {
+		names = nil
+
+		pager := client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &item.ProviderFileID})
+
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				config.LOGGER.Error("an error occured while listing azure blobs", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.String("prefix", item.ProviderFileID), zap.Error(err))
+				return err
+			}
+
+			if page.Segment == nil {
+				continue
+			}
+
+			for _, blobItem := range page.Segment.BlobItems {
+				if blobItem.Name != nil {
+					names = append(names, *blobItem.Name)
+				}
+			}
+		}
+	}
+
+	for _, name := range names {
+		if _, err := client.NewBlobClient(name).Delete(ctx, nil); err != nil {
+			config.LOGGER.Error("failed to delete azure blob", zap.String("provider", AZURE_BLOB_PROVIDER_NAME), zap.String("blob", name), zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+//go:build integration
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// The Azure Blob tests run against the azurite service of docker-compose.dev.yml with its well known development
+// account, e.g.
+//
+//	AZURE_TEST_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1 AZURE_TEST_ACCOUNT_NAME=devstoreaccount1
+//	AZURE_TEST_ACCOUNT_KEY=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==
+
+// newAzureTestContainer creates an empty container that is deleted along with its blobs when the test ends.
+func newAzureTestContainer(t *testing.T) (*container.Client, map[string]any) {
+	t.Helper()
+
+	env := requireEnv(t, "AZURE_TEST_ENDPOINT", "AZURE_TEST_ACCOUNT_NAME", "AZURE_TEST_ACCOUNT_KEY")
+
+	containerName := fmt.Sprintf("cloudmesh-test-%d", time.Now().UnixNano())
+
+	sharedKey, err := container.NewSharedKeyCredential(env[1], env[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := container.NewClientWithSharedKeyCredential(fmt.Sprintf("%s/%s", strings.TrimSuffix(env[0], "/"), containerName), sharedKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Create(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		client.Delete(context.Background(), nil)
+	})
+
+	return client, map[string]any{
+		"account_name": env[1],
+		"account_key":  env[2],
+		"container":    containerName,
+		"endpoint":     env[0],
+	}
+}
+
+func TestAzureBlobLinkWithSharedKey(t *testing.T) {
+	_, body := newAzureTestContainer(t)
+
+	accountInfo, _, err := linkWithCredentials(t, AZURE_BLOB_PROVIDER_NAME, body)
+	if err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	if want := body["account_name"].(string) + "/" + body["container"].(string); accountInfo.ProviderUserID != want {
+		t.Errorf("provider user id = %q, want %q", accountInfo.ProviderUserID, want)
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		wrongKey := map[string]any{}
+		for k, v := range body {
+			wrongKey[k] = v
+		}
+		// a valid base64 key of the right length that azurite does not know
+		wrongKey["account_key"] = strings.Repeat("A", 86) + "=="
+
+		if _, _, err := linkWithCredentials(t, AZURE_BLOB_PROVIDER_NAME, wrongKey); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("err = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("missing container", func(t *testing.T) {
+		missingContainer := map[string]any{}
+		for k, v := range body {
+			missingContainer[k] = v
+		}
+		missingContainer["container"] = body["container"].(string) + "-missing"
+
+		if _, _, err := linkWithCredentials(t, AZURE_BLOB_PROVIDER_NAME, missingContainer); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("err = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("no key or sas token", func(t *testing.T) {
+		noKey := map[string]any{}
+		for k, v := range body {
+			noKey[k] = v
+		}
+		delete(noKey, "account_key")
+
+		if _, _, err := linkWithCredentials(t, AZURE_BLOB_PROVIDER_NAME, noKey); err == nil {
+			t.Error("linking without an account key or sas token succeeded")
+		}
+	})
+}
+
+func TestAzureBlobSyncFiles(t *testing.T) {
+	client, body := newAzureTestContainer(t)
+
+	for name, content := range map[string]string{
+		"root.txt":         "root",
+		"a/b/nested.txt":   "nested",
+		"a/b/c/deeper.txt": "deeper",
+		"other/notes.md":   "notes",
+	} {
+		if _, err := client.NewBlockBlobClient(name).UploadBuffer(context.Background(), []byte(content), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, account, err := linkWithCredentials(t, AZURE_BLOB_PROVIDER_NAME, body)
+	if err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	items := collectSync(t, NewAzureBlobProvider(), account)
+
+	want := map[string]struct {
+		parentFolder string
+		isFolder     bool
+		size         int64
+	}{
+		"root.txt":         {"/", false, 4},
+		"a/":               {"/", true, 0},
+		"a/b/":             {"a/", true, 0},
+		"a/b/nested.txt":   {"a/b/", false, 6},
+		"a/b/c/":           {"a/b/", true, 0},
+		"a/b/c/deeper.txt": {"a/b/c/", false, 6},
+		"other/":           {"/", true, 0},
+		"other/notes.md":   {"other/", false, 5},
+	}
+
+	if len(items) != len(want) {
+		t.Errorf("sync emitted %d items, want %d", len(items), len(want))
+	}
+
+	for id, w := range want {
+		item, ok := items[id]
+		if !ok {
+			t.Errorf("%q was not emitted", id)
+			continue
+		}
+
+		if item.ParentFolder != w.parentFolder || item.IsFolder != w.isFolder || item.Size != w.size {
+			t.Errorf("%q = {parent: %q, folder: %v, size: %d}, want {parent: %q, folder: %v, size: %d}", id, item.ParentFolder, item.IsFolder, item.Size, w.parentFolder, w.isFolder, w.size)
+		}
+
+		if !item.IsFolder && item.ContentHash == "" {
+			t.Errorf("%q has no content hash", id)
+		}
+	}
+}
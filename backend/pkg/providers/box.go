@@ -0,0 +1,989 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/gorilla/sessions"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
+)
+
+type BoxProvider struct {
+	Config oauth2.Config
+}
+
+type BoxAccountInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Login     string `json:"login"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type BoxItem struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	SHA1       string    `json:"sha1"`
+	ItemStatus string    `json:"item_status"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Parent     *struct {
+		ID string `json:"id"`
+	} `json:"parent"`
+}
+
+type BoxFolderItemsResponse struct {
+	Entries    []BoxItem `json:"entries"`
+	NextMarker string    `json:"next_marker"`
+}
+
+// BoxStreamPosition is documented as a string but box returns it as a bare number on some endpoints.
+type BoxStreamPosition string
+
+func (s *BoxStreamPosition) UnmarshalJSON(data []byte) error {
+	*s = BoxStreamPosition(strings.Trim(string(data), "\""))
+	return nil
+}
+
+type BoxEvent struct {
+	EventID   string   `json:"event_id"`
+	EventType string   `json:"event_type"`
+	Source    *BoxItem `json:"source"`
+}
+
+type BoxEventsResponse struct {
+	ChunkSize          int               `json:"chunk_size"`
+	NextStreamPosition BoxStreamPosition `json:"next_stream_position"`
+	Entries            []BoxEvent        `json:"entries"`
+}
+
+type BoxUploadResponse struct {
+	Entries []BoxItem `json:"entries"`
+}
+
+type BoxConflictResponse struct {
+	ContextInfo struct {
+		Conflicts struct {
+			ID string `json:"id"`
+		} `json:"conflicts"`
+	} `json:"context_info"`
+}
+
+type BoxUploadSession struct {
+	ID               string `json:"id"`
+	PartSize         int64  `json:"part_size"`
+	SessionEndpoints struct {
+		UploadPart string `json:"upload_part"`
+		Commit     string `json:"commit"`
+	} `json:"session_endpoints"`
+}
+
+type BoxUploadPart struct {
+	PartID string `json:"part_id"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA1   string `json:"sha1"`
+}
+
+const (
+	BOX_SESSION_NAME       = "cloudmesh-box-oauth-session"
+	BOX_PROVIDER_NAME      = string(repository.ProviderEnumBox)
+	BOX_API_URL            = "https://api.box.com/2.0"
+	BOX_UPLOAD_URL         = "https://upload.box.com/api/2.0"
+	BOX_ACCOUNT_URL        = BOX_API_URL + "/users/me"
+	BOX_EVENTS_URL         = BOX_API_URL + "/events"
+	BOX_ROOT_FOLDER_ID     = "0"
+	BOX_ITEM_FIELDS        = "type,id,name,size,sha1,item_status,created_at,modified_at,parent"
+	BOX_FOLDER_ITEMS_LIMIT = 1000
+	BOX_EVENTS_LIMIT       = 500
+
+	// box rejects direct uploads above 50MB, larger files go through a chunked upload session
+	BOX_SIMPLE_UPLOAD_LIMIT = 50 * 1024 * 1024
+)
+
+func NewBoxProvider() *BoxProvider {
+	return &BoxProvider{
+		Config: oauth2.Config{
+			ClientID:     config.OAuthConfig.BOX.CLIENT_ID,
+			ClientSecret: config.OAuthConfig.BOX.CLIENT_SECRET,
+			Scopes:       strings.Split(config.OAuthConfig.BOX.OAUTH_SCOPES, ","),
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   "https://account.box.com/api/oauth2/authorize",
+				TokenURL:  "https://api.box.com/oauth2/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+			RedirectURL: config.OAuthConfig.BOX.REDIRECT_URI,
+		},
+	}
+}
+
+func (p *BoxProvider) GetConsentPageURL(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore, userID string) (string, error) {
+
+	encodedState, oauthState, err := GenerateOauthState(userID)
+	if err != nil {
+		config.LOGGER.Error("failed to generated encoded oauthstate", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return "", err
+	}
+
+	session, err := store.Get(r, BOX_SESSION_NAME)
+	if err != nil {
+		config.LOGGER.Error("could not get or create session from cookie store", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return "", err
+	}
+
+	// box does not support PKCE, the csrf token in the state is the only binding between consent and callback
+	session.Values["oauth_csrf_token_box"] = oauthState.CsrfToken
+
+	err = session.Save(r, w)
+	if err != nil {
+		config.LOGGER.Error("failed to save session in cookie store", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return "", err
+	}
+
+	url := p.Config.AuthCodeURL(encodedState)
+
+	return url, nil
+}
+
+func (p *BoxProvider) GetToken(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore) (*oauth2.Token, string, *UserAccountInfo, error) {
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return nil, "", nil, ErrNoCode
+	}
+
+	receivedEncodedState := r.URL.Query().Get("state")
+	if receivedEncodedState == "" {
+		return nil, "", nil, ErrNoState
+	}
+
+	receivedOauthState, err := DecodeOauthState(receivedEncodedState)
+	if err != nil {
+		config.LOGGER.Error("failed to decode received state", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, "", nil, fmt.Errorf("failed to decode received state")
+	}
+
+	session, err := store.Get(r, BOX_SESSION_NAME)
+	if err != nil {
+		return nil, "", nil, ErrNoSession
+	}
+
+	storedCsrfToken, ok := session.Values["oauth_csrf_token_box"].(string)
+	if !ok || storedCsrfToken == "" {
+		return nil, "", nil, ErrNoState
+	}
+
+	if receivedOauthState.CsrfToken != storedCsrfToken {
+		return nil, "", nil, ErrInvalidState
+	}
+
+	delete(session.Values, "oauth_csrf_token_box")
+	err = session.Save(r, w)
+	if err != nil {
+		config.LOGGER.Error("failed to cleanup session details", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+	}
+
+	tok, err := p.Config.Exchange(oauthContext(context.Background(), boxHTTPClient), code)
+	if err != nil {
+		config.LOGGER.Error("token exchange failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, "", nil, err
+	}
+
+	accountInfo, err := p.GetAccountInfo(r.Context(), tok)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return tok, receivedOauthState.UserID, accountInfo, nil
+}
+
+func (p *BoxProvider) GetAccountInfo(ctx context.Context, token *oauth2.Token) (*UserAccountInfo, error) {
+
+	res, err := p.boxRequest(ctx, http.MethodGet, BOX_ACCOUNT_URL, token.AccessToken, nil)
+	if err != nil {
+		config.LOGGER.Error("box /users/me request failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		config.LOGGER.Error("failed to read response body for /users/me", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		config.LOGGER.Error("box /users/me request did not return 200", zap.String("provider", BOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+		return nil, fmt.Errorf("%s", string(body[:]))
+	}
+
+	var response BoxAccountInfo
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		config.LOGGER.Error("failed to unmarshal response body for /users/me", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	userInfo := UserAccountInfo{
+		Provider:       BOX_PROVIDER_NAME,
+		ProviderUserID: response.ID,
+		Email:          response.Login,
+		Name:           response.Name,
+		AvatarURL:      response.AvatarURL,
+	}
+
+	return &userInfo, nil
+}
+
+func (p *BoxProvider) Capabilities() Capabilities {
+	return Capabilities{
+		OAuth:           true,
+		Sync:            true,
+		IncrementalSync: true,
+		Upload:          true,
+		Download:        true,
+		Delete:          true,
+		Move:            true,
+	}
+}
+
+// SyncFiles resumes the events stream when cursor holds a stream position from a previous sync and
+// walks the whole tree otherwise.
+func (p *BoxProvider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
+	if cursor != "" {
+		return p.syncEvents(ctx, account, cursor, emit)
+	}
+
+	return p.syncFullTree(ctx, account, emit)
+}
+
+// syncFullTree lists every folder starting at the root. The events stream only reaches back a few weeks, so the
+// first sync walks the tree and records the stream position taken before the walk for later incremental syncs.
+func (p *BoxProvider) syncFullTree(ctx context.Context, account Account, emit SyncFunc) error {
+	totalItemCount := 0
+
+	eventsResponse, err := p.getEvents(ctx, account, "now")
+	if err != nil {
+		config.LOGGER.Error("failed to fetch current box stream position", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return err
+	}
+
+	streamPosition := string(eventsResponse.NextStreamPosition)
+
+	pending := []string{BOX_ROOT_FOLDER_ID}
+
+	for len(pending) > 0 {
+		folderID := pending[0]
+		pending = pending[1:]
+
+		marker := ""
+
+		for {
+			itemsResponse, err := p.getFolderItems(ctx, account, folderID, marker)
+			if err != nil {
+				config.LOGGER.Error("request failed to fetch box folder items", zap.String("provider", BOX_PROVIDER_NAME), zap.String("folder_id", folderID), zap.Error(err))
+				return err
+			}
+
+			var items []Item
+
+			for _, item := range itemsResponse.Entries {
+				if item.Type != "file" && item.Type != "folder" {
+					continue
+				}
+
+				if item.Type == "folder" {
+					pending = append(pending, item.ID)
+				}
+
+				items = append(items, p.toItem(item))
+			}
+
+			if err := emit(ctx, SyncPage{Items: items}); err != nil {
+				return err
+			}
+
+			totalItemCount += len(items)
+
+			if itemsResponse.NextMarker == "" {
+				break
+			}
+
+			marker = itemsResponse.NextMarker
+		}
+	}
+
+	// the stream position is only handed out once the walk is complete, an interrupted walk starts over
+	if err := emit(ctx, SyncPage{Cursor: streamPosition}); err != nil {
+		return err
+	}
+
+	config.LOGGER.Info("Box sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
+
+	return nil
+}
+
+// syncEvents reads the changes stream from the stored position, every page carries the position it ends at.
+func (p *BoxProvider) syncEvents(ctx context.Context, account Account, streamPosition string, emit SyncFunc) error {
+	totalItemCount := 0
+
+	for {
+		eventsResponse, err := p.getEvents(ctx, account, streamPosition)
+		if err != nil {
+			config.LOGGER.Error("request failed to fetch box events", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+			return err
+		}
+
+		var (
+			providerFileIDs []string
+			latest          = make(map[string]*BoxItem)
+		)
+
+		// the stream can contain several events for one item and is not deduplicated, only the last state matters
+		for _, event := range eventsResponse.Entries {
+			if event.Source == nil || (event.Source.Type != "file" && event.Source.Type != "folder") {
+				continue
+			}
+
+			if _, ok := latest[event.Source.ID]; !ok {
+				providerFileIDs = append(providerFileIDs, event.Source.ID)
+			}
+
+			source := *event.Source
+
+			if event.EventType == "ITEM_TRASH" {
+				source.ItemStatus = "trashed"
+			}
+
+			latest[source.ID] = &source
+		}
+
+		nextStreamPosition := string(eventsResponse.NextStreamPosition)
+
+		page := SyncPage{Cursor: nextStreamPosition}
+
+		for _, providerFileID := range providerFileIDs {
+			item := latest[providerFileID]
+
+			if item.ItemStatus != "" && item.ItemStatus != "active" {
+				page.DeletedIDs = append(page.DeletedIDs, item.ID)
+				continue
+			}
+
+			page.Items = append(page.Items, p.toItem(*item))
+		}
+
+		if err := emit(ctx, page); err != nil {
+			return err
+		}
+
+		totalItemCount += len(page.Items)
+
+		if eventsResponse.ChunkSize < BOX_EVENTS_LIMIT || nextStreamPosition == streamPosition {
+			break
+		}
+
+		streamPosition = nextStreamPosition
+	}
+
+	config.LOGGER.Info("Box sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
+
+	return nil
+}
+
+func (p *BoxProvider) toItem(item BoxItem) Item {
+	isFolder := item.Type == "folder"
+
+	ext := ""
+	mimeType := ""
+	webViewLink := fmt.Sprintf("https://app.box.com/folder/%s", item.ID)
+
+	if !isFolder {
+		ext = filepath.Ext(item.Name)
+		mimeType = mime.TypeByExtension(ext)
+		webViewLink = fmt.Sprintf("https://app.box.com/file/%s", item.ID)
+	}
+
+	parentFolder := "/"
+
+	if item.Parent != nil && item.Parent.ID != BOX_ROOT_FOLDER_ID {
+		parentFolder = item.Parent.ID
+	}
+
+	return Item{
+		ProviderFileID: item.ID,
+		Name:           item.Name,
+		Extension:      ext,
+		Size:           item.Size,
+		MimeType:       mimeType,
+		ParentFolder:   parentFolder,
+		IsFolder:       isFolder,
+		ContentHash:    item.SHA1,
+		CreatedTime:    item.CreatedAt,
+		ModifiedTime:   item.ModifiedAt,
+		WebViewLink:    webViewLink,
+	}
+}
+
+func (p *BoxProvider) getFolderItems(ctx context.Context, account Account, folderID, marker string) (*BoxFolderItemsResponse, error) {
+	params := url.Values{}
+	params.Set("fields", BOX_ITEM_FIELDS)
+	params.Set("limit", strconv.Itoa(BOX_FOLDER_ITEMS_LIMIT))
+	params.Set("usemarker", "true")
+
+	if marker != "" {
+		params.Set("marker", marker)
+	}
+
+	reqURL := fmt.Sprintf("%s/folders/%s/items?%s", BOX_API_URL, folderID, params.Encode())
+
+	body, err := p.boxCallWithRenewal(ctx, account, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var itemsResponse BoxFolderItemsResponse
+
+	err = json.Unmarshal(body, &itemsResponse)
+
+	return &itemsResponse, err
+}
+
+func (p *BoxProvider) getEvents(ctx context.Context, account Account, streamPosition string) (*BoxEventsResponse, error) {
+	params := url.Values{}
+	params.Set("stream_type", "changes")
+	params.Set("stream_position", streamPosition)
+	params.Set("limit", strconv.Itoa(BOX_EVENTS_LIMIT))
+
+	body, err := p.boxCallWithRenewal(ctx, account, http.MethodGet, fmt.Sprintf("%s?%s", BOX_EVENTS_URL, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var eventsResponse BoxEventsResponse
+
+	err = json.Unmarshal(body, &eventsResponse)
+
+	return &eventsResponse, err
+}
+
+// boxCallWithRenewal performs a request against the Box API, renewing the access token once if it has expired.
+func (p *BoxProvider) boxCallWithRenewal(ctx context.Context, account Account, method, reqURL string, reqBody []byte) ([]byte, error) {
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", BOX_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if reqBody != nil {
+			body = bytes.NewReader(reqBody)
+		}
+
+		res, err := p.boxRequest(ctx, method, reqURL, accessToken, body)
+		if err != nil {
+			config.LOGGER.Error("http request to box failed", zap.String("provider", BOX_PROVIDER_NAME), zap.String("method", method), zap.Error(err))
+			return nil, err
+		}
+
+		resBody, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			config.LOGGER.Error("failed to read http response body from box", zap.String("provider", BOX_PROVIDER_NAME), zap.String("method", method), zap.Error(err))
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			config.LOGGER.Warn("access token expired, attempting to renew", zap.String("provider", BOX_PROVIDER_NAME), zap.String("account_id", account.ID))
+
+			accessToken, err = account.Tokens.Renew(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			config.LOGGER.Error("http request to box did not return 2xx", zap.String("provider", BOX_PROVIDER_NAME), zap.String("method", method), zap.Int("status_code", res.StatusCode))
+			return nil, fmt.Errorf("%s", string(resBody[:]))
+		}
+
+		return resBody, nil
+	}
+}
+
+func (p *BoxProvider) boxRequest(ctx context.Context, method, reqURL, accessToken string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		config.LOGGER.Error("failed to initiate new HTTP request", zap.String("provider", BOX_PROVIDER_NAME), zap.String("method", method), zap.Error(err))
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return boxHTTPClient.Do(req)
+}
+
+// RefreshToken spends the refresh token. Box refresh tokens are single use, so the returned token
+// always carries a new one that has to replace the stored one.
+func (p *BoxProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	token, err := p.Config.TokenSource(oauthContext(ctx, boxHTTPClient), &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		config.LOGGER.Error("http request for box token renewal failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, refreshTokenError(err)
+	}
+
+	return token, nil
+}
+
+func (p *BoxProvider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", BOX_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []Item
+		g, _    = errgroup.WithContext(ctx)
+		sem     = make(chan struct{}, 10)
+	)
+
+	for _, f := range uploadedFiles {
+		file := f
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			uploadedFile, err := p.uploadToBox(ctx, accessToken, file)
+			if err != nil {
+				config.LOGGER.Error("upload failed", zap.String("file", file.FileHeader.Filename), zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+				return fmt.Errorf("upload failed for file '%s': %v", file.FileHeader.Filename, err)
+			}
+
+			mu.Lock()
+			results = append(results, p.toItem(*uploadedFile))
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// a name clash uploads a new version of the existing file, which keeps its id
+	return results, nil
+}
+
+func (p *BoxProvider) uploadToBox(ctx context.Context, accessToken string, file middlewares.UploadedFile) (*BoxItem, error) {
+	existingFileID, err := p.preflightUpload(ctx, accessToken, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.FileHeader.Size <= BOX_SIMPLE_UPLOAD_LIMIT {
+		return p.simpleUpload(ctx, accessToken, existingFileID, file)
+	}
+
+	return p.chunkedUpload(ctx, accessToken, existingFileID, file)
+}
+
+// preflightUpload asks box whether the upload would be accepted and returns the id of a file with the same name, if any.
+func (p *BoxProvider) preflightUpload(ctx context.Context, accessToken string, file middlewares.UploadedFile) (string, error) {
+	payload, err := json.Marshal(map[string]any{
+		"name":   file.FileHeader.Filename,
+		"size":   file.FileHeader.Size,
+		"parent": map[string]string{"id": BOX_ROOT_FOLDER_ID},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	res, err := p.boxRequest(ctx, http.MethodOptions, BOX_API_URL+"/files/content", accessToken, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return "", nil
+	case http.StatusConflict:
+		var conflict BoxConflictResponse
+
+		if err := json.Unmarshal(body, &conflict); err != nil {
+			return "", err
+		}
+
+		return conflict.ContextInfo.Conflicts.ID, nil
+	default:
+		config.LOGGER.Error("box upload preflight check failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+		return "", fmt.Errorf("%s", string(body[:]))
+	}
+}
+
+func (p *BoxProvider) simpleUpload(ctx context.Context, accessToken, existingFileID string, file middlewares.UploadedFile) (*BoxItem, error) {
+	reqURL := BOX_UPLOAD_URL + "/files/content"
+	if existingFileID != "" {
+		reqURL = fmt.Sprintf("%s/files/%s/content", BOX_UPLOAD_URL, existingFileID)
+	}
+
+	attributes, err := json.Marshal(map[string]any{
+		"name":   file.FileHeader.Filename,
+		"parent": map[string]string{"id": BOX_ROOT_FOLDER_ID},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	// box requires the attributes part to precede the file part
+	go func() {
+		err := writer.WriteField("attributes", string(attributes))
+		if err == nil {
+			var part io.Writer
+			part, err = writer.CreateFormFile("file", file.FileHeader.Filename)
+			if err == nil {
+				_, err = io.Copy(part, file.File)
+			}
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, pr)
+	if err != nil {
+		config.LOGGER.Error("failed to create new request to upload files to box", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	res, err := boxHTTPClient.Do(req)
+	if err != nil {
+		config.LOGGER.Error("http request to upload file to box failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return p.decodeUploadResponse(res, file)
+}
+
+func (p *BoxProvider) chunkedUpload(ctx context.Context, accessToken, existingFileID string, file middlewares.UploadedFile) (*BoxItem, error) {
+	sessionURL := BOX_UPLOAD_URL + "/files/upload_sessions"
+	sessionPayload := map[string]any{
+		"file_name": file.FileHeader.Filename,
+		"file_size": file.FileHeader.Size,
+	}
+
+	if existingFileID != "" {
+		sessionURL = fmt.Sprintf("%s/files/%s/upload_sessions", BOX_UPLOAD_URL, existingFileID)
+	} else {
+		sessionPayload["folder_id"] = BOX_ROOT_FOLDER_ID
+	}
+
+	payload, err := json.Marshal(sessionPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.boxRequest(ctx, http.MethodPost, sessionURL, accessToken, bytes.NewReader(payload))
+	if err != nil {
+		config.LOGGER.Error("http request to create box upload session failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		config.LOGGER.Error("failed to read http response body for box upload session", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusCreated {
+		config.LOGGER.Error("http request to create box upload session did not return 201", zap.String("provider", BOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+		return nil, fmt.Errorf("%s", string(body[:]))
+	}
+
+	var uploadSession BoxUploadSession
+
+	if err := json.Unmarshal(body, &uploadSession); err != nil {
+		config.LOGGER.Error("failed to unmarshal box upload session response", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	var (
+		totalSize = file.FileHeader.Size
+		fileHash  = sha1.New()
+		parts     []BoxUploadPart
+	)
+
+	for offset := int64(0); offset < totalSize; offset += uploadSession.PartSize {
+		partSize := min(uploadSession.PartSize, totalSize-offset)
+
+		chunk := make([]byte, partSize)
+		if _, err := file.File.ReadAt(chunk, offset); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		fileHash.Write(chunk)
+		partHash := sha1.Sum(chunk)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadSession.SessionEndpoints.UploadPart, bytes.NewReader(chunk))
+		if err != nil {
+			config.LOGGER.Error("failed to create new request to upload part to box", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Digest", "sha="+base64.StdEncoding.EncodeToString(partHash[:]))
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+partSize-1, totalSize))
+
+		res, err := boxHTTPClient.Do(req)
+		if err != nil {
+			config.LOGGER.Error("http request to upload part to box failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusOK {
+			config.LOGGER.Error("http request to upload part to box did not return 200", zap.String("provider", BOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+			return nil, fmt.Errorf("upload failed for file '%s' at offset %d", file.FileHeader.Filename, offset)
+		}
+
+		var partResponse struct {
+			Part BoxUploadPart `json:"part"`
+		}
+
+		if err := json.Unmarshal(body, &partResponse); err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, partResponse.Part)
+	}
+
+	commitPayload, err := json.Marshal(map[string]any{"parts": parts})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := "sha=" + base64.StdEncoding.EncodeToString(fileHash.Sum(nil))
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadSession.SessionEndpoints.Commit, bytes.NewReader(commitPayload))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Digest", digest)
+
+		res, err := boxHTTPClient.Do(req)
+		if err != nil {
+			config.LOGGER.Error("http request to commit box upload session failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		// box answers 202 while the parts are still being processed and expects the commit to be retried
+		if res.StatusCode == http.StatusAccepted {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+
+			retryAfter, _ := strconv.Atoi(res.Header.Get("Retry-After"))
+			if retryAfter <= 0 {
+				retryAfter = 1
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(retryAfter) * time.Second):
+			}
+
+			continue
+		}
+
+		defer res.Body.Close()
+
+		return p.decodeUploadResponse(res, file)
+	}
+}
+
+func (p *BoxProvider) decodeUploadResponse(res *http.Response, file middlewares.UploadedFile) (*BoxItem, error) {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		config.LOGGER.Error("failed to read http response body for box file upload", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		config.LOGGER.Error("http request to upload file to box failed with non-2xx status", zap.String("provider", BOX_PROVIDER_NAME), zap.String("file", file.FileHeader.Filename), zap.Int("status_code", res.StatusCode))
+		return nil, fmt.Errorf("http request to upload file to box failed with non-2xx status")
+	}
+
+	var response BoxUploadResponse
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		config.LOGGER.Error("failed to unmarshal json response for box file upload response", zap.Error(err))
+		return nil, err
+	}
+
+	if len(response.Entries) == 0 {
+		return nil, fmt.Errorf("box did not return the uploaded file")
+	}
+
+	return &response.Entries[0], nil
+}
+
+func (p *BoxProvider) itemURL(item Item) string {
+	if item.IsFolder {
+		return fmt.Sprintf("%s/folders/%s", BOX_API_URL, item.ProviderFileID)
+	}
+
+	return fmt.Sprintf("%s/files/%s", BOX_API_URL, item.ProviderFileID)
+}
+
+func (p *BoxProvider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", BOX_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := p.boxRequest(ctx, http.MethodGet, p.itemURL(item)+"/content", accessToken, nil)
+		if err != nil {
+			config.LOGGER.Error("http request to download file from box failed", zap.String("provider", BOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			res.Body.Close()
+
+			accessToken, err = account.Tokens.Renew(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			config.LOGGER.Error("http request to download file from box did not return 200", zap.String("provider", BOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+			return nil, fmt.Errorf("%s", string(body))
+		}
+
+		return &Download{
+			Body:        res.Body,
+			Name:        item.Name,
+			ContentType: mime.TypeByExtension(filepath.Ext(item.Name)),
+			Size:        res.ContentLength,
+		}, nil
+	}
+}
+
+// DeleteFile moves the item to the box trash, folders are trashed together with their contents.
+func (p *BoxProvider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	reqURL := p.itemURL(item)
+
+	if item.IsFolder {
+		reqURL += "?recursive=true"
+	}
+
+	if _, err := p.boxCallWithRenewal(ctx, account, http.MethodDelete, reqURL, nil); err != nil {
+		config.LOGGER.Error("failed to delete box item", zap.String("provider", BOX_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (p *BoxProvider) MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error) {
+	update := map[string]any{}
+
+	if name != "" {
+		update["name"] = name
+	}
+
+	if parentID == "/" {
+		parentID = BOX_ROOT_FOLDER_ID
+	}
+
+	if parentID != "" {
+		update["parent"] = map[string]string{"id": parentID}
+	}
+
+	reqBody, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+
+	reqURL := fmt.Sprintf("%s?fields=%s", p.itemURL(item), BOX_ITEM_FIELDS)
+
+	body, err := p.boxCallWithRenewal(ctx, account, http.MethodPut, reqURL, reqBody)
+	if err != nil {
+		config.LOGGER.Error("failed to move box item", zap.String("provider", BOX_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	var movedItem BoxItem
+
+	if err := json.Unmarshal(body, &movedItem); err != nil {
+		return nil, err
+	}
+
+	moved := p.toItem(movedItem)
+
+	return &moved, nil
+}
@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// boxAccount returns the account a test syncs. The box client is only built when box is configured, the test gets one
+// of its own otherwise.
+func boxAccount(t *testing.T) Account {
+	t.Helper()
+
+	if boxHTTPClient == nil {
+		boxHTTPClient = newProviderClient(BOX_PROVIDER_NAME, "")
+		t.Cleanup(func() {
+			boxHTTPClient = nil
+		})
+	}
+
+	return Account{ID: "account", Tokens: staticTokens{value: "token"}}
+}
+
+func TestBoxSyncFilesFullTreeStreamPosition(t *testing.T) {
+	account := boxAccount(t)
+
+	var calls []string
+
+	serveProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/2.0/events":
+			if r.URL.Query().Get("stream_position") != "now" {
+				http.NotFound(w, r)
+				return
+			}
+
+			// box hands out the position as a bare number too large for a float64
+			io.WriteString(w, `{"chunk_size": 0, "next_stream_position": 1152922976252290886, "entries": []}`)
+		case "/2.0/folders/0/items":
+			io.WriteString(w, `{"entries": [{"type": "folder", "id": "1", "name": "docs", "parent": {"id": "0"}}, {"type": "web_link", "id": "2", "name": "link"}]}`)
+		case "/2.0/folders/1/items":
+			io.WriteString(w, `{"entries": [{"type": "file", "id": "3", "name": "a.txt", "sha1": "da39", "parent": {"id": "1"}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}), boxHTTPClient)
+
+	var pages []SyncPage
+
+	err := NewBoxProvider().SyncFiles(context.Background(), account, "", func(ctx context.Context, page SyncPage) error {
+		pages = append(pages, page)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("SyncFiles failed: %v", err)
+	}
+
+	if len(calls) == 0 || calls[0] != "/2.0/events" {
+		t.Fatalf("the stream position was not taken before the walk: %v", calls)
+	}
+
+	if len(pages) != 3 {
+		t.Fatalf("SyncFiles emitted %d pages, want 3", len(pages))
+	}
+
+	if pages[0].Cursor != "" || pages[1].Cursor != "" {
+		t.Fatalf("folder pages carry a cursor: %q, %q", pages[0].Cursor, pages[1].Cursor)
+	}
+
+	if len(pages[0].Items) != 1 || len(pages[1].Items) != 1 || pages[1].Items[0].ParentFolder != "1" {
+		t.Fatalf("SyncFiles emitted %+v", pages)
+	}
+
+	if last := pages[2]; last.Cursor != "1152922976252290886" || len(last.Items) != 0 {
+		t.Fatalf("last page is %+v, want only the stream position taken before the walk", last)
+	}
+}
+
+func TestBoxSyncFilesEventsStreamPosition(t *testing.T) {
+	account := boxAccount(t)
+
+	// a full chunk moves the stream on, the short chunk after it ends the sync
+	fullChunk := make([]string, 0, BOX_EVENTS_LIMIT)
+	fullChunk = append(fullChunk,
+		`{"event_id": "e1", "event_type": "ITEM_UPLOAD", "source": {"type": "file", "id": "10", "name": "a.txt", "item_status": "active", "parent": {"id": "0"}}}`,
+		`{"event_id": "e2", "event_type": "ITEM_RENAME", "source": {"type": "file", "id": "10", "name": "b.txt", "item_status": "active", "parent": {"id": "0"}}}`,
+		`{"event_id": "e3", "event_type": "ITEM_TRASH", "source": {"type": "file", "id": "11", "name": "c.txt", "item_status": "active", "parent": {"id": "0"}}}`,
+	)
+
+	for len(fullChunk) < BOX_EVENTS_LIMIT {
+		fullChunk = append(fullChunk, `{"event_id": "collab", "event_type": "COLLAB_INVITE_COLLABORATOR", "source": {"type": "collaboration", "id": "99"}}`)
+	}
+
+	serveProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2.0/events" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Query().Get("stream_position") {
+		case "100":
+			fmt.Fprintf(w, `{"chunk_size": %d, "next_stream_position": "200", "entries": [%s]}`, len(fullChunk), strings.Join(fullChunk, ","))
+		case "200":
+			io.WriteString(w, `{"chunk_size": 1, "next_stream_position": 300, "entries": [{"event_id": "e4", "event_type": "ITEM_CREATE", "source": {"type": "folder", "id": "12", "name": "new", "parent": {"id": "0"}}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}), boxHTTPClient)
+
+	var pages []SyncPage
+
+	err := NewBoxProvider().SyncFiles(context.Background(), account, "100", func(ctx context.Context, page SyncPage) error {
+		pages = append(pages, page)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("SyncFiles failed: %v", err)
+	}
+
+	if len(pages) != 2 || pages[0].Cursor != "200" || pages[1].Cursor != "300" {
+		t.Fatalf("SyncFiles emitted %+v, want pages ending at the positions 200 and 300", pages)
+	}
+
+	if first := pages[0]; len(first.Items) != 1 || first.Items[0].Name != "b.txt" || len(first.DeletedIDs) != 1 || first.DeletedIDs[0] != "11" {
+		t.Fatalf("first page is %+v, want the last state of file 10 and file 11 deleted", first)
+	}
+
+	if second := pages[1]; len(second.Items) != 1 || !second.Items[0].IsFolder {
+		t.Fatalf("second page is %+v, want the new folder", second)
+	}
+}
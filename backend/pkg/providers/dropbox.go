@@ -3,29 +3,23 @@ package providers
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
-	"net/url"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/blackmamoth/cloudmesh/pkg/config"
-	"github.com/blackmamoth/cloudmesh/pkg/db"
 	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
-	"github.com/blackmamoth/cloudmesh/pkg/utils"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/gorilla/sessions"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/endpoints"
@@ -71,6 +65,7 @@ type DropboxListFolderEntries struct {
 
 type DropboxUploadResponse struct {
 	ID             string    `json:"id"`
+	Tag            string    `json:".tag"`
 	Name           string    `json:"name"`
 	PathDisplay    string    `json:"path_display"`
 	PathLower      string    `json:"path_lower"`
@@ -87,22 +82,52 @@ type DropboxListFolderResponse struct {
 	HasMore bool                       `json:"has_more"`
 }
 
-type DropboxAuthResponse struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
-	TokenType   string `json:"token_type"`
-	AccountID   string `json:"account_id"`
+type DropboxLongpollResponse struct {
+	Changes bool `json:"changes"`
+	Backoff int  `json:"backoff"`
+}
+
+type DropboxErrorResponse struct {
+	ErrorSummary string `json:"error_summary"`
+}
+
+// dropboxAPIError is a response dropboxRPC did not get a 200 for. ErrorSummary is set when Dropbox described the
+// error, it is the tag path of the error such as "path/not_found/..".
+type dropboxAPIError struct {
+	StatusCode   int
+	ErrorSummary string
+	Body         string
+}
+
+func (e *dropboxAPIError) Error() string {
+	return e.Body
 }
 
 const (
-	DROPBOX_SESSION_NAME    = "cloudmesh-dropbox-oauth-session"
-	DROPBOX_PROVIDER_NAME   = string(repository.ProviderEnumDropbox)
-	DROPBOX_AUTH_URL        = "https://api.dropboxapi.com/oauth2/token"
-	DROPBOX_ACCOUNT_URL     = "https://api.dropboxapi.com/2/users/get_current_account"
-	DROPBOX_LIST_FOLDER_URL = "https://api.dropboxapi.com/2/files/list_folder"
-	DROPBOX_UPLOAD_URL      = "https://content.dropboxapi.com/2/files/upload"
+	DROPBOX_SESSION_NAME     = "cloudmesh-dropbox-oauth-session"
+	DROPBOX_PROVIDER_NAME    = string(repository.ProviderEnumDropbox)
+	DROPBOX_ACCOUNT_URL      = "https://api.dropboxapi.com/2/users/get_current_account"
+	DROPBOX_LIST_FOLDER_URL  = "https://api.dropboxapi.com/2/files/list_folder"
+	DROPBOX_UPLOAD_URL       = "https://content.dropboxapi.com/2/files/upload"
+	DROPBOX_DOWNLOAD_URL     = "https://content.dropboxapi.com/2/files/download"
+	DROPBOX_DELETE_URL       = "https://api.dropboxapi.com/2/files/delete_v2"
+	DROPBOX_MOVE_URL         = "https://api.dropboxapi.com/2/files/move_v2"
+	DROPBOX_GET_METADATA_URL = "https://api.dropboxapi.com/2/files/get_metadata"
+	DROPBOX_LONGPOLL_URL     = "https://notify.dropboxapi.com/2/files/list_folder/longpoll"
+	DROPBOX_REVOKE_URL       = "https://api.dropboxapi.com/2/auth/token/revoke"
 )
 
+// dropboxLongpollClient is shared by every longpoll of the worker, the calls stay open for minutes so each one holds
+// its own connection to notify.dropboxapi.com.
+var dropboxLongpollClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 256,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
 func NewDropboxProvider() *DropboxProvider {
 	return &DropboxProvider{
 		Config: oauth2.Config{
@@ -189,7 +214,7 @@ func (p *DropboxProvider) GetToken(w http.ResponseWriter, r *http.Request, store
 		config.LOGGER.Error("failed to cleanup session details", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
 	}
 
-	tok, err := p.Config.Exchange(context.Background(), code, oauth2.VerifierOption(storedVerifier))
+	tok, err := p.Config.Exchange(oauthContext(context.Background(), dropboxHTTPClient), code, oauth2.VerifierOption(storedVerifier))
 	if err != nil {
 		config.LOGGER.Error("token exchange failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
 		return nil, "", nil, err
@@ -205,8 +230,6 @@ func (p *DropboxProvider) GetToken(w http.ResponseWriter, r *http.Request, store
 
 func (p *DropboxProvider) GetAccountInfo(ctx context.Context, token *oauth2.Token) (*UserAccountInfo, error) {
 
-	httpClient := http.Client{}
-
 	req, err := http.NewRequest(http.MethodPost, DROPBOX_ACCOUNT_URL, nil)
 	if err != nil {
 		config.LOGGER.Error("failed to initiate new HTTP POST request", zap.Error(err))
@@ -215,7 +238,7 @@ func (p *DropboxProvider) GetAccountInfo(ctx context.Context, token *oauth2.Toke
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
 
-	res, err := httpClient.Do(req)
+	res, err := dropboxHTTPClient.Do(req)
 	if err != nil {
 		config.LOGGER.Error("dropbox /get_current_account request failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
 		return nil, err
@@ -249,136 +272,147 @@ func (p *DropboxProvider) GetAccountInfo(ctx context.Context, token *oauth2.Toke
 	return &userInfo, nil
 }
 
-func (p *DropboxProvider) SyncFiles(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, authToken repository.GetAuthTokensRow) error {
-
-	cursor := ""
-
-	totalItemCount := 0
-
-	queries := repository.New(conn)
-
-	var files []repository.AddSyncedItemsParams
-
-	syncDetails, err := queries.GetLatestSyncTimeAndPagetoken(ctx, accountID)
-
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			config.LOGGER.Error("could not fetch timestamp and page token for latest sync", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", accountID.String()))
-			return err
-		}
+func (p *DropboxProvider) Capabilities() Capabilities {
+	return Capabilities{
+		OAuth:           true,
+		Sync:            true,
+		IncrementalSync: true,
+		Upload:          true,
+		Download:        true,
+		Delete:          true,
+		Move:            true,
+		SelectiveSync:   true,
+		Revoke:          true,
+		Longpoll:        true,
 	}
+}
 
-	if syncDetails.LastSyncedAt.Valid && syncDetails.SyncPageToken.Valid {
-		cursor = syncDetails.SyncPageToken.String
-	}
+// SyncFiles lists the account recursively, or the changes since cursor. Entries the sync rules leave out are skipped,
+// during an incremental sync they are reported as deleted so a copy stored before the rules changed or before the entry
+// moved into an excluded folder is removed. A cursor Dropbox reset is reported as ErrCursorReset.
+func (p *DropboxProvider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
 
-	accessToken, err := utils.Decrypt(authToken.AccessToken)
-	if err != nil {
-		config.LOGGER.Error("could not decrypt access token", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", accountID.String()))
-		return err
-	}
+	var (
+		totalItemCount    = 0
+		totalDeletedCount = 0
+		incremental       = cursor != ""
+	)
 
-	refreshToken, err := utils.Decrypt(authToken.RefreshToken)
+	rules, err := p.resolveSyncRules(ctx, account)
 	if err != nil {
-		config.LOGGER.Error("could not decrypt refresh token", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", accountID.String()))
 		return err
 	}
 
 	for {
-		var providerFileIDs []string
-
-		dropboxResponse, err := p.getDropboxFolderList(ctx, accountID, conn, accessToken, refreshToken, cursor)
+		dropboxResponse, err := p.getDropboxFolderList(ctx, account, cursor)
 
 		if err != nil {
 			config.LOGGER.Error("request failed to fetch dropbox folder list", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
 			return err
 		}
 
+		page := SyncPage{Items: make([]Item, 0, len(dropboxResponse.Entries))}
+
 		for _, entry := range dropboxResponse.Entries {
+			if entry.Tag != "deleted" {
+				isFolder := entry.Tag == "folder"
 
-			ext := filepath.Ext(entry.Name)
-
-			mimeType := mime.TypeByExtension(ext)
-
-			parentFolder := path.Dir(entry.PathDisplay)
-
-			files = append(files, repository.AddSyncedItemsParams{
-				AccountID:      accountID,
-				ProviderFileID: entry.ID,
-				Name:           entry.Name,
-				Extension:      ext,
-				Size:           int64(entry.Size),
-				MimeType:       db.PGTextField(mimeType),
-				ParentFolder:   db.PGTextField(parentFolder),
-				IsFolder:       entry.Tag == "folder",
-				ContentHash:    db.PGTextField(entry.ContentHash),
-				CreatedTime:    db.PGTimestamptzField(time.Time{}),
-				ModifiedTime:   db.PGTimestamptzField(entry.ClientModified),
-				ThumbnailLink:  db.PGTextField(""),
-				PreviewLink:    db.PGTextField(""),
-				WebViewLink:    db.PGTextField(""),
-				WebContentLink: db.PGTextField(""),
-				LinkExpiresAt:  db.PGTimestamptzField(time.Time{}),
-			})
+				if rules.AllowsPath(entry.PathLower, isFolder) && rules.AllowsName(entry.Name, isFolder) {
+					page.Items = append(page.Items, p.toItem(entry))
+					continue
+				}
+
+				page.Skipped++
 
-			if syncDetails.LastSyncedAt.Valid {
-				providerFileIDs = append(providerFileIDs, entry.ID)
+				if !incremental {
+					continue
+				}
 			}
+
+			// deleted entries carry no id, only the path. Anything listed earlier in this page under that path is
+			// dropped as well since the page is stored as deletes first and inserts after
+			page.DeletedPaths = append(page.DeletedPaths, entry.PathLower)
+			page.Items = slices.DeleteFunc(page.Items, func(item Item) bool {
+				itemPath := strings.ToLower(path.Join(item.ParentFolder, item.Name))
+				return itemPath == entry.PathLower || strings.HasPrefix(itemPath, entry.PathLower+"/")
+			})
 		}
 
-		var insertedRows int64
+		cursor = dropboxResponse.Cursor
+		page.Cursor = cursor
 
-		err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
-			qx := queries.WithTx(tx)
+		if err := emit(ctx, page); err != nil {
+			return err
+		}
 
-			if len(providerFileIDs) > 0 {
-				err := qx.DeleteConflictingItems(ctx, repository.DeleteConflictingItemsParams{
-					ProviderFileIds: providerFileIDs,
-					AccountID:       accountID,
-				})
+		totalItemCount += len(page.Items)
+		totalDeletedCount += len(page.DeletedPaths)
 
-				if err != nil {
-					config.LOGGER.Error("an error occured while deleting conflicted files", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", accountID.String()), zap.Error(err))
-					return err
-				}
-			}
+		if !dropboxResponse.HasMore {
+			break
+		}
+	}
 
-			insertedRows, err = qx.AddSyncedItems(ctx, files)
+	config.LOGGER.Info("Dropbox sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount), zap.Int("deleted_count", totalDeletedCount))
 
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-			return qx.UpdateLastSyncedTimestamp(ctx, repository.UpdateLastSyncedTimestampParams{
-				AccountID:     accountID,
-				SyncPageToken: db.PGTextField(cursor),
-			})
-		})
+// resolveSyncRules turns the id rules of the account into the paths the folders currently live at. Folders that no
+// longer exist are left out.
+func (p *DropboxProvider) resolveSyncRules(ctx context.Context, account Account) (*SyncRules, error) {
+	includeIDs, excludeIDs := account.Rules.IDs()
+	if len(includeIDs) == 0 && len(excludeIDs) == 0 {
+		return account.Rules, nil
+	}
+
+	paths := make(map[string]string, len(includeIDs)+len(excludeIDs))
 
+	for _, id := range slices.Concat(includeIDs, excludeIDs) {
+		reqBody, err := json.Marshal(map[string]string{"path": id})
 		if err != nil {
-			config.LOGGER.Error("failed to insert synced files", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
-			return err
+			return nil, err
 		}
 
-		config.LOGGER.Info("batch inserted", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", accountID.String()), zap.Int64("item_count", insertedRows))
-
-		totalItemCount += int(insertedRows)
+		body, err := p.dropboxRPC(ctx, account, DROPBOX_GET_METADATA_URL, reqBody)
+		if err != nil {
+			var apiErr *dropboxAPIError
+			if errors.As(err, &apiErr) && strings.HasPrefix(apiErr.ErrorSummary, "path/not_found") {
+				continue
+			}
 
-		cursor = dropboxResponse.Cursor
+			config.LOGGER.Error("could not resolve dropbox sync rule", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", account.ID), zap.String("id", id), zap.Error(err))
+			return nil, err
+		}
 
-		if !dropboxResponse.HasMore {
-			break
+		var entry DropboxListFolderEntries
+		if err := json.Unmarshal(body, &entry); err != nil {
+			return nil, err
 		}
 
-		files = []repository.AddSyncedItemsParams{}
+		paths[id] = entry.PathLower
 	}
 
-	config.LOGGER.Info("Dropbox sync successful", zap.Int("item_count", totalItemCount))
+	return account.Rules.WithResolvedIDs(paths), nil
+}
 
-	return nil
+func (p *DropboxProvider) toItem(entry DropboxListFolderEntries) Item {
+	ext := filepath.Ext(entry.Name)
+
+	return Item{
+		ProviderFileID: entry.ID,
+		Name:           entry.Name,
+		Extension:      ext,
+		Size:           int64(entry.Size),
+		MimeType:       mime.TypeByExtension(ext),
+		ParentFolder:   path.Dir(entry.PathDisplay),
+		IsFolder:       entry.Tag == "folder",
+		ContentHash:    entry.ContentHash,
+		ModifiedTime:   entry.ClientModified,
+	}
 }
 
-func (p *DropboxProvider) getDropboxFolderList(ctx context.Context, accountID pgtype.UUID, conn *pgxpool.Conn, accessToken, refreshToken, cursor string) (*DropboxListFolderResponse, error) {
+func (p *DropboxProvider) getDropboxFolderList(ctx context.Context, account Account, cursor string) (*DropboxListFolderResponse, error) {
 	dropboxApiURL := DROPBOX_LIST_FOLDER_URL
 	reqBody := []byte(`{"path": "", "recursive": true}`)
 
@@ -387,123 +421,144 @@ func (p *DropboxProvider) getDropboxFolderList(ctx context.Context, accountID pg
 		reqBody = fmt.Appendf(nil, "{\"cursor\": \"%s\"}", cursor)
 	}
 
-	httpClient := http.Client{}
+	body, err := p.dropboxRPC(ctx, account, dropboxApiURL, reqBody)
+	if err != nil {
+		var apiErr *dropboxAPIError
+		if cursor != "" && errors.As(err, &apiErr) && strings.HasPrefix(apiErr.ErrorSummary, "reset") {
+			return nil, ErrCursorReset
+		}
+
+		return nil, err
+	}
+
+	var dropboxResponse DropboxListFolderResponse
+
+	err = json.Unmarshal(body, &dropboxResponse)
+
+	return &dropboxResponse, err
+}
+
+// Longpoll blocks until something below the cursor changed or timeout seconds passed. The call needs no access token,
+// the cursor identifies the account. Dropbox adds up to 90 seconds of jitter to the timeout.
+func (p *DropboxProvider) Longpoll(ctx context.Context, cursor string, timeout int) (*LongpollResult, error) {
+	reqBody, err := json.Marshal(map[string]any{"cursor": cursor, "timeout": timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout+120)*time.Second)
+	defer cancel()
 
-	req, err := http.NewRequest(http.MethodPost, dropboxApiURL, bytes.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, DROPBOX_LONGPOLL_URL, bytes.NewReader(reqBody))
 	if err != nil {
-		config.LOGGER.Error("an error occured while generating http request for dropbox sync task", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Set("Content-Type", "application/json")
 
-	res, err := httpClient.Do(req)
+	res, err := dropboxLongpollClient.Do(req)
 	if err != nil {
-		config.LOGGER.Error("http request for dropbox sync task failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		config.LOGGER.Error("failed to read http response body for dropbox sync task", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
 		return nil, err
 	}
 
-	if res.StatusCode == http.StatusUnauthorized {
-		config.LOGGER.Warn("access token expired, attempting to renew", zap.String("provider", DROPBOX_PROVIDER_NAME))
-
-		_, _, err := p.RenewOAuthTokens(ctx, conn, accountID, refreshToken)
-		if err != nil {
-			return nil, err
+	if res.StatusCode == http.StatusConflict {
+		var dropboxError DropboxErrorResponse
+		if json.Unmarshal(body, &dropboxError) == nil && strings.HasPrefix(dropboxError.ErrorSummary, "reset") {
+			return nil, ErrCursorReset
 		}
-
-		return nil, fmt.Errorf("request has failed with status 401, failing task for it to fetch new token from db instead of using the stale token in next request")
 	}
 
 	if res.StatusCode != http.StatusOK {
-		config.LOGGER.Error("http request for dropbox sync task did not return 200", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
-		return nil, fmt.Errorf("%s", string(body[:]))
+		return nil, fmt.Errorf("dropbox longpoll returned status %d: %s", res.StatusCode, body)
 	}
 
-	var dropboxResponse DropboxListFolderResponse
-
-	err = json.Unmarshal(body, &dropboxResponse)
+	var longpollResponse DropboxLongpollResponse
+	if err := json.Unmarshal(body, &longpollResponse); err != nil {
+		return nil, err
+	}
 
-	return &dropboxResponse, err
+	return &LongpollResult{Changes: longpollResponse.Changes, Backoff: longpollResponse.Backoff}, nil
 }
 
-func (p *DropboxProvider) RenewOAuthTokens(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, refreshToken string) (string, int64, error) {
-	data := url.Values{}
-
-	data.Add("grant_type", "refresh_token")
-	data.Add("refresh_token", refreshToken)
-	data.Add("client_id", p.Config.ClientID)
-	data.Add("client_secret", p.Config.ClientSecret)
-
-	res, err := http.Post(DROPBOX_AUTH_URL, "application/x-www-form-urlencoded", bytes.NewBufferString(data.Encode()))
+// dropboxRPC calls an RPC style endpoint, renewing the access token and retrying once when Dropbox
+// rejects it.
+func (p *DropboxProvider) dropboxRPC(ctx context.Context, account Account, apiURL string, reqBody []byte) ([]byte, error) {
+	accessToken, err := account.Tokens.AccessToken(ctx)
 	if err != nil {
-		config.LOGGER.Error("http request for dropbox token renewal failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
-		return "", 0, err
+		config.LOGGER.Error("could not get access token", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		config.LOGGER.Error("failed to read http response body for dropbox token renewal", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
-		return "", 0, err
-	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(reqBody))
+		if err != nil {
+			config.LOGGER.Error("an error occured while generating http request for dropbox", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
 
-	var dropboxResponse DropboxAuthResponse
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set("Content-Type", "application/json")
 
-	err = json.Unmarshal(body, &dropboxResponse)
+		res, err := dropboxHTTPClient.Do(req)
+		if err != nil {
+			config.LOGGER.Error("http request to dropbox failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("url", apiURL), zap.Error(err))
+			return nil, err
+		}
 
-	if err != nil {
-		config.LOGGER.Error("failed to unmarshal dropbox token renew response", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
-		return "", 0, err
-	}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			config.LOGGER.Error("failed to read http response body from dropbox", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("url", apiURL), zap.Error(err))
+			return nil, err
+		}
 
-	expiresIn := time.Now().Add(time.Duration(dropboxResponse.ExpiresIn) * time.Second)
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			config.LOGGER.Warn("access token expired, attempting to renew", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", account.ID))
 
-	err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+			accessToken, err = account.Tokens.Renew(ctx)
+			if err != nil {
+				return nil, err
+			}
 
-		encryptedAccessToken, err := utils.Encrypt(dropboxResponse.AccessToken)
-		if err != nil {
-			config.LOGGER.Error("failed to encrypt new access token", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
-			return err
+			continue
 		}
 
-		qx := repository.New(conn).WithTx(tx)
+		if res.StatusCode != http.StatusOK {
+			config.LOGGER.Error("http request to dropbox did not return 200", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("url", apiURL), zap.Int("status_code", res.StatusCode))
+			apiErr := &dropboxAPIError{StatusCode: res.StatusCode, Body: string(body)}
 
-		err = qx.UpdateRenewedAuthToken(ctx, repository.UpdateRenewedAuthTokenParams{
-			AccountID:   accountID,
-			AccessToken: encryptedAccessToken,
-			TokenType:   db.PGTextField(dropboxResponse.TokenType),
-			Expiry:      db.PGTimestamptzField(expiresIn),
-		})
+			var dropboxError DropboxErrorResponse
+			if json.Unmarshal(body, &dropboxError) == nil {
+				apiErr.ErrorSummary = dropboxError.ErrorSummary
+			}
 
-		return err
-	})
+			return nil, apiErr
+		}
 
-	if err != nil {
-		config.LOGGER.Error("failed to update dropbox oauth tokens in db", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
-		return "", 0, err
+		return body, nil
 	}
-
-	return dropboxResponse.AccessToken, int64(dropboxResponse.ExpiresIn), nil
 }
 
-func (p *DropboxProvider) UploadFiles(ctx context.Context, accountID *pgtype.UUID, conn *pgxpool.Conn, queries *repository.Queries, authTokens repository.GetAuthTokensRow, uploadedFiles []middlewares.UploadedFile) error {
-	accessToken, err := utils.Decrypt(authTokens.AccessToken)
+func (p *DropboxProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	token, err := p.Config.TokenSource(oauthContext(ctx, dropboxHTTPClient), &oauth2.Token{RefreshToken: refreshToken}).Token()
 	if err != nil {
-		config.LOGGER.Error("failed to decrypt access token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-		return err
+		config.LOGGER.Error("http request for dropbox token renewal failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+		return nil, refreshTokenError(err)
 	}
 
+	return token, nil
+}
+
+func (p *DropboxProvider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
 	var (
 		mu      sync.Mutex
-		results []*DropboxUploadResponse
+		results []Item
 		g, _    = errgroup.WithContext(ctx)
 		sem     = make(chan struct{}, 10)
 	)
@@ -514,13 +569,13 @@ func (p *DropboxProvider) UploadFiles(ctx context.Context, accountID *pgtype.UUI
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			uploadedFile, err := p.uploadToDropbox(accessToken, file)
+			uploadedFile, err := p.uploadToDropbox(ctx, account, file)
 			if err != nil {
 				return err
 			}
 
 			mu.Lock()
-			results = append(results, uploadedFile)
+			results = append(results, p.toItem(DropboxListFolderEntries(*uploadedFile)))
 			mu.Unlock()
 
 			return nil
@@ -528,116 +583,232 @@ func (p *DropboxProvider) UploadFiles(ctx context.Context, accountID *pgtype.UUI
 	}
 
 	if err := g.Wait(); err != nil {
-		return err
+		return nil, err
 	}
 
-	var files []repository.AddSyncedItemsParams
+	return results, nil
+}
 
-	for _, r := range results {
+func (p *DropboxProvider) uploadToDropbox(ctx context.Context, account Account, file middlewares.UploadedFile) (*DropboxUploadResponse, error) {
+	dropboxArgs := map[string]any{
+		"path":            fmt.Sprintf("/%s", file.FileHeader.Filename),
+		"mode":            "add",
+		"autorename":      false,
+		"mute":            false,
+		"strict_conflict": false,
+	}
 
-		ext := filepath.Ext(r.Name)
+	argJSON, err := json.Marshal(dropboxArgs)
 
-		mimeType := mime.TypeByExtension(ext)
+	if err != nil {
+		config.LOGGER.Error("failed to marshal dropbox args", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
 
-		parentFolder := path.Dir(r.PathDisplay)
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
 
-		files = append(files, repository.AddSyncedItemsParams{
-			AccountID:      *accountID,
-			ProviderFileID: r.ID,
-			Name:           r.Name,
-			Extension:      ext,
-			Size:           int64(r.Size),
-			MimeType:       db.PGTextField(mimeType),
-			ParentFolder:   db.PGTextField(parentFolder),
-			IsFolder:       false,
-			ContentHash:    db.PGTextField(r.ContentHash),
-			CreatedTime:    db.PGTimestamptzField(time.Time{}),
-			ModifiedTime:   db.PGTimestamptzField(r.ClientModified),
-			ThumbnailLink:  db.PGTextField(""),
-			PreviewLink:    db.PGTextField(""),
-			WebViewLink:    db.PGTextField(""),
-			WebContentLink: db.PGTextField(""),
-			LinkExpiresAt:  db.PGTimestamptzField(time.Time{}),
-		})
+	for attempt := 0; ; attempt++ {
+		if _, err := file.File.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, DROPBOX_UPLOAD_URL, file.File)
+		if err != nil {
+			config.LOGGER.Error("failed to create new request to upload files to dropbox", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set("Dropbox-API-Arg", string(argJSON))
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		res, err := dropboxHTTPClient.Do(req)
+		if err != nil {
+			config.LOGGER.Error("http request to upload file to dropbox failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			config.LOGGER.Error("failed to read http response body for dropbox file upload", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			accessToken, err = account.Tokens.Renew(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			config.LOGGER.Error("http request to upload file to dropbox failed with non-200 status", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+			return nil, fmt.Errorf("http request to upload file to dropbox failed with non-200 status")
+		}
+
+		var response DropboxUploadResponse
+
+		err = json.Unmarshal(body, &response)
+
+		if err != nil {
+			config.LOGGER.Error("failed to unmarshal json response for dropbox file upload response", zap.Error(err))
+			return nil, err
+		}
+
+		response.Tag = "file"
+
+		return &response, nil
 	}
+}
 
-	err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
-		qx := queries.WithTx(tx)
+// DownloadFile streams a file from the content endpoint. Dropbox accepts "id:..." identifiers
+// anywhere a path is expected, so the stored provider file id is enough.
+func (p *DropboxProvider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	argJSON, err := json.Marshal(map[string]string{"path": item.ProviderFileID})
+	if err != nil {
+		return nil, err
+	}
 
-		insertedRows, err := qx.AddSyncedItems(ctx, files)
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
 
-		config.LOGGER.Info("insert new files", zap.Int64("item_count", insertedRows))
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, DROPBOX_DOWNLOAD_URL, nil)
+		if err != nil {
+			return nil, err
+		}
 
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set("Dropbox-API-Arg", string(argJSON))
+
+		res, err := dropboxHTTPClient.Do(req)
 		if err != nil {
-			return err
+			config.LOGGER.Error("http request to download file from dropbox failed", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+			return nil, err
 		}
 
-		return nil
-	})
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			res.Body.Close()
+
+			accessToken, err = account.Tokens.Renew(ctx)
+			if err != nil {
+				return nil, err
+			}
 
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			config.LOGGER.Error("http request to download file from dropbox did not return 200", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+			return nil, fmt.Errorf("%s", string(body))
+		}
+
+		return &Download{
+			Body:        res.Body,
+			Name:        item.Name,
+			ContentType: mime.TypeByExtension(filepath.Ext(item.Name)),
+			Size:        res.ContentLength,
+		}, nil
+	}
+}
+
+func (p *DropboxProvider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	reqBody, err := json.Marshal(map[string]string{"path": item.ProviderFileID})
 	if err != nil {
-		config.LOGGER.Error("failed to insert newly uploaded files", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+		return err
+	}
+
+	if _, err := p.dropboxRPC(ctx, account, DROPBOX_DELETE_URL, reqBody); err != nil {
+		config.LOGGER.Error("failed to delete dropbox file", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
 		return err
 	}
 
 	return nil
 }
 
-func (p *DropboxProvider) uploadToDropbox(accesstoken string, file middlewares.UploadedFile) (*DropboxUploadResponse, error) {
-	dropboxArgs := map[string]any{
-		"path":            fmt.Sprintf("/%s", file.FileHeader.Filename),
-		"mode":            "add",
-		"autorename":      false,
-		"mute":            false,
-		"strict_conflict": false,
-	}
+// MoveFile uses move_v2, which needs a destination path. When the item changes folders the path of
+// the new parent is looked up from its id first.
+func (p *DropboxProvider) MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error) {
+	parentPath := item.ParentFolder
 
-	argJSON, err := json.Marshal(dropboxArgs)
+	if parentID == "/" {
+		parentPath = "/"
+	} else if parentID != "" {
+		reqBody, err := json.Marshal(map[string]string{"path": parentID})
+		if err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		config.LOGGER.Error("failed to marshal dropbox args", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
-		return nil, err
+		body, err := p.dropboxRPC(ctx, account, DROPBOX_GET_METADATA_URL, reqBody)
+		if err != nil {
+			return nil, err
+		}
+
+		var parent DropboxListFolderEntries
+		if err := json.Unmarshal(body, &parent); err != nil {
+			return nil, err
+		}
+
+		parentPath = parent.PathDisplay
 	}
 
-	httpClient := http.Client{}
+	if name == "" {
+		name = item.Name
+	}
 
-	req, err := http.NewRequest("POST", DROPBOX_UPLOAD_URL, file.File)
+	reqBody, err := json.Marshal(map[string]any{
+		"from_path":  item.ProviderFileID,
+		"to_path":    path.Join("/", parentPath, name),
+		"autorename": false,
+	})
 	if err != nil {
-		config.LOGGER.Error("failed to create new request to upload files to dropbox", zap.String("provider", DROPBOX_UPLOAD_URL), zap.Error(err))
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accesstoken))
-	req.Header.Set("Dropbox-API-Arg", string(argJSON))
-	req.Header.Set("Content-Type", "application/octet-stream")
-
-	res, err := httpClient.Do(req)
+	body, err := p.dropboxRPC(ctx, account, DROPBOX_MOVE_URL, reqBody)
 	if err != nil {
-		config.LOGGER.Error("http request to upload file to dropbox failed", zap.String("provider", DROPBOX_UPLOAD_URL), zap.Error(err))
+		config.LOGGER.Error("failed to move dropbox file", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
 		return nil, err
 	}
 
-	defer res.Body.Close()
+	var response struct {
+		Metadata DropboxListFolderEntries `json:"metadata"`
+	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		config.LOGGER.Error("failed to read http response body for dropbox file upload", zap.String("provider", DROPBOX_PROVIDER_NAME), zap.Error(err))
+	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, err
 	}
 
-	if res.StatusCode != http.StatusOK {
-		config.LOGGER.Error("http request to upload file to dropbox failed with non-200 status", zap.String("provider", DROPBOX_UPLOAD_URL), zap.Int("status_code", res.StatusCode))
-		return nil, fmt.Errorf("http request to upload file to dropbox failed with non-200 status")
+	if response.Metadata.Tag == "" && item.IsFolder {
+		response.Metadata.Tag = "folder"
 	}
 
-	var response DropboxUploadResponse
+	movedItem := p.toItem(response.Metadata)
 
-	err = json.Unmarshal(body, &response)
+	return &movedItem, nil
+}
 
-	if err != nil {
-		config.LOGGER.Error("failed to unmarshal json response for dropbox file upload response", zap.Error(err))
-		return nil, err
+// RevokeToken disables the access token of the account, Dropbox revokes the refresh token it was issued with as well.
+func (p *DropboxProvider) RevokeToken(ctx context.Context, account Account) error {
+	_, err := p.dropboxRPC(ctx, account, DROPBOX_REVOKE_URL, []byte("null"))
+
+	// dropboxRPC renews a rejected token once, one still rejected after that belongs to a grant that is gone
+	var apiErr *dropboxAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %v", ErrInvalidGrant, err)
 	}
 
-	return &response, nil
+	return err
 }
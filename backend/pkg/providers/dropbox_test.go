@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestDropboxSyncFilesCursorReset(t *testing.T) {
+	var calls []string
+
+	serveProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/2/files/list_folder/continue":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"error_summary": "reset/..", "error": {".tag": "reset"}}`)
+		case "/2/files/list_folder":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(DropboxListFolderResponse{
+				Entries: []DropboxListFolderEntries{{ID: "id:a", Tag: "file", Name: "a.txt", PathDisplay: "/a.txt", PathLower: "/a.txt"}},
+				Cursor:  "fresh-cursor",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}), dropboxHTTPClient)
+
+	p := NewDropboxProvider()
+	account := Account{ID: "account", Tokens: staticTokens{value: "token"}}
+
+	var pages []SyncPage
+	emit := func(ctx context.Context, page SyncPage) error {
+		pages = append(pages, page)
+		return nil
+	}
+
+	err := p.SyncFiles(context.Background(), account, "stale-cursor", emit)
+	if !errors.Is(err, ErrCursorReset) {
+		t.Fatalf("SyncFiles with a reset cursor returned %v, want ErrCursorReset", err)
+	}
+
+	if len(pages) != 0 {
+		t.Fatalf("SyncFiles emitted %d pages for a reset cursor", len(pages))
+	}
+
+	// the full listing the sync starts over with does not send the cursor again
+	if err := p.SyncFiles(context.Background(), account, "", emit); err != nil {
+		t.Fatalf("full SyncFiles failed: %v", err)
+	}
+
+	if len(pages) != 1 || pages[0].Cursor != "fresh-cursor" || len(pages[0].Items) != 1 {
+		t.Fatalf("full SyncFiles emitted %+v", pages)
+	}
+
+	want := []string{"/2/files/list_folder/continue", "/2/files/list_folder"}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Fatalf("requests were %v, want %v", calls, want)
+	}
+}
+
+func TestDropboxLongpoll(t *testing.T) {
+	serveProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			Cursor string `json:"cursor"`
+		}
+
+		if r.URL.Path != "/2/files/list_folder/longpoll" || json.NewDecoder(r.Body).Decode(&reqBody) != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if reqBody.Cursor == "stale-cursor" {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"error_summary": "reset/...", "error": {".tag": "reset"}}`)
+			return
+		}
+
+		io.WriteString(w, `{"changes": true, "backoff": 60}`)
+	}), dropboxLongpollClient)
+
+	p := NewDropboxProvider()
+
+	if _, err := p.Longpoll(context.Background(), "stale-cursor", 30); !errors.Is(err, ErrCursorReset) {
+		t.Fatalf("Longpoll with a reset cursor returned %v, want ErrCursorReset", err)
+	}
+
+	result, err := p.Longpoll(context.Background(), "cursor", 30)
+	if err != nil {
+		t.Fatalf("Longpoll failed: %v", err)
+	}
+
+	if !result.Changes || result.Backoff != 60 {
+		t.Fatalf("Longpoll returned %+v, want changes with a backoff of 60", result)
+	}
+}
@@ -2,25 +2,21 @@ package providers
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/blackmamoth/cloudmesh/pkg/config"
-	"github.com/blackmamoth/cloudmesh/pkg/db"
 	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
-	"github.com/blackmamoth/cloudmesh/pkg/utils"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/gorilla/sessions"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/endpoints"
@@ -36,18 +32,23 @@ type GoogleProvider struct {
 }
 
 const (
-	GOOGLE_SESSION_NAME  = "cloudmesh-google-oauth-session"
-	GOOGLE_PROVIDER_NAME = string(repository.ProviderEnumGoogle)
-	GOOGLE_AUTH_URL      = "https://oauth2.googleapis.com/token"
+	GOOGLE_SESSION_NAME              = "cloudmesh-google-oauth-session"
+	GOOGLE_PROVIDER_NAME             = string(repository.ProviderEnumGoogle)
+	GOOGLE_FOLDER_MIME_TYPE          = "application/vnd.google-apps.folder"
+	GOOGLE_APPS_MIME_TYPE_PREFIX     = "application/vnd.google-apps."
+	GOOGLE_LISTING_CHECKPOINT_PREFIX = "files:"
+	GOOGLE_FILE_FIELDS               = "id, name, size, mimeType, createdTime, modifiedTime, thumbnailLink, fullFileExtension, parents, webViewLink, webContentLink, iconLink, sha256Checksum, trashed, shared, ownedByMe, sharedWithMeTime, driveId, owners(emailAddress)"
+	// GOOGLE_SHARED_WITH_ME_ID is the virtual root folder files shared with the account without a visible parent
+	// are synced into, shared drives are synced as virtual folders under their drive id
+	GOOGLE_SHARED_WITH_ME_ID   = "shared-with-me"
+	GOOGLE_SHARED_WITH_ME_NAME = "Shared with me"
+	// GOOGLE_CHANNEL_TTL is the lifetime requested for change channels, Drive may hand out a shorter one
+	GOOGLE_CHANNEL_TTL = 24 * time.Hour
+	// GOOGLE_PARENTS_PER_QUERY bounds the parents a single files.list query asks for while expanding folder rules
+	GOOGLE_PARENTS_PER_QUERY = 50
+	GOOGLE_REVOKE_URL        = "https://oauth2.googleapis.com/revoke"
 )
 
-type GoogleAuthResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int64  `json:"expires_in"`
-	IDToken     string `json:"id_token"`
-}
-
 func NewGoogleProvider() *GoogleProvider {
 	return &GoogleProvider{
 		Config: oauth2.Config{
@@ -134,7 +135,7 @@ func (p *GoogleProvider) GetToken(w http.ResponseWriter, r *http.Request, store
 		config.LOGGER.Error("failed to cleanup session details", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
 	}
 
-	tok, err := p.Config.Exchange(context.Background(), code, oauth2.VerifierOption(storedVerifier))
+	tok, err := p.Config.Exchange(oauthContext(context.Background(), googleHTTPClient), code, oauth2.VerifierOption(storedVerifier))
 	if err != nil {
 		config.LOGGER.Error("token exchange failed", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
 		return nil, "", nil, err
@@ -149,7 +150,7 @@ func (p *GoogleProvider) GetToken(w http.ResponseWriter, r *http.Request, store
 }
 
 func (p *GoogleProvider) GetAccountInfo(ctx context.Context, token *oauth2.Token) (*UserAccountInfo, error) {
-	httpClient := p.getHTTPClient(token.AccessToken, token.RefreshToken)
+	httpClient := p.getHTTPClient(ctx, token.AccessToken)
 	svc, err := oauth2Google.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		config.LOGGER.Error("failed to create oauth2 service", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
@@ -173,274 +174,797 @@ func (p *GoogleProvider) GetAccountInfo(ctx context.Context, token *oauth2.Token
 	return &userAccountInfo, nil
 }
 
-func (p *GoogleProvider) SyncFiles(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, authToken repository.GetAuthTokensRow) error {
+func (p *GoogleProvider) Capabilities() Capabilities {
+	return Capabilities{
+		OAuth:           true,
+		Sync:            true,
+		IncrementalSync: true,
+		Upload:          true,
+		Download:        true,
+		Delete:          true,
+		Move:            true,
+		SelectiveSync:   true,
+		Revoke:          true,
+		Watch:           true,
+	}
+}
 
-	accessToken, err := utils.Decrypt(authToken.AccessToken)
+// SyncFiles reads the drive changes feed, cursor holds the changes page token returned by the previous sync. Without
+// a cursor every file not in the trash is listed and the final page carries the start page token fetched before the
+// listing began, so nothing that changes while listing is missed.
+//
+// Both cover shared drives and files shared with the account. Shared drives show up as folders at the root, files
+// shared without a visible parent are put into the shared with me folder.
+//
+// Folder rules are resolved to folder ids before anything is listed. Items the rules leave out are skipped, the
+// changes feed reports them as removed so copies stored before the rules changed go away.
+func (p *GoogleProvider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
+	// cursors written before the changes feed was used hold the time of the previous sync
+	if _, err := time.Parse(time.RFC3339, cursor); err == nil {
+		cursor = ""
+	}
+
+	rootID, err := p.getRootID(ctx, account)
 	if err != nil {
-		config.LOGGER.Error("could not decrypt access token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", accountID.String()))
 		return err
 	}
 
-	refreshToken, err := utils.Decrypt(authToken.RefreshToken)
+	scope, err := p.resolveSyncScope(ctx, account, rootID)
 	if err != nil {
-		config.LOGGER.Error("could not decrypt refresh token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", accountID.String()))
 		return err
 	}
 
-	httpClient := p.getHTTPClient(accessToken, refreshToken)
+	if cursor == "" {
+		return p.listFiles(ctx, account, rootID, scope, "", "", emit)
+	}
 
-	driveService, err := drive.NewService(ctx, option.WithHTTPClient(httpClient))
-	if err != nil {
-		config.LOGGER.Error("an error occured while initializing google drive service", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+	// checkpoints of a full listing carry the start page token and the files page token to continue from
+	if checkpoint, ok := strings.CutPrefix(cursor, GOOGLE_LISTING_CHECKPOINT_PREFIX); ok {
+		startPageToken, pageToken, _ := strings.Cut(checkpoint, ":")
+		return p.listFiles(ctx, account, rootID, scope, startPageToken, pageToken, emit)
+	}
+
+	return p.listChanges(ctx, account, rootID, scope, cursor, emit)
+}
+
+// getRootID returns the id of the My Drive folder, files directly in it list that id as their parent.
+func (p *GoogleProvider) getRootID(ctx context.Context, account Account) (string, error) {
+	var root *drive.File
+
+	err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+		var err error
+		root, err = service.Files.Get("root").Fields("id").Context(ctx).Do()
 		return err
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to fetch google drive root folder", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+		return "", err
 	}
 
-	pageToken := ""
+	return root.Id, nil
+}
 
-	query := ""
+func (p *GoogleProvider) listFiles(ctx context.Context, account Account, rootID string, scope *googleSyncScope, startPageToken, pageToken string, emit SyncFunc) error {
+	if startPageToken == "" {
+		err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+			token, err := service.Changes.GetStartPageToken().SupportsAllDrives(true).Context(ctx).Do()
+			if err != nil {
+				return err
+			}
 
-	queries := repository.New(conn)
+			startPageToken = token.StartPageToken
 
-	syncDetails, err := queries.GetLatestSyncTimeAndPagetoken(ctx, accountID)
+			return nil
+		})
 
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			config.LOGGER.Error("could not fetch timestamp and page token for latest sync", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", accountID.String()))
+		if err != nil {
+			config.LOGGER.Error("an error occured while fetching google drive start page token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
 			return err
 		}
 	}
 
-	if syncDetails.LastSyncedAt.Valid {
-		query = fmt.Sprintf("modifiedTime > '%s'", syncDetails.LastSyncedAt.Time.Format(time.RFC3339))
-	}
+	totalItemCount := 0
 
-	var files []repository.AddSyncedItemsParams
+	// the virtual folders go out with the first page, a resumed listing already stored them
+	var virtualFolders []Item
 
-	totalItemCount := 0
+	if pageToken == "" {
+		var err error
+
+		virtualFolders, err = p.listVirtualFolders(ctx, account)
+		if err != nil {
+			return err
+		}
+	}
 
 	for {
-		var providerFileIDs []string
+		var fileList *drive.FileList
+
+		err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+			var err error
+
+			fileList, err = service.Files.
+				List().
+				Q("trashed = false").
+				Corpora("allDrives").
+				SupportsAllDrives(true).
+				IncludeItemsFromAllDrives(true).
+				Fields(googleapi.Field(fmt.Sprintf("nextPageToken, files(%s)", GOOGLE_FILE_FIELDS))).
+				PageToken(pageToken).
+				PageSize(1000).
+				Context(ctx).
+				Do()
 
-		fileList, err := driveService.Files.
-			List().
-			Q(query).
-			Fields("files(id, name, size, mimeType, createdTime, modifiedTime, thumbnailLink, fullFileExtension, parents, webViewLink, webContentLink, iconLink, sha256Checksum)").
-			PageToken(pageToken).
-			PageSize(1000).
-			Do()
+			return err
+		})
 
 		if err != nil {
-			if gErr, ok := err.(*googleapi.Error); ok {
-				if gErr.Code == http.StatusUnauthorized {
-					newAccessToken, _, err := p.RenewOAuthTokens(ctx, conn, accountID, refreshToken)
+			config.LOGGER.Error("an error occured while synching google drive files", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+			return err
+		}
+
+		var (
+			items   = make([]Item, 0, len(fileList.Files)+len(virtualFolders))
+			skipped = 0
+		)
+
+		for _, folder := range virtualFolders {
+			if scope.admits(folder) {
+				items = append(items, folder)
+			} else {
+				skipped++
+			}
+		}
+
+		virtualFolders = nil
+
+		for _, file := range fileList.Files {
+			if item := p.toItem(rootID, file); scope.admits(item) {
+				items = append(items, item)
+			} else {
+				skipped++
+			}
+		}
+
+		pageToken = fileList.NextPageToken
+
+		page := SyncPage{Items: items, Skipped: skipped}
 
-					if err != nil {
-						return err
-					}
+		if pageToken == "" {
+			page.Cursor = startPageToken
+		} else {
+			page.Checkpoint = GOOGLE_LISTING_CHECKPOINT_PREFIX + startPageToken + ":" + pageToken
+		}
+
+		if err := emit(ctx, page); err != nil {
+			return err
+		}
+
+		totalItemCount += len(items)
+
+		if pageToken == "" {
+			break
+		}
+	}
 
-					httpClient = p.getHTTPClient(newAccessToken, refreshToken)
-					driveService, err = drive.NewService(ctx, option.WithHTTPClient(httpClient))
-					if err != nil {
-						config.LOGGER.Error("an error occured while initializing google drive service", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-						return err
-					}
+	config.LOGGER.Info("Google drive sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
 
+	return nil
+}
+
+// listChanges emits one page per changes.list response, each carrying the token of the page after it so an
+// interrupted sync picks up where it stopped.
+func (p *GoogleProvider) listChanges(ctx context.Context, account Account, rootID string, scope *googleSyncScope, pageToken string, emit SyncFunc) error {
+	var (
+		totalItemCount    = 0
+		totalDeletedCount = 0
+	)
+
+	for {
+		var changeList *drive.ChangeList
+
+		err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+			var err error
+
+			changeList, err = service.Changes.
+				List(pageToken).
+				IncludeRemoved(true).
+				SupportsAllDrives(true).
+				IncludeItemsFromAllDrives(true).
+				Fields(googleapi.Field(fmt.Sprintf("nextPageToken, newStartPageToken, changes(changeType, fileId, driveId, removed, drive(id, name, createdTime), file(%s))", GOOGLE_FILE_FIELDS))).
+				PageSize(1000).
+				Context(ctx).
+				Do()
+
+			return err
+		})
+
+		if err != nil {
+			config.LOGGER.Error("an error occured while listing google drive changes", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+			return err
+		}
+
+		var page SyncPage
+
+		for _, change := range changeList.Changes {
+			// shared drives are synced as folders, removing one takes everything synced below it along
+			if change.ChangeType == "drive" {
+				if change.Removed || change.Drive == nil {
+					page.DeletedIDs = append(page.DeletedIDs, change.DriveId)
 					continue
 				}
+
+				if item := p.driveToItem(change.Drive); scope.admits(item) {
+					page.Items = append(page.Items, item)
+				} else {
+					page.DeletedIDs = append(page.DeletedIDs, change.DriveId)
+					page.Skipped++
+				}
+
+				continue
 			}
 
-			config.LOGGER.Error("an error occured while synching google drive files", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+			// removed covers deleted files and files the user lost access to
+			if change.Removed || change.File == nil || change.File.Trashed {
+				page.DeletedIDs = append(page.DeletedIDs, change.FileId)
+				continue
+			}
+
+			if item := p.toItem(rootID, change.File); scope.admits(item) {
+				page.Items = append(page.Items, item)
+			} else {
+				page.DeletedIDs = append(page.DeletedIDs, change.FileId)
+				page.Skipped++
+			}
+		}
+
+		page.Cursor = changeList.NextPageToken
+
+		if page.Cursor == "" {
+			page.Cursor = changeList.NewStartPageToken
+		}
+
+		if err := emit(ctx, page); err != nil {
 			return err
 		}
 
-		for _, file := range fileList.Files {
+		totalItemCount += len(page.Items)
+		totalDeletedCount += len(page.DeletedIDs)
 
-			parsedCreatedTime, err := time.Parse(time.RFC3339, file.CreatedTime)
-			if err != nil {
-				parsedCreatedTime = time.Time{}
+		if changeList.NextPageToken == "" {
+			break
+		}
+
+		pageToken = changeList.NextPageToken
+	}
+
+	config.LOGGER.Info("Google drive sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount), zap.Int("deleted_count", totalDeletedCount))
+
+	return nil
+}
+
+func (p *GoogleProvider) toItem(rootID string, file *drive.File) Item {
+	parsedCreatedTime, err := time.Parse(time.RFC3339, file.CreatedTime)
+	if err != nil {
+		parsedCreatedTime = time.Time{}
+	}
+
+	parsedModifiedTime, err := time.Parse(time.RFC3339, file.ModifiedTime)
+	if err != nil {
+		parsedModifiedTime = time.Time{}
+	}
+
+	isFolder := file.MimeType == GOOGLE_FOLDER_MIME_TYPE
+
+	previewLink := fmt.Sprintf("https://drive.google.com/file/d/%s/preview", file.Id)
+
+	if isFolder {
+		previewLink = fmt.Sprintf("https://drive.google.com/folder/d/%s/preview", file.Id)
+	}
+
+	sharedWithMe := !file.OwnedByMe && file.DriveId == "" && file.SharedWithMeTime != ""
+
+	// files in My Drive sit at the root, files shared without a visible parent in the shared with me folder and files
+	// at the top of a shared drive reference the drive id
+	parentFolder := "/"
+
+	switch {
+	case len(file.Parents) > 0 && file.Parents[0] != rootID:
+		parentFolder = file.Parents[0]
+	case len(file.Parents) == 0 && sharedWithMe:
+		parentFolder = GOOGLE_SHARED_WITH_ME_ID
+	}
+
+	var owner string
+
+	if len(file.Owners) > 0 {
+		owner = file.Owners[0].EmailAddress
+	}
+
+	return Item{
+		ProviderFileID: file.Id,
+		Name:           file.Name,
+		Extension:      file.FullFileExtension,
+		Size:           file.Size,
+		MimeType:       file.MimeType,
+		ParentFolder:   parentFolder,
+		IsFolder:       isFolder,
+		ContentHash:    file.Sha256Checksum,
+		CreatedTime:    parsedCreatedTime,
+		ModifiedTime:   parsedModifiedTime,
+		ThumbnailLink:  file.ThumbnailLink,
+		PreviewLink:    previewLink,
+		WebViewLink:    file.WebViewLink,
+		WebContentLink: file.WebContentLink,
+		Owner:          owner,
+		Shared:         file.Shared,
+		SharedWithMe:   sharedWithMe,
+	}
+}
+
+// googleSyncScope holds the folder ids the sync rules of an account resolved to. Included and excluded hold the folders
+// named by the rules along with every folder below them, "/" stands for the top of My Drive. Ancestors are the folders
+// leading to an included folder, they are kept without their other contents.
+type googleSyncScope struct {
+	rules     *SyncRules
+	included  map[string]bool
+	excluded  map[string]bool
+	ancestors map[string]bool
+}
+
+// admits reports whether item is stored. Folders created below an included or excluded folder after the scope was
+// resolved join it, so their contents later in the same sync are decided the same way.
+func (s *googleSyncScope) admits(item Item) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.excluded[item.ProviderFileID] || s.excluded[item.ParentFolder] {
+		if item.IsFolder {
+			s.excluded[item.ProviderFileID] = true
+		}
+
+		return false
+	}
+
+	if s.rules.RestrictsFolders() {
+		switch {
+		case s.included[item.ProviderFileID]:
+		case s.included[item.ParentFolder]:
+			if item.IsFolder {
+				s.included[item.ProviderFileID] = true
 			}
+		case item.IsFolder && s.ancestors[item.ProviderFileID]:
+		default:
+			return false
+		}
+	}
+
+	return s.rules.AllowsName(item.Name, item.IsFolder)
+}
 
-			parsedModifiedTime, err := time.Parse(time.RFC3339, file.ModifiedTime)
+// resolveSyncScope resolves the folder rules of the account, nil means every folder is synced. Path rules start at My
+// Drive, a first component naming the shared with me folder or a shared drive starts there instead. Rules pointing at
+// folders that do not exist match nothing.
+func (p *GoogleProvider) resolveSyncScope(ctx context.Context, account Account, rootID string) (*googleSyncScope, error) {
+	if account.Rules == nil {
+		return nil, nil
+	}
+
+	scope := &googleSyncScope{
+		rules:     account.Rules,
+		included:  map[string]bool{},
+		excluded:  map[string]bool{},
+		ancestors: map[string]bool{},
+	}
+
+	includePaths, excludePaths := account.Rules.Paths()
+	includeIDs, excludeIDs := account.Rules.IDs()
+
+	if len(includePaths)+len(excludePaths)+len(includeIDs)+len(excludeIDs) == 0 {
+		return scope, nil
+	}
+
+	var sharedDrives []Item
+
+	if len(includePaths)+len(excludePaths) > 0 {
+		var err error
+
+		sharedDrives, err = p.listVirtualFolders(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resolve := func(paths, ids []string, withAncestors bool) ([]string, error) {
+		folderIDs := append([]string(nil), ids...)
+
+		for _, folderPath := range paths {
+			folderID, ancestors, err := p.resolveFolderPath(ctx, account, rootID, sharedDrives, folderPath)
 			if err != nil {
-				parsedModifiedTime = time.Time{}
+				return nil, err
 			}
 
-			isFolder := file.MimeType == "application/vnd.google-apps.folder"
+			if folderID == "" {
+				continue
+			}
 
-			previewLink := fmt.Sprintf("https://drive.google.com/file/d/%s/preview", file.Id)
+			folderIDs = append(folderIDs, folderID)
 
-			if isFolder {
-				previewLink = fmt.Sprintf("https://drive.google.com/folder/d/%s/preview", file.Id)
+			if withAncestors {
+				for _, ancestor := range ancestors {
+					scope.ancestors[ancestor] = true
+				}
 			}
+		}
 
-			parentFolder := "/"
+		if withAncestors {
+			for _, id := range ids {
+				ancestors, err := p.folderAncestors(ctx, account, rootID, id)
+				if err != nil {
+					return nil, err
+				}
 
-			if len(file.Parents) > 0 {
-				parentFolder = file.Parents[0]
+				for _, ancestor := range ancestors {
+					scope.ancestors[ancestor] = true
+				}
 			}
+		}
 
-			files = append(files, repository.AddSyncedItemsParams{
-				AccountID:      accountID,
-				ProviderFileID: file.Id,
-				Name:           file.Name,
-				Extension:      file.FullFileExtension,
-				Size:           file.Size,
-				MimeType:       db.PGTextField(file.MimeType),
-				CreatedTime:    db.PGTimestamptzField(parsedCreatedTime),
-				ModifiedTime:   db.PGTimestamptzField(parsedModifiedTime),
-				ParentFolder:   db.PGTextField(parentFolder),
-				IsFolder:       isFolder,
-				ContentHash:    db.PGTextField(file.Sha256Checksum),
-				ThumbnailLink:  db.PGTextField(file.ThumbnailLink),
-				PreviewLink:    db.PGTextField(previewLink),
-				WebViewLink:    db.PGTextField(file.WebViewLink),
-				WebContentLink: db.PGTextField(file.WebContentLink),
-				LinkExpiresAt:  db.PGTimestamptzField(time.Time{}),
-			})
+		return folderIDs, nil
+	}
+
+	includeFolders, err := resolve(includePaths, includeIDs, true)
+	if err != nil {
+		return nil, err
+	}
+
+	excludeFolders, err := resolve(excludePaths, excludeIDs, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expandFolders(ctx, account, rootID, includeFolders, scope.included); err != nil {
+		return nil, err
+	}
+
+	if err := p.expandFolders(ctx, account, rootID, excludeFolders, scope.excluded); err != nil {
+		return nil, err
+	}
+
+	return scope, nil
+}
+
+// resolveFolderPath walks folderPath down from the root and returns the id of the folder along with the folders
+// leading to it. An empty id means the path does not exist.
+func (p *GoogleProvider) resolveFolderPath(ctx context.Context, account Account, rootID string, sharedDrives []Item, folderPath string) (string, []string, error) {
+	components := strings.FieldsFunc(folderPath, func(r rune) bool { return r == '/' })
 
-			if syncDetails.LastSyncedAt.Valid {
-				providerFileIDs = append(providerFileIDs, file.Id)
+	if len(components) == 0 {
+		return rootID, nil, nil
+	}
+
+	parentID := rootID
+
+	for _, folder := range sharedDrives {
+		if strings.EqualFold(folder.Name, components[0]) {
+			parentID = folder.ProviderFileID
+			components = components[1:]
+			break
+		}
+	}
+
+	var ancestors []string
+
+	for _, component := range components {
+		if parentID != rootID {
+			ancestors = append(ancestors, parentID)
+		}
+
+		query := fmt.Sprintf("'%s' in parents and mimeType = '%s' and trashed = false", escapeDriveQuery(parentID), GOOGLE_FOLDER_MIME_TYPE)
+
+		if parentID == GOOGLE_SHARED_WITH_ME_ID {
+			query = fmt.Sprintf("sharedWithMe = true and mimeType = '%s' and trashed = false", GOOGLE_FOLDER_MIME_TYPE)
+		}
+
+		childID := ""
+
+		err := p.listFolders(ctx, account, query, func(folder *drive.File) bool {
+			if !strings.EqualFold(folder.Name, component) || (parentID == GOOGLE_SHARED_WITH_ME_ID && len(folder.Parents) > 0) {
+				return true
 			}
+
+			childID = folder.Id
+
+			return false
+		})
+
+		if err != nil || childID == "" {
+			return "", nil, err
 		}
 
-		var insertedRows int64
+		parentID = childID
+	}
+
+	return parentID, ancestors, nil
+}
 
-		err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
-			qx := queries.WithTx(tx)
+// folderAncestors returns the folders between the root and the folder with the given id.
+func (p *GoogleProvider) folderAncestors(ctx context.Context, account Account, rootID, folderID string) ([]string, error) {
+	var ancestors []string
 
-			if len(providerFileIDs) > 0 {
-				err := qx.DeleteConflictingItems(ctx, repository.DeleteConflictingItemsParams{
-					ProviderFileIds: providerFileIDs,
-					AccountID:       accountID,
+	for folderID != rootID && folderID != GOOGLE_SHARED_WITH_ME_ID {
+		var file *drive.File
+
+		err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+			var err error
+			file, err = service.Files.Get(folderID).Fields("id, parents, driveId, ownedByMe").SupportsAllDrives(true).Context(ctx).Do()
+			return err
+		})
+
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return ancestors, nil
+		}
+
+		if err != nil {
+			config.LOGGER.Error("an error occured while resolving google drive folder", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("folder_id", folderID), zap.Error(err))
+			return nil, err
+		}
+
+		if len(file.Parents) == 0 {
+			if file.DriveId == "" && !file.OwnedByMe {
+				ancestors = append(ancestors, GOOGLE_SHARED_WITH_ME_ID)
+			}
+
+			return ancestors, nil
+		}
+
+		folderID = file.Parents[0]
+
+		if folderID != rootID {
+			ancestors = append(ancestors, folderID)
+		}
+	}
+
+	return ancestors, nil
+}
+
+// expandFolders adds the given folders and every folder below them to folders. The top of My Drive is added as "/",
+// that is the parent its files are stored with.
+func (p *GoogleProvider) expandFolders(ctx context.Context, account Account, rootID string, folderIDs []string, folders map[string]bool) error {
+	frontier := make([]string, 0, len(folderIDs))
+
+	for _, id := range folderIDs {
+		if folders[id] {
+			continue
+		}
+
+		folders[id] = true
+		frontier = append(frontier, id)
+
+		if id == rootID {
+			folders["/"] = true
+		}
+	}
+
+	for len(frontier) > 0 {
+		var next []string
+
+		visit := func(folder *drive.File) bool {
+			if !folders[folder.Id] {
+				folders[folder.Id] = true
+				next = append(next, folder.Id)
+			}
+
+			return true
+		}
+
+		var parents []string
+
+		for _, id := range frontier {
+			// files shared without a visible parent have no parent to query for
+			if id == GOOGLE_SHARED_WITH_ME_ID {
+				query := fmt.Sprintf("sharedWithMe = true and mimeType = '%s' and trashed = false", GOOGLE_FOLDER_MIME_TYPE)
+
+				err := p.listFolders(ctx, account, query, func(folder *drive.File) bool {
+					return len(folder.Parents) > 0 || visit(folder)
 				})
 
 				if err != nil {
-					config.LOGGER.Error("an error occured while deleting conflicted files", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", accountID.String()), zap.Error(err))
 					return err
 				}
+
+				continue
 			}
 
-			insertedRows, err = qx.AddSyncedItems(ctx, files)
+			parents = append(parents, fmt.Sprintf("'%s' in parents", escapeDriveQuery(id)))
+		}
 
-			if err != nil {
+		for chunk := range slices.Chunk(parents, GOOGLE_PARENTS_PER_QUERY) {
+			query := fmt.Sprintf("(%s) and mimeType = '%s' and trashed = false", strings.Join(chunk, " or "), GOOGLE_FOLDER_MIME_TYPE)
+
+			if err := p.listFolders(ctx, account, query, visit); err != nil {
 				return err
 			}
+		}
 
-			return qx.UpdateLastSyncedTimestamp(ctx, repository.UpdateLastSyncedTimestampParams{
-				SyncPageToken: db.PGTextField(""),
-				AccountID:     accountID,
-			})
+		frontier = next
+	}
+
+	return nil
+}
+
+// listFolders hands every folder matching query to fn until fn returns false.
+func (p *GoogleProvider) listFolders(ctx context.Context, account Account, query string, fn func(folder *drive.File) bool) error {
+	pageToken := ""
+
+	for {
+		var fileList *drive.FileList
+
+		err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+			var err error
+
+			fileList, err = service.Files.
+				List().
+				Q(query).
+				Corpora("allDrives").
+				SupportsAllDrives(true).
+				IncludeItemsFromAllDrives(true).
+				Fields("nextPageToken, files(id, name, parents)").
+				PageToken(pageToken).
+				PageSize(1000).
+				Context(ctx).
+				Do()
+
+			return err
 		})
 
 		if err != nil {
-			config.LOGGER.Error("failed to insert synced files", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+			config.LOGGER.Error("an error occured while listing google drive folders", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
 			return err
 		}
 
-		config.LOGGER.Info("batch inserted", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", accountID.String()), zap.Int64("item_count", insertedRows))
-
-		totalItemCount += int(insertedRows)
+		for _, folder := range fileList.Files {
+			if !fn(folder) {
+				return nil
+			}
+		}
 
 		pageToken = fileList.NextPageToken
 
 		if pageToken == "" {
-			break
+			return nil
 		}
-
-		files = []repository.AddSyncedItemsParams{}
 	}
-
-	config.LOGGER.Info("Google drive sync successful", zap.Int("item_count", totalItemCount))
-
-	return nil
 }
 
-func (p *GoogleProvider) RenewOAuthTokens(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, refreshToken string) (string, int64, error) {
-	reqUrl := fmt.Sprintf("%s?grant_type=refresh_token&client_id=%s&client_secret=%s&refresh_token=%s", GOOGLE_AUTH_URL, p.Config.ClientID, p.Config.ClientSecret, refreshToken)
-
-	res, err := http.Post(reqUrl, "application/json", nil)
-	if err != nil {
-		config.LOGGER.Error("http request for google token renewal failed", zap.String("provider", GOOGLE_PROVIDER_NAME))
-		return "", 0, err
-	}
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		config.LOGGER.Error("failed to read http response body for google token renewal", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
-		return "", 0, err
-	}
+// escapeDriveQuery escapes a value placed between single quotes of a files.list query.
+func escapeDriveQuery(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
 
-	defer res.Body.Close()
+// listVirtualFolders returns the shared with me folder and a folder for every shared drive of the account.
+func (p *GoogleProvider) listVirtualFolders(ctx context.Context, account Account) ([]Item, error) {
+	folders := []Item{{
+		ProviderFileID: GOOGLE_SHARED_WITH_ME_ID,
+		Name:           GOOGLE_SHARED_WITH_ME_NAME,
+		MimeType:       GOOGLE_FOLDER_MIME_TYPE,
+		ParentFolder:   "/",
+		IsFolder:       true,
+		SharedWithMe:   true,
+	}}
 
-	var googleAuthResponse GoogleAuthResponse
+	pageToken := ""
 
-	if err := json.Unmarshal(body, &googleAuthResponse); err != nil {
-		config.LOGGER.Error("failed to unmarshal dropbox token renew response", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-		return "", 0, err
-	}
+	for {
+		var driveList *drive.DriveList
 
-	err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
+		err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+			var err error
+			driveList, err = service.Drives.List().Fields("nextPageToken, drives(id, name, createdTime)").PageToken(pageToken).PageSize(100).Context(ctx).Do()
+			return err
+		})
 
-		encryptedAccessToken, err := utils.Encrypt(googleAuthResponse.AccessToken)
 		if err != nil {
-			config.LOGGER.Error("failed to encrypt new access token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-			return err
+			config.LOGGER.Error("an error occured while listing google shared drives", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+			return nil, err
 		}
 
-		qx := repository.New(conn).WithTx(tx)
+		for _, sharedDrive := range driveList.Drives {
+			folders = append(folders, p.driveToItem(sharedDrive))
+		}
 
-		err = qx.UpdateRenewedAuthToken(ctx, repository.UpdateRenewedAuthTokenParams{
-			AccountID:   accountID,
-			AccessToken: encryptedAccessToken,
-			TokenType:   db.PGTextField(googleAuthResponse.TokenType),
-		})
+		pageToken = driveList.NextPageToken
 
-		return err
-	})
+		if pageToken == "" {
+			return folders, nil
+		}
+	}
+}
 
+// driveToItem maps a shared drive to a folder at the root, the files at the top of the drive list the drive id as
+// their parent.
+func (p *GoogleProvider) driveToItem(sharedDrive *drive.Drive) Item {
+	createdTime, err := time.Parse(time.RFC3339, sharedDrive.CreatedTime)
 	if err != nil {
-		config.LOGGER.Error("failed to update google oauth tokens in db", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-		return "", 0, err
+		createdTime = time.Time{}
 	}
 
-	return googleAuthResponse.AccessToken, googleAuthResponse.ExpiresIn, nil
+	return Item{
+		ProviderFileID: sharedDrive.Id,
+		Name:           sharedDrive.Name,
+		MimeType:       GOOGLE_FOLDER_MIME_TYPE,
+		ParentFolder:   "/",
+		IsFolder:       true,
+		CreatedTime:    createdTime,
+		ModifiedTime:   createdTime,
+		WebViewLink:    fmt.Sprintf("https://drive.google.com/drive/folders/%s", sharedDrive.Id),
+		Shared:         true,
+	}
 }
 
-func (p *GoogleProvider) getHTTPClient(accessToken, refreshToken string) *http.Client {
-	token := &oauth2.Token{AccessToken: accessToken, RefreshToken: refreshToken}
-
-	tokenSource := p.Config.TokenSource(context.Background(), token)
-
-	reusableTokenSource := oauth2.ReuseTokenSource(token, tokenSource)
+func (p *GoogleProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	token, err := p.Config.TokenSource(oauthContext(ctx, googleHTTPClient), &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		config.LOGGER.Error("http request for google token renewal failed", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+		return nil, refreshTokenError(err)
+	}
 
-	return oauth2.NewClient(context.Background(), reusableTokenSource)
+	return token, nil
 }
 
-func (p *GoogleProvider) UploadFiles(ctx context.Context, accountID *pgtype.UUID, conn *pgxpool.Conn, queries *repository.Queries, authTokens repository.GetAuthTokensRow, uploadedFiles []middlewares.UploadedFile) error {
-
-	accessToken, err := utils.Decrypt(authTokens.AccessToken)
-	if err != nil {
-		config.LOGGER.Error("failed to decrypt access token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-		return err
+func (p *GoogleProvider) getHTTPClient(ctx context.Context, accessToken string) *http.Client {
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken}),
+			Base:   googleHTTPClient.Transport,
+		},
 	}
+}
 
-	refreshToken, err := utils.Decrypt(authTokens.RefreshToken)
+// withDriveService runs fn against a drive service for the account, retrying it once with a renewed
+// token when Drive rejects the current one.
+func (p *GoogleProvider) withDriveService(ctx context.Context, account Account, fn func(service *drive.Service) error) error {
+	accessToken, err := account.Tokens.AccessToken(ctx)
 	if err != nil {
-		config.LOGGER.Error("failed to decrypt access token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+		config.LOGGER.Error("could not get access token", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
 		return err
 	}
 
-	httpClient := p.getHTTPClient(accessToken, refreshToken)
+	for attempt := 0; ; attempt++ {
+		driveService, err := drive.NewService(ctx, option.WithHTTPClient(p.getHTTPClient(ctx, accessToken)))
+		if err != nil {
+			config.LOGGER.Error("an error occured while initializing google drive service", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+			return err
+		}
+
+		err = fn(driveService)
+
+		var gErr *googleapi.Error
+		if attempt > 0 || !errors.As(err, &gErr) || gErr.Code != http.StatusUnauthorized {
+			return err
+		}
+
+		config.LOGGER.Warn("access token expired, attempting to renew", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", account.ID))
+
+		accessToken, err = account.Tokens.Renew(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
 
-	driveService, err := drive.NewService(ctx, option.WithHTTPClient(httpClient))
+func (p *GoogleProvider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
+	rootID, err := p.getRootID(ctx, account)
 	if err != nil {
-		config.LOGGER.Error("an error occured while initializing google drive service", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-		return err
+		return nil, err
 	}
 
 	var (
 		mu      sync.Mutex
-		results []*drive.File
+		results []Item
 		g, _    = errgroup.WithContext(ctx)
 		sem     = make(chan struct{}, 10)
 	)
@@ -451,13 +975,20 @@ func (p *GoogleProvider) UploadFiles(ctx context.Context, accountID *pgtype.UUID
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			uploadedFile, err := p.uploadToDrive(driveService, file)
+			var uploadedFile *drive.File
+
+			err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+				var err error
+				uploadedFile, err = p.uploadToDrive(ctx, service, file)
+				return err
+			})
+
 			if err != nil {
 				return err
 			}
 
 			mu.Lock()
-			results = append(results, uploadedFile)
+			results = append(results, p.toItem(rootID, uploadedFile))
 			mu.Unlock()
 
 			return nil
@@ -465,89 +996,221 @@ func (p *GoogleProvider) UploadFiles(ctx context.Context, accountID *pgtype.UUID
 	}
 
 	if err := g.Wait(); err != nil {
-		return err
+		return nil, err
 	}
 
-	var files []repository.AddSyncedItemsParams
+	return results, nil
+}
 
-	for _, r := range results {
+func (p *GoogleProvider) uploadToDrive(ctx context.Context, service *drive.Service, file middlewares.UploadedFile) (*drive.File, error) {
+	mimeType := file.ContentType
 
-		parsedCreatedTime, err := time.Parse(time.RFC3339, r.CreatedTime)
-		if err != nil {
-			parsedCreatedTime = time.Time{}
-		}
+	fileMeta := &drive.File{Name: file.FileHeader.Filename}
 
-		parsedModifiedTime, err := time.Parse(time.RFC3339, r.ModifiedTime)
-		if err != nil {
-			parsedModifiedTime = time.Time{}
+	if _, err := file.File.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	uploadedFile, err := service.Files.
+		Create(fileMeta).
+		Media(file.File, googleapi.ContentType(mimeType)).
+		Fields(GOOGLE_FILE_FIELDS).
+		Context(ctx).
+		Do()
+
+	if err != nil {
+		config.LOGGER.Error("upload failed", zap.String("file", file.FileHeader.Filename), zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+		return nil, fmt.Errorf("upload failed for file '%s': %w", file.FileHeader.Filename, err)
+	}
+
+	return uploadedFile, nil
+}
+
+// DownloadFile streams a file's content. Google Docs, Sheets and Slides have no binary content of
+// their own, so they are exported as PDF instead.
+func (p *GoogleProvider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	var res *http.Response
+
+	name := item.Name
+
+	err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+		var err error
+
+		if strings.HasPrefix(item.MimeType, GOOGLE_APPS_MIME_TYPE_PREFIX) {
+			res, err = service.Files.Export(item.ProviderFileID, "application/pdf").Context(ctx).Download()
+			return err
 		}
 
-		isFolder := r.MimeType == "application/vnd.google-apps.folder"
+		res, err = service.Files.Get(item.ProviderFileID).SupportsAllDrives(true).Context(ctx).Download()
+		return err
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to download file", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	if strings.HasPrefix(item.MimeType, GOOGLE_APPS_MIME_TYPE_PREFIX) {
+		name = fmt.Sprintf("%s.pdf", name)
+	}
+
+	return &Download{
+		Body:        res.Body,
+		Name:        name,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        res.ContentLength,
+	}, nil
+}
+
+// DeleteFile moves the file to the Drive trash rather than deleting it permanently.
+func (p *GoogleProvider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	if item.ProviderFileID == GOOGLE_SHARED_WITH_ME_ID {
+		return ErrUnsupportedAction
+	}
+
+	err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+		_, err := service.Files.Update(item.ProviderFileID, &drive.File{Trashed: true}).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
 
-		previewLink := fmt.Sprintf("https://drive.google.com/file/d/%s/preview", r.Id)
+	if err != nil {
+		config.LOGGER.Error("failed to trash file", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		return err
+	}
 
-		if isFolder {
-			previewLink = fmt.Sprintf("https://drive.google.com/folder/d/%s/preview", r.Id)
+	return nil
+}
+
+func (p *GoogleProvider) MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error) {
+	if item.ProviderFileID == GOOGLE_SHARED_WITH_ME_ID || parentID == GOOGLE_SHARED_WITH_ME_ID {
+		return nil, ErrUnsupportedAction
+	}
+
+	rootID, err := p.getRootID(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var movedFile *drive.File
+
+	err = p.withDriveService(ctx, account, func(service *drive.Service) error {
+		call := service.Files.Update(item.ProviderFileID, &drive.File{Name: name}).SupportsAllDrives(true).Fields(GOOGLE_FILE_FIELDS).Context(ctx)
+
+		if parentID == "/" {
+			parentID = rootID
 		}
 
-		parentFolder := "/"
+		if parentID != "" {
+			current, err := service.Files.Get(item.ProviderFileID).SupportsAllDrives(true).Fields("parents").Context(ctx).Do()
+			if err != nil {
+				return err
+			}
 
-		if len(r.Parents) > 0 {
-			parentFolder = r.Parents[0]
+			call = call.AddParents(parentID).RemoveParents(strings.Join(current.Parents, ","))
 		}
 
-		files = append(files, repository.AddSyncedItemsParams{
-			AccountID:      *accountID,
-			ProviderFileID: r.Id,
-			Name:           r.Name,
-			Extension:      r.FullFileExtension,
-			Size:           r.Size,
-			MimeType:       db.PGTextField(r.MimeType),
-			ParentFolder:   db.PGTextField(parentFolder),
-			IsFolder:       isFolder,
-			ContentHash:    db.PGTextField(r.Sha256Checksum),
-			ThumbnailLink:  db.PGTextField(r.ThumbnailLink),
-			PreviewLink:    db.PGTextField(previewLink),
-			WebViewLink:    db.PGTextField(r.WebViewLink),
-			WebContentLink: db.PGTextField(r.WebContentLink),
-			LinkExpiresAt:  db.PGTimestamptzField(time.Time{}),
-			CreatedTime:    db.PGTimestamptzField(parsedCreatedTime),
-			ModifiedTime:   db.PGTimestamptzField(parsedModifiedTime),
-		})
+		var err error
+		movedFile, err = call.Do()
+		return err
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to move file", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		return nil, err
 	}
 
-	err = utils.WithTransaction(ctx, conn, func(tx pgx.Tx) error {
-		qx := queries.WithTx(tx)
+	movedItem := p.toItem(rootID, movedFile)
 
-		insertedRows, err := qx.AddSyncedItems(ctx, files)
+	return &movedItem, nil
+}
 
-		config.LOGGER.Info("insert new files", zap.Int64("item_count", insertedRows))
+// Watch opens a push notification channel for changes of the account, Drive posts to address until the returned
+// channel expires. Drive caps the lifetime of a channel, it has to be replaced before it runs out.
+func (p *GoogleProvider) Watch(ctx context.Context, account Account, channelID, token, address string) (*WatchChannel, error) {
+	var channel *drive.Channel
 
+	err := p.withDriveService(ctx, account, func(service *drive.Service) error {
+		startPageToken, err := service.Changes.GetStartPageToken().SupportsAllDrives(true).Context(ctx).Do()
 		if err != nil {
 			return err
 		}
 
-		return nil
+		channel, err = service.Changes.Watch(startPageToken.StartPageToken, &drive.Channel{
+			Id:         channelID,
+			Type:       "web_hook",
+			Address:    address,
+			Token:      token,
+			Expiration: time.Now().Add(GOOGLE_CHANNEL_TTL).UnixMilli(),
+		}).SupportsAllDrives(true).IncludeItemsFromAllDrives(true).Context(ctx).Do()
+
+		return err
 	})
 
 	if err != nil {
-		config.LOGGER.Error("failed to insert newly uploaded files", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-		return err
+		config.LOGGER.Error("failed to watch google drive changes", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
 	}
 
-	return nil
+	return &WatchChannel{
+		ID:         channel.Id,
+		ResourceID: channel.ResourceId,
+		ExpiresAt:  time.UnixMilli(channel.Expiration),
+	}, nil
 }
 
-func (p *GoogleProvider) uploadToDrive(service *drive.Service, file middlewares.UploadedFile) (*drive.File, error) {
-	mimeType := file.ContentType
+// Stop stops notifications of a channel opened by Watch.
+func (p *GoogleProvider) Stop(ctx context.Context, account Account, channelID, resourceID string) error {
+	return p.withDriveService(ctx, account, func(service *drive.Service) error {
+		return service.Channels.Stop(&drive.Channel{Id: channelID, ResourceId: resourceID}).Context(ctx).Do()
+	})
+}
 
-	fileMeta := &drive.File{Name: file.FileHeader.Filename}
+// RevokeToken revokes the stored refresh token of the account, Google revokes the access tokens issued from it as well.
+// The access token is only revoked for accounts without a refresh token, it may have expired and getting it could
+// refresh it first.
+func (p *GoogleProvider) RevokeToken(ctx context.Context, account Account) error {
+	token, err := account.Tokens.RefreshToken(ctx)
+	if err == nil && token == "" {
+		token, err = account.Tokens.AccessToken(ctx)
+	}
 
-	uploadedFile, err := service.Files.Create(fileMeta).Media(file.File, googleapi.ContentType(mimeType)).Do()
 	if err != nil {
-		config.LOGGER.Error("upload failed", zap.String("file", file.FileHeader.Filename), zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
-		return nil, fmt.Errorf("upload failed for file '%s': %v", file.FileHeader.Filename, err)
+		config.LOGGER.Error("could not get token to revoke", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return err
 	}
 
-	return uploadedFile, nil
+	data := url.Values{}
+	data.Add("token", token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, GOOGLE_REVOKE_URL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := googleHTTPClient.Do(req)
+	if err != nil {
+		config.LOGGER.Error("http request for google token revocation failed", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Error(err))
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		config.LOGGER.Error("http request for google token revocation did not return 200", zap.String("provider", GOOGLE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+
+		// a token that expired or was revoked already is answered with invalid_token
+		var revokeError struct {
+			Error string `json:"error"`
+		}
+
+		if res.StatusCode == http.StatusBadRequest && json.Unmarshal(body, &revokeError) == nil && revokeError.Error == "invalid_token" {
+			return fmt.Errorf("%w: %s", ErrInvalidGrant, body)
+		}
+
+		return fmt.Errorf("%s", string(body[:]))
+	}
+
+	return nil
 }
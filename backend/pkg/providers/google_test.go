@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestGoogleRevokeTokenAlreadyRevoked(t *testing.T) {
+	serveProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/revoke" || r.FormValue("token") == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.FormValue("token") == "revoked" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error": "invalid_token", "error_description": "Token expired or revoked"}`)
+			return
+		}
+
+		io.WriteString(w, `{}`)
+	}), googleHTTPClient)
+
+	p := NewGoogleProvider()
+
+	err := p.RevokeToken(context.Background(), Account{ID: "account", Tokens: staticTokens{value: "revoked"}})
+	if !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("RevokeToken of a revoked token returned %v, want ErrInvalidGrant", err)
+	}
+
+	if err := p.RevokeToken(context.Background(), Account{ID: "account", Tokens: staticTokens{value: "token"}}); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+}
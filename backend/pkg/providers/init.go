@@ -6,14 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
+	"github.com/blackmamoth/cloudmesh/pkg/config"
 	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/google/uuid"
 	"github.com/gorilla/sessions"
-	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/oauth2"
 )
 
@@ -25,13 +26,190 @@ type UserAccountInfo struct {
 	AvatarURL      string `json:"avatar_url"`
 }
 
+// Item is the provider agnostic description of a remote file or folder. Providers only translate
+// their API responses into Items, storing them is left to the catalog package. Owner, Shared and
+// SharedWithMe are left empty by providers without sharing.
+type Item struct {
+	ProviderFileID string
+	Name           string
+	Extension      string
+	Size           int64
+	MimeType       string
+	ParentFolder   string
+	IsFolder       bool
+	ContentHash    string
+	CreatedTime    time.Time
+	ModifiedTime   time.Time
+	ThumbnailLink  string
+	PreviewLink    string
+	WebViewLink    string
+	WebContentLink string
+	LinkExpiresAt  time.Time
+	Owner          string
+	Shared         bool
+	SharedWithMe   bool
+}
+
+// SyncPage is one batch of remote changes. Cursor is the position the next sync should resume
+// from once the page has been stored. DeletedPaths is used by providers that report deletions by
+// lower cased path only, everything stored at or below such a path is removed.
+//
+// Checkpoint is the position an interrupted sync continues the same listing from, it is handed back
+// to SyncFiles as cursor. It defaults to Cursor, a page with neither can not be resumed. Skipped
+// counts the items the sync rules left out of the page.
+type SyncPage struct {
+	Items        []Item
+	DeletedIDs   []string
+	DeletedPaths []string
+	Cursor       string
+	Checkpoint   string
+	Skipped      int
+}
+
+// SyncFunc receives every page a Syncer produces, in order. Returning an error stops the sync.
+type SyncFunc func(ctx context.Context, page SyncPage) error
+
+// TokenSource hands out the secret stored for a linked account. For OAuth providers that is the
+// access token, for credential providers it is the encrypted credentials JSON after decryption.
+type TokenSource interface {
+	AccessToken(ctx context.Context) (string, error)
+	// Renew refreshes an access token the remote rejected and returns the new one.
+	Renew(ctx context.Context) (string, error)
+	// RefreshToken returns the stored refresh token without contacting the provider, it is empty for accounts
+	// without one.
+	RefreshToken(ctx context.Context) (string, error)
+}
+
+// Account identifies the linked account a provider operation runs against. Rules is only set for syncs of
+// providers with selective sync, nil syncs everything.
+type Account struct {
+	ID     string
+	Tokens TokenSource
+	Rules  *SyncRules
+}
+
+// credentials decodes the credentials a CredentialAuthenticator stored for the account into v.
+func (a Account) credentials(ctx context.Context, v any) error {
+	decrypted, err := a.Tokens.AccessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(decrypted), v)
+}
+
+// Download is an open stream of a remote file's content, the caller must close Body.
+type Download struct {
+	Body        io.ReadCloser
+	Name        string
+	ContentType string
+	Size        int64
+}
+
+// Capabilities describes which of the optional interfaces below a provider implements, so callers
+// can reject unsupported operations up front instead of type asserting everywhere.
+type Capabilities struct {
+	OAuth           bool `json:"oauth"`
+	Credentials     bool `json:"credentials"`
+	Sync            bool `json:"sync"`
+	IncrementalSync bool `json:"incremental_sync"`
+	Upload          bool `json:"upload"`
+	Download        bool `json:"download"`
+	Delete          bool `json:"delete"`
+	Move            bool `json:"move"`
+	SelectiveSync   bool `json:"selective_sync"`
+	Revoke          bool `json:"revoke"`
+	Watch           bool `json:"watch"`
+	Longpoll        bool `json:"longpoll"`
+}
+
+// Provider is the one method every backend implements, everything else is opt in.
 type Provider interface {
+	Capabilities() Capabilities
+}
+
+// Authenticator links accounts through an OAuth redirect.
+type Authenticator interface {
+	Provider
 	GetConsentPageURL(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore, userID string) (string, error)
 	GetToken(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore) (*oauth2.Token, string, *UserAccountInfo, error)
 	GetAccountInfo(ctx context.Context, token *oauth2.Token) (*UserAccountInfo, error)
-	SyncFiles(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, authToken repository.GetAuthTokensRow) error
-	RenewOAuthTokens(ctx context.Context, conn *pgxpool.Conn, accountID pgtype.UUID, refreshToken string) (string, int64, error)
-	UploadFiles(ctx context.Context, accountID *pgtype.UUID, conn *pgxpool.Conn, queries *repository.Queries, authTokens repository.GetAuthTokensRow, uploadedFiles []middlewares.UploadedFile) error
+	RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+}
+
+// CredentialAuthenticator links accounts with static credentials (access keys, passwords) instead
+// of an OAuth redirect. The credentials are stored encrypted in linked_account.access_token.
+type CredentialAuthenticator interface {
+	Provider
+	NewCredentials() any
+	VerifyCredentials(ctx context.Context, credentials any) (*UserAccountInfo, error)
+}
+
+// Syncer lists the remote and reports it page by page. Providers advertising IncrementalSync only
+// report changes since cursor, the others list everything on every run and leave it to the caller
+// to work out what disappeared.
+type Syncer interface {
+	Provider
+	SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error
+}
+
+type Uploader interface {
+	Provider
+	UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error)
+}
+
+type Downloader interface {
+	Provider
+	DownloadFile(ctx context.Context, account Account, item Item) (*Download, error)
+}
+
+type Deleter interface {
+	Provider
+	DeleteFile(ctx context.Context, account Account, item Item) error
+}
+
+// Mover moves item into the folder parentID and/or renames it. An empty parentID keeps the
+// current parent and "/" stands for the root folder, an empty name keeps the current name.
+type Mover interface {
+	Provider
+	MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error)
+}
+
+// Revoker gives up the grant of an account when it is unlinked, its tokens stop working at the provider. A grant that
+// is gone already is reported as ErrInvalidGrant.
+type Revoker interface {
+	Provider
+	RevokeToken(ctx context.Context, account Account) error
+}
+
+// WatchChannel is a push notification channel opened by a ChangeWatcher, the provider posts to its address until
+// ExpiresAt. ResourceID is needed to stop it again.
+type WatchChannel struct {
+	ID         string
+	ResourceID string
+	ExpiresAt  time.Time
+}
+
+// ChangeWatcher has the provider push changes of an account to a webhook instead of being polled. Channels expire, a
+// replacement has to be opened before the current one runs out.
+type ChangeWatcher interface {
+	Provider
+	Watch(ctx context.Context, account Account, channelID, token, address string) (*WatchChannel, error)
+	Stop(ctx context.Context, account Account, channelID, resourceID string) error
+}
+
+// LongpollResult tells whether anything below a cursor changed and how many seconds the caller has to wait before
+// polling again.
+type LongpollResult struct {
+	Changes bool
+	Backoff int
+}
+
+// ChangePoller blocks until something below a sync cursor changed or timeout seconds passed. A cursor the provider
+// invalidated is reported as ErrCursorReset.
+type ChangePoller interface {
+	Provider
+	Longpoll(ctx context.Context, cursor string, timeout int) (*LongpollResult, error)
 }
 
 type OAuthState struct {
@@ -47,14 +225,146 @@ var (
 	ErrNoVerifier          = errors.New("PKCE verifier missing or invalid")
 	ErrInvalidState        = errors.New("invalid state parameter")
 	ErrFailSessionCleanUp  = errors.New("failed to clean up session values")
+	ErrInvalidCredentials  = errors.New("invalid credentials for provider")
+	ErrUnsupportedAction   = errors.New("this action is not supported by the provider")
+	// ErrInvalidGrant is returned by RefreshToken when the provider rejected the refresh token for good, usually
+	// because the user revoked access, the account has to be linked again
+	ErrInvalidGrant = errors.New("the provider revoked the grant of this account")
+	// ErrCursorReset is returned when the provider invalidated a sync cursor, the account needs a full sync
+	ErrCursorReset = errors.New("sync cursor was reset")
 )
 
-var OAuthProviders map[string]Provider
+// refreshTokenError marks a refresh the provider answered with invalid_grant as ErrInvalidGrant, retrying it can not
+// succeed.
+func refreshTokenError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+		return fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+	}
+
+	return err
+}
+
+var Providers map[string]Provider
 
 func init() {
-	OAuthProviders = make(map[string]Provider)
-	OAuthProviders[string(repository.ProviderEnumGoogle)] = NewGoogleProvider()
-	OAuthProviders[string(repository.ProviderEnumDropbox)] = NewDropboxProvider()
+	Providers = make(map[string]Provider)
+	Providers[string(repository.ProviderEnumGoogle)] = NewGoogleProvider()
+	Providers[string(repository.ProviderEnumDropbox)] = NewDropboxProvider()
+	Providers[string(repository.ProviderEnumS3)] = NewS3Provider()
+	Providers[string(repository.ProviderEnumWebdav)] = NewWebDAVProvider()
+	Providers[string(repository.ProviderEnumSftp)] = NewSFTPProvider()
+	Providers[string(repository.ProviderEnumAzureBlob)] = NewAzureBlobProvider()
+
+	if config.OAuthConfig.ONEDRIVE.CLIENT_ID != "" {
+		onedriveHTTPClient = newProviderClient(ONEDRIVE_PROVIDER_NAME, config.OAuthConfig.ONEDRIVE.CLIENT_ID)
+		Providers[string(repository.ProviderEnumOnedrive)] = NewOneDriveProvider()
+	}
+
+	if config.OAuthConfig.BOX.CLIENT_ID != "" {
+		boxHTTPClient = newProviderClient(BOX_PROVIDER_NAME, config.OAuthConfig.BOX.CLIENT_ID)
+		Providers[string(repository.ProviderEnumBox)] = NewBoxProvider()
+	}
+}
+
+func GetAuthenticator(name string) (Authenticator, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().OAuth {
+		return nil, false
+	}
+
+	authenticator, ok := provider.(Authenticator)
+	return authenticator, ok
+}
+
+func GetCredentialAuthenticator(name string) (CredentialAuthenticator, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Credentials {
+		return nil, false
+	}
+
+	authenticator, ok := provider.(CredentialAuthenticator)
+	return authenticator, ok
+}
+
+func GetSyncer(name string) (Syncer, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Sync {
+		return nil, false
+	}
+
+	syncer, ok := provider.(Syncer)
+	return syncer, ok
+}
+
+func GetUploader(name string) (Uploader, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Upload {
+		return nil, false
+	}
+
+	uploader, ok := provider.(Uploader)
+	return uploader, ok
+}
+
+func GetDownloader(name string) (Downloader, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Download {
+		return nil, false
+	}
+
+	downloader, ok := provider.(Downloader)
+	return downloader, ok
+}
+
+func GetDeleter(name string) (Deleter, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Delete {
+		return nil, false
+	}
+
+	deleter, ok := provider.(Deleter)
+	return deleter, ok
+}
+
+func GetMover(name string) (Mover, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Move {
+		return nil, false
+	}
+
+	mover, ok := provider.(Mover)
+	return mover, ok
+}
+
+func GetRevoker(name string) (Revoker, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Revoke {
+		return nil, false
+	}
+
+	revoker, ok := provider.(Revoker)
+	return revoker, ok
+}
+
+func GetChangeWatcher(name string) (ChangeWatcher, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Watch {
+		return nil, false
+	}
+
+	watcher, ok := provider.(ChangeWatcher)
+	return watcher, ok
+}
+
+func GetChangePoller(name string) (ChangePoller, bool) {
+	provider, ok := Providers[name]
+	if !ok || !provider.Capabilities().Longpoll {
+		return nil, false
+	}
+
+	poller, ok := provider.(ChangePoller)
+	return poller, ok
 }
 
 func GenerateOauthState(userID string) (string, *OAuthState, error) {
@@ -0,0 +1,91 @@
+//go:build integration
+
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
+)
+
+// Integration tests run with `go test -tags integration ./pkg/providers/...`. Importing the package connects to the
+// Postgres and Redis servers from the environment, so they need the .env of the docker-compose.dev.yml stack, which
+// also runs the MinIO and Azurite containers the tests talk to.
+
+// requireEnv returns the value of every key, the test is skipped when one of them is not set.
+func requireEnv(t *testing.T, keys ...string) []string {
+	t.Helper()
+
+	values := make([]string, len(keys))
+
+	for i, key := range keys {
+		values[i] = os.Getenv(key)
+		if values[i] == "" {
+			t.Skipf("%s is not set", key)
+		}
+	}
+
+	return values
+}
+
+// linkWithCredentials walks the credential linking flow of LinkHandler.linkAccountWithCredentials up to the point the
+// account is stored: decode the request body, validate it and verify it against the remote.
+func linkWithCredentials(t *testing.T, providerName string, body any) (*UserAccountInfo, Account, error) {
+	t.Helper()
+
+	provider, ok := GetCredentialAuthenticator(providerName)
+	if !ok {
+		t.Fatalf("%s is not a credential provider", providerName)
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentials := provider.NewCredentials()
+
+	if err := json.Unmarshal(payload, credentials); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := utils.Validate.Struct(credentials); err != nil {
+		return nil, Account{}, err
+	}
+
+	accountInfo, err := provider.VerifyCredentials(context.Background(), credentials)
+	if err != nil {
+		return nil, Account{}, err
+	}
+
+	// the handler stores the verified credentials, not the raw body, fields filled in by the verification are kept
+	stored, err := json.Marshal(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return accountInfo, Account{ID: accountInfo.ProviderUserID, Tokens: staticTokens{value: string(stored)}}, nil
+}
+
+// collectSync runs a sync and returns every item it emitted keyed by provider file id.
+func collectSync(t *testing.T, syncer Syncer, account Account) map[string]Item {
+	t.Helper()
+
+	items := make(map[string]Item)
+
+	err := syncer.SyncFiles(context.Background(), account, "", func(ctx context.Context, page SyncPage) error {
+		for _, item := range page.Items {
+			items[item.ProviderFileID] = item
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	return items
+}
@@ -0,0 +1,811 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/gorilla/sessions"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"golang.org/x/sync/errgroup"
+)
+
+type OneDriveProvider struct {
+	Config oauth2.Config
+}
+
+type OneDriveAccountInfo struct {
+	ID                string `json:"id"`
+	DisplayName       string `json:"displayName"`
+	Mail              string `json:"mail"`
+	UserPrincipalName string `json:"userPrincipalName"`
+}
+
+type OneDriveItem struct {
+	ID                   string    `json:"id"`
+	Name                 string    `json:"name"`
+	Size                 int64     `json:"size"`
+	WebURL               string    `json:"webUrl"`
+	CreatedDateTime      time.Time `json:"createdDateTime"`
+	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+	DownloadURL          string    `json:"@microsoft.graph.downloadUrl"`
+	ParentReference      struct {
+		ID      string `json:"id"`
+		DriveID string `json:"driveId"`
+		Path    string `json:"path"`
+	} `json:"parentReference"`
+	File *struct {
+		MimeType string `json:"mimeType"`
+		Hashes   struct {
+			SHA256Hash   string `json:"sha256Hash"`
+			QuickXorHash string `json:"quickXorHash"`
+		} `json:"hashes"`
+	} `json:"file"`
+	Folder *struct {
+		ChildCount int `json:"childCount"`
+	} `json:"folder"`
+	Deleted *struct {
+		State string `json:"state"`
+	} `json:"deleted"`
+	Root *struct{} `json:"root"`
+}
+
+type OneDriveDeltaResponse struct {
+	Value     []OneDriveItem `json:"value"`
+	NextLink  string         `json:"@odata.nextLink"`
+	DeltaLink string         `json:"@odata.deltaLink"`
+}
+
+type OneDriveErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// onedriveAPIError is a response graphCallWithRenewal did not get a 2xx for. Code is set when Graph described the
+// error, such as "resyncRequired".
+type onedriveAPIError struct {
+	StatusCode int
+	Code       string
+	Body       string
+}
+
+func (e *onedriveAPIError) Error() string {
+	return e.Body
+}
+
+type OneDriveAuthResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+type OneDriveUploadSessionResponse struct {
+	UploadURL string `json:"uploadUrl"`
+}
+
+const (
+	ONEDRIVE_SESSION_NAME  = "cloudmesh-onedrive-oauth-session"
+	ONEDRIVE_PROVIDER_NAME = string(repository.ProviderEnumOnedrive)
+	ONEDRIVE_GRAPH_URL     = "https://graph.microsoft.com/v1.0"
+	ONEDRIVE_ACCOUNT_URL   = ONEDRIVE_GRAPH_URL + "/me"
+	ONEDRIVE_ROOT_URL      = ONEDRIVE_GRAPH_URL + "/me/drive/root"
+	ONEDRIVE_DELTA_URL     = ONEDRIVE_ROOT_URL + "/delta"
+
+	// files up to this size are sent in a single PUT, larger ones go through an upload session
+	ONEDRIVE_SIMPLE_UPLOAD_LIMIT = 4 * 1024 * 1024
+	// upload session chunks must be a multiple of 320 KiB
+	ONEDRIVE_UPLOAD_CHUNK_SIZE = 320 * 1024 * 32
+)
+
+func NewOneDriveProvider() *OneDriveProvider {
+	return &OneDriveProvider{
+		Config: oauth2.Config{
+			ClientID:     config.OAuthConfig.ONEDRIVE.CLIENT_ID,
+			ClientSecret: config.OAuthConfig.ONEDRIVE.CLIENT_SECRET,
+			Scopes:       strings.Split(config.OAuthConfig.ONEDRIVE.OAUTH_SCOPES, ","),
+			Endpoint:     endpoints.Microsoft,
+			RedirectURL:  config.OAuthConfig.ONEDRIVE.REDIRECT_URI,
+		},
+	}
+}
+
+func (p *OneDriveProvider) GetConsentPageURL(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore, userID string) (string, error) {
+
+	verifier := oauth2.GenerateVerifier()
+
+	encodedState, oauthState, err := GenerateOauthState(userID)
+	if err != nil {
+		config.LOGGER.Error("failed to generated encoded oauthstate", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return "", err
+	}
+
+	session, err := store.Get(r, ONEDRIVE_SESSION_NAME)
+	if err != nil {
+		config.LOGGER.Error("could not get or create session from cookie store", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return "", err
+	}
+
+	session.Values["pkce_verifier_onedrive"] = verifier
+	session.Values["oauth_csrf_token_onedrive"] = oauthState.CsrfToken
+
+	err = session.Save(r, w)
+	if err != nil {
+		config.LOGGER.Error("failed to save session in cookie store", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return "", err
+	}
+
+	url := p.Config.AuthCodeURL(encodedState, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("prompt", "consent"))
+
+	return url, nil
+}
+
+func (p *OneDriveProvider) GetToken(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore) (*oauth2.Token, string, *UserAccountInfo, error) {
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return nil, "", nil, ErrNoCode
+	}
+
+	receivedEncodedState := r.URL.Query().Get("state")
+	if receivedEncodedState == "" {
+		return nil, "", nil, ErrNoState
+	}
+
+	receivedOauthState, err := DecodeOauthState(receivedEncodedState)
+	if err != nil {
+		config.LOGGER.Error("failed to decode received state", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, "", nil, fmt.Errorf("failed to decode received state")
+	}
+
+	session, err := store.Get(r, ONEDRIVE_SESSION_NAME)
+	if err != nil {
+		return nil, "", nil, ErrNoSession
+	}
+
+	storedVerifier, ok := session.Values["pkce_verifier_onedrive"].(string)
+	if !ok || storedVerifier == "" {
+		return nil, "", nil, ErrNoVerifier
+	}
+
+	storedCsrfToken, ok := session.Values["oauth_csrf_token_onedrive"].(string)
+	if !ok || storedCsrfToken == "" {
+		return nil, "", nil, ErrNoState
+	}
+
+	if receivedOauthState.CsrfToken != storedCsrfToken {
+		return nil, "", nil, ErrInvalidState
+	}
+
+	delete(session.Values, "pkce_verifier_onedrive")
+	delete(session.Values, "oauth_csrf_token_onedrive")
+	err = session.Save(r, w)
+	if err != nil {
+		config.LOGGER.Error("failed to cleanup session details", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+	}
+
+	tok, err := p.Config.Exchange(oauthContext(context.Background(), onedriveHTTPClient), code, oauth2.VerifierOption(storedVerifier))
+	if err != nil {
+		config.LOGGER.Error("token exchange failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, "", nil, err
+	}
+
+	accountInfo, err := p.GetAccountInfo(r.Context(), tok)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return tok, receivedOauthState.UserID, accountInfo, nil
+}
+
+func (p *OneDriveProvider) GetAccountInfo(ctx context.Context, token *oauth2.Token) (*UserAccountInfo, error) {
+
+	res, err := p.graphRequest(ctx, http.MethodGet, ONEDRIVE_ACCOUNT_URL, token.AccessToken, nil)
+	if err != nil {
+		config.LOGGER.Error("onedrive /me request failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		config.LOGGER.Error("failed to read response body for /me", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		config.LOGGER.Error("onedrive /me request did not return 200", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+		return nil, fmt.Errorf("%s", string(body[:]))
+	}
+
+	var response OneDriveAccountInfo
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		config.LOGGER.Error("failed to unmarshal response body for /me", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	email := response.Mail
+	if email == "" {
+		email = response.UserPrincipalName
+	}
+
+	userInfo := UserAccountInfo{
+		Provider:       ONEDRIVE_PROVIDER_NAME,
+		ProviderUserID: response.ID,
+		Email:          email,
+		Name:           response.DisplayName,
+	}
+
+	return &userInfo, nil
+}
+
+func (p *OneDriveProvider) Capabilities() Capabilities {
+	return Capabilities{
+		OAuth:           true,
+		Sync:            true,
+		IncrementalSync: true,
+		Upload:          true,
+		Download:        true,
+		Delete:          true,
+		Move:            true,
+	}
+}
+
+// SyncFiles walks the drive delta. cursor holds the delta link returned by the previous sync, it
+// already points at the changes since then. A delta link Graph no longer accepts is reported as ErrCursorReset.
+func (p *OneDriveProvider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
+
+	totalItemCount := 0
+
+	deltaURL := ONEDRIVE_DELTA_URL
+	if cursor != "" {
+		deltaURL = cursor
+	}
+
+	rootID, err := p.getRootID(ctx, account)
+	if err != nil {
+		config.LOGGER.Error("failed to fetch onedrive root folder", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return err
+	}
+
+	for {
+		page := SyncPage{}
+
+		deltaResponse, err := p.getDelta(ctx, account, deltaURL)
+		if err != nil {
+			config.LOGGER.Error("request failed to fetch onedrive delta", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+			return err
+		}
+
+		for _, item := range deltaResponse.Value {
+
+			if item.Root != nil {
+				continue
+			}
+
+			if item.Deleted != nil {
+				page.DeletedIDs = append(page.DeletedIDs, item.ID)
+				continue
+			}
+
+			page.Items = append(page.Items, p.toItem(rootID, item))
+		}
+
+		// the delta link is only returned on the last page, every other page continues from the next link
+		page.Cursor = deltaResponse.NextLink
+		if page.Cursor == "" {
+			page.Cursor = deltaResponse.DeltaLink
+		}
+
+		if err := emit(ctx, page); err != nil {
+			return err
+		}
+
+		totalItemCount += len(page.Items)
+
+		if deltaResponse.NextLink == "" {
+			break
+		}
+
+		deltaURL = deltaResponse.NextLink
+	}
+
+	config.LOGGER.Info("OneDrive sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
+
+	return nil
+}
+
+func (p *OneDriveProvider) toItem(rootID string, item OneDriveItem) Item {
+	ext := filepath.Ext(item.Name)
+
+	mimeType := mime.TypeByExtension(ext)
+	contentHash := ""
+
+	if item.File != nil {
+		if item.File.MimeType != "" {
+			mimeType = item.File.MimeType
+		}
+		contentHash = item.File.Hashes.SHA256Hash
+		if contentHash == "" {
+			contentHash = item.File.Hashes.QuickXorHash
+		}
+	}
+
+	parentFolder := "/"
+
+	if item.ParentReference.ID != "" && item.ParentReference.ID != rootID {
+		parentFolder = item.ParentReference.ID
+	}
+
+	return Item{
+		ProviderFileID: item.ID,
+		Name:           item.Name,
+		Extension:      ext,
+		Size:           item.Size,
+		MimeType:       mimeType,
+		ParentFolder:   parentFolder,
+		IsFolder:       item.Folder != nil,
+		ContentHash:    contentHash,
+		CreatedTime:    item.CreatedDateTime,
+		ModifiedTime:   item.LastModifiedDateTime,
+		WebViewLink:    item.WebURL,
+	}
+}
+
+func (p *OneDriveProvider) getRootID(ctx context.Context, account Account) (string, error) {
+	body, err := p.graphCallWithRenewal(ctx, account, http.MethodGet, ONEDRIVE_ROOT_URL+"?$select=id", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var root OneDriveItem
+
+	if err := json.Unmarshal(body, &root); err != nil {
+		return "", err
+	}
+
+	return root.ID, nil
+}
+
+func (p *OneDriveProvider) getDelta(ctx context.Context, account Account, deltaURL string) (*OneDriveDeltaResponse, error) {
+	body, err := p.graphCallWithRenewal(ctx, account, http.MethodGet, deltaURL, nil)
+	if err != nil {
+		// an expired delta token is answered with 410 Gone, the drive has to be enumerated from scratch
+		var apiErr *onedriveAPIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusGone || strings.HasPrefix(apiErr.Code, "resync")) {
+			return nil, ErrCursorReset
+		}
+
+		return nil, err
+	}
+
+	var deltaResponse OneDriveDeltaResponse
+
+	err = json.Unmarshal(body, &deltaResponse)
+
+	return &deltaResponse, err
+}
+
+// graphCallWithRenewal performs a request against the Graph API, renewing the access token once if it has expired.
+func (p *OneDriveProvider) graphCallWithRenewal(ctx context.Context, account Account, method, reqURL string, reqBody []byte) ([]byte, error) {
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if reqBody != nil {
+			body = bytes.NewReader(reqBody)
+		}
+
+		res, err := p.graphRequest(ctx, method, reqURL, accessToken, body)
+		if err != nil {
+			config.LOGGER.Error("http request to onedrive failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("method", method), zap.Error(err))
+			return nil, err
+		}
+
+		resBody, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			config.LOGGER.Error("failed to read http response body from onedrive", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("method", method), zap.Error(err))
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			config.LOGGER.Warn("access token expired, attempting to renew", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("account_id", account.ID))
+
+			accessToken, err = account.Tokens.Renew(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			config.LOGGER.Error("http request to onedrive did not return 2xx", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("method", method), zap.Int("status_code", res.StatusCode))
+			apiErr := &onedriveAPIError{StatusCode: res.StatusCode, Body: string(resBody)}
+
+			var onedriveError OneDriveErrorResponse
+			if json.Unmarshal(resBody, &onedriveError) == nil {
+				apiErr.Code = onedriveError.Error.Code
+			}
+
+			return nil, apiErr
+		}
+
+		return resBody, nil
+	}
+}
+
+func (p *OneDriveProvider) graphRequest(ctx context.Context, method, reqURL, accessToken string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		config.LOGGER.Error("failed to initiate new HTTP request", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("method", method), zap.Error(err))
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return onedriveHTTPClient.Do(req)
+}
+
+// RefreshToken is done by hand rather than through oauth2.Config because the microsoft identity
+// platform expects the scopes to be sent along with the refresh token.
+func (p *OneDriveProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	data := url.Values{}
+
+	data.Add("grant_type", "refresh_token")
+	data.Add("refresh_token", refreshToken)
+	data.Add("client_id", p.Config.ClientID)
+	data.Add("client_secret", p.Config.ClientSecret)
+	data.Add("scope", strings.Join(p.Config.Scopes, " "))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Config.Endpoint.TokenURL, bytes.NewBufferString(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := onedriveHTTPClient.Do(req)
+	if err != nil {
+		config.LOGGER.Error("http request for onedrive token renewal failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		config.LOGGER.Error("failed to read http response body for onedrive token renewal", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		config.LOGGER.Error("http request for onedrive token renewal did not return 200", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+
+		var errorResponse struct {
+			Error string `json:"error"`
+		}
+
+		if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error == "invalid_grant" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidGrant, string(body[:]))
+		}
+
+		return nil, fmt.Errorf("%s", string(body[:]))
+	}
+
+	var onedriveResponse OneDriveAuthResponse
+
+	if err := json.Unmarshal(body, &onedriveResponse); err != nil {
+		config.LOGGER.Error("failed to unmarshal onedrive token renew response", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	// microsoft rotates refresh tokens, the caller replaces the stored one whenever a new one is issued
+	return &oauth2.Token{
+		AccessToken:  onedriveResponse.AccessToken,
+		RefreshToken: onedriveResponse.RefreshToken,
+		TokenType:    onedriveResponse.TokenType,
+		Expiry:       time.Now().Add(time.Duration(onedriveResponse.ExpiresIn) * time.Second),
+	}, nil
+}
+
+func (p *OneDriveProvider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []*OneDriveItem
+		g, _    = errgroup.WithContext(ctx)
+		sem     = make(chan struct{}, 10)
+	)
+
+	for _, f := range uploadedFiles {
+		file := f
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			uploadedFile, err := p.uploadToOneDrive(ctx, accessToken, file)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			results = append(results, uploadedFile)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	rootID, err := p.getRootID(ctx, account)
+	if err != nil {
+		config.LOGGER.Error("failed to fetch onedrive root folder", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(results))
+
+	for _, r := range results {
+		items = append(items, p.toItem(rootID, *r))
+	}
+
+	return items, nil
+}
+
+func (p *OneDriveProvider) uploadToOneDrive(ctx context.Context, accessToken string, file middlewares.UploadedFile) (*OneDriveItem, error) {
+	itemPath := fmt.Sprintf("%s:/%s:", ONEDRIVE_ROOT_URL, url.PathEscape(file.FileHeader.Filename))
+
+	if file.FileHeader.Size <= ONEDRIVE_SIMPLE_UPLOAD_LIMIT {
+		return p.simpleUpload(ctx, accessToken, itemPath, file)
+	}
+
+	return p.sessionUpload(ctx, accessToken, itemPath, file)
+}
+
+func (p *OneDriveProvider) simpleUpload(ctx context.Context, accessToken, itemPath string, file middlewares.UploadedFile) (*OneDriveItem, error) {
+	reqURL := fmt.Sprintf("%s/content?@microsoft.graph.conflictBehavior=rename", itemPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, reqURL, file.File)
+	if err != nil {
+		config.LOGGER.Error("failed to create new request to upload files to onedrive", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Content-Type", file.ContentType)
+	req.ContentLength = file.FileHeader.Size
+
+	res, err := onedriveHTTPClient.Do(req)
+	if err != nil {
+		config.LOGGER.Error("http request to upload file to onedrive failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return p.decodeUploadResponse(res, file)
+}
+
+func (p *OneDriveProvider) sessionUpload(ctx context.Context, accessToken, itemPath string, file middlewares.UploadedFile) (*OneDriveItem, error) {
+	sessionBody := []byte(`{"item": {"@microsoft.graph.conflictBehavior": "rename"}}`)
+
+	res, err := p.graphRequest(ctx, http.MethodPost, fmt.Sprintf("%s/createUploadSession", itemPath), accessToken, bytes.NewReader(sessionBody))
+	if err != nil {
+		config.LOGGER.Error("http request to create onedrive upload session failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		config.LOGGER.Error("failed to read http response body for onedrive upload session", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		config.LOGGER.Error("http request to create onedrive upload session did not return 200", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+		return nil, fmt.Errorf("%s", string(body[:]))
+	}
+
+	var uploadSession OneDriveUploadSessionResponse
+
+	if err := json.Unmarshal(body, &uploadSession); err != nil {
+		config.LOGGER.Error("failed to unmarshal onedrive upload session response", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	totalSize := file.FileHeader.Size
+
+	for offset := int64(0); offset < totalSize; offset += ONEDRIVE_UPLOAD_CHUNK_SIZE {
+		chunkSize := min(int64(ONEDRIVE_UPLOAD_CHUNK_SIZE), totalSize-offset)
+
+		// the upload url is pre-authenticated, sending the bearer token along is rejected by graph
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadSession.UploadURL, io.NewSectionReader(file.File, offset, chunkSize))
+		if err != nil {
+			config.LOGGER.Error("failed to create new request to upload chunk to onedrive", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		req.ContentLength = chunkSize
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+chunkSize-1, totalSize))
+
+		res, err := onedriveHTTPClient.Do(req)
+		if err != nil {
+			config.LOGGER.Error("http request to upload chunk to onedrive failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		if offset+chunkSize < totalSize {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+
+			if res.StatusCode != http.StatusAccepted {
+				config.LOGGER.Error("http request to upload chunk to onedrive did not return 202", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+				return nil, fmt.Errorf("upload failed for file '%s' at offset %d", file.FileHeader.Filename, offset)
+			}
+
+			continue
+		}
+
+		defer res.Body.Close()
+
+		return p.decodeUploadResponse(res, file)
+	}
+
+	return nil, fmt.Errorf("upload failed for file '%s': empty file", file.FileHeader.Filename)
+}
+
+func (p *OneDriveProvider) decodeUploadResponse(res *http.Response, file middlewares.UploadedFile) (*OneDriveItem, error) {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		config.LOGGER.Error("failed to read http response body for onedrive file upload", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		config.LOGGER.Error("http request to upload file to onedrive failed with non-2xx status", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("file", file.FileHeader.Filename), zap.Int("status_code", res.StatusCode))
+		return nil, fmt.Errorf("http request to upload file to onedrive failed with non-2xx status")
+	}
+
+	var response OneDriveItem
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		config.LOGGER.Error("failed to unmarshal json response for onedrive file upload response", zap.Error(err))
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// DownloadFile follows the content endpoint's redirect to a pre-authenticated download url.
+func (p *OneDriveProvider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	accessToken, err := account.Tokens.AccessToken(ctx)
+	if err != nil {
+		config.LOGGER.Error("could not get access token", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, err
+	}
+
+	reqURL := fmt.Sprintf("%s/me/drive/items/%s/content", ONEDRIVE_GRAPH_URL, url.PathEscape(item.ProviderFileID))
+
+	for attempt := 0; ; attempt++ {
+		res, err := p.graphRequest(ctx, http.MethodGet, reqURL, accessToken, nil)
+		if err != nil {
+			config.LOGGER.Error("http request to download file from onedrive failed", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Error(err))
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			res.Body.Close()
+
+			accessToken, err = account.Tokens.Renew(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			config.LOGGER.Error("http request to download file from onedrive did not return 200", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.Int("status_code", res.StatusCode))
+			return nil, fmt.Errorf("%s", string(body))
+		}
+
+		return &Download{
+			Body:        res.Body,
+			Name:        item.Name,
+			ContentType: res.Header.Get("Content-Type"),
+			Size:        res.ContentLength,
+		}, nil
+	}
+}
+
+func (p *OneDriveProvider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	reqURL := fmt.Sprintf("%s/me/drive/items/%s", ONEDRIVE_GRAPH_URL, url.PathEscape(item.ProviderFileID))
+
+	if _, err := p.graphCallWithRenewal(ctx, account, http.MethodDelete, reqURL, nil); err != nil {
+		config.LOGGER.Error("failed to delete onedrive item", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (p *OneDriveProvider) MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error) {
+	patch := map[string]any{}
+
+	if name != "" {
+		patch["name"] = name
+	}
+
+	rootID, err := p.getRootID(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID == "/" {
+		parentID = rootID
+	}
+
+	if parentID != "" {
+		patch["parentReference"] = map[string]string{"id": parentID}
+	}
+
+	reqBody, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	reqURL := fmt.Sprintf("%s/me/drive/items/%s", ONEDRIVE_GRAPH_URL, url.PathEscape(item.ProviderFileID))
+
+	body, err := p.graphCallWithRenewal(ctx, account, http.MethodPatch, reqURL, reqBody)
+	if err != nil {
+		config.LOGGER.Error("failed to move onedrive item", zap.String("provider", ONEDRIVE_PROVIDER_NAME), zap.String("file_id", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	var movedItem OneDriveItem
+
+	if err := json.Unmarshal(body, &movedItem); err != nil {
+		return nil, err
+	}
+
+	moved := p.toItem(rootID, movedItem)
+
+	return &moved, nil
+}
@@ -0,0 +1,67 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestOneDriveSyncFilesCursorReset(t *testing.T) {
+	const deltaLink = ONEDRIVE_DELTA_URL + "?token=fresh"
+
+	if onedriveHTTPClient == nil {
+		onedriveHTTPClient = newProviderClient(ONEDRIVE_PROVIDER_NAME, "")
+		t.Cleanup(func() {
+			onedriveHTTPClient = nil
+		})
+	}
+
+	serveProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/v1.0/me/drive/root":
+			io.WriteString(w, `{"id": "root"}`)
+		case r.URL.Path == "/v1.0/me/drive/root/delta" && r.URL.Query().Get("token") == "stale":
+			w.WriteHeader(http.StatusGone)
+			io.WriteString(w, `{"error": {"code": "resyncRequired", "message": "Resync required."}}`)
+		case r.URL.Path == "/v1.0/me/drive/root/delta" && r.URL.RawQuery == "":
+			json.NewEncoder(w).Encode(OneDriveDeltaResponse{
+				Value:     []OneDriveItem{{ID: "root", Root: &struct{}{}}, {ID: "a", Name: "a.txt"}},
+				DeltaLink: deltaLink,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}), onedriveHTTPClient)
+
+	p := NewOneDriveProvider()
+	account := Account{ID: "account", Tokens: staticTokens{value: "token"}}
+
+	var pages []SyncPage
+	emit := func(ctx context.Context, page SyncPage) error {
+		pages = append(pages, page)
+		return nil
+	}
+
+	err := p.SyncFiles(context.Background(), account, ONEDRIVE_DELTA_URL+"?token=stale", emit)
+	if !errors.Is(err, ErrCursorReset) {
+		t.Fatalf("SyncFiles with an expired delta link returned %v, want ErrCursorReset", err)
+	}
+
+	if len(pages) != 0 {
+		t.Fatalf("SyncFiles emitted %d pages for an expired delta link", len(pages))
+	}
+
+	// the full sync the catalog starts over with enumerates the drive from the plain delta url
+	if err := p.SyncFiles(context.Background(), account, "", emit); err != nil {
+		t.Fatalf("full SyncFiles failed: %v", err)
+	}
+
+	if len(pages) != 1 || pages[0].Cursor != deltaLink || len(pages[0].Items) != 1 || pages[0].Items[0].ProviderFileID != "a" {
+		t.Fatalf("full SyncFiles emitted %+v", pages)
+	}
+}
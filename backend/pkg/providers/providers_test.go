@@ -0,0 +1,75 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// staticTokens hands out fixed credentials, the way tokens.AccountTokens does for a linked credential account.
+type staticTokens struct {
+	value string
+}
+
+func (t staticTokens) AccessToken(ctx context.Context) (string, error) {
+	return t.value, nil
+}
+
+func (t staticTokens) Renew(ctx context.Context) (string, error) {
+	return t.value, nil
+}
+
+func (t staticTokens) RefreshToken(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// redirectTransport sends every request to the test server, the path and the Host header stay as they were so a
+// handler can still tell the APIs of a provider apart.
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+
+	return t.base.RoundTrip(req)
+}
+
+// serveProvider starts handler and points clients at it for the duration of the test. Provider clients keep their
+// retries but skip the rate limit, which needs Redis.
+func serveProvider(t *testing.T, handler http.Handler, clients ...*http.Client) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, client := range clients {
+		if transport, ok := client.Transport.(*providerTransport); ok {
+			base, rate := transport.base, transport.rate
+			transport.base, transport.rate = redirectTransport{target: target, base: server.Client().Transport}, 0
+
+			t.Cleanup(func() {
+				transport.base, transport.rate = base, rate
+			})
+
+			continue
+		}
+
+		transport := client.Transport
+		client.Transport = redirectTransport{target: target, base: server.Client().Transport}
+
+		t.Cleanup(func() {
+			client.Transport = transport
+		})
+	}
+}
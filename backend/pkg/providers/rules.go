@@ -0,0 +1,232 @@
+package providers
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	SYNC_RULE_INCLUDE = "include"
+	SYNC_RULE_EXCLUDE = "exclude"
+
+	SYNC_RULE_PATH      = "path"
+	SYNC_RULE_ID        = "id"
+	SYNC_RULE_NAME      = "name"
+	SYNC_RULE_EXTENSION = "extension"
+)
+
+// SyncRule is one include or exclude rule of an account. Path and id rules select folders along with everything below
+// them, name and extension rules are glob patterns matched against file names only.
+type SyncRule struct {
+	Action  string
+	Type    string
+	Pattern string
+}
+
+// SyncRules decides which items of a sync are stored. Excludes always win, include rules of a kind only let through
+// what they match. Folders leading to an included folder are kept so the included folder stays reachable.
+//
+// Id rules are resolved by the provider, Dropbox turns them into paths while Google matches folder ids itself.
+type SyncRules struct {
+	includePaths      []string
+	excludePaths      []string
+	includeIDs        []string
+	excludeIDs        []string
+	includeNames      []string
+	excludeNames      []string
+	includeExtensions []string
+	excludeExtensions []string
+
+	restrictFolders bool
+}
+
+// NewSyncRules compiles the rules of an account, no rules returns nil which lets everything through.
+func NewSyncRules(rules []SyncRule) *SyncRules {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	r := &SyncRules{}
+
+	for _, rule := range rules {
+		include := rule.Action == SYNC_RULE_INCLUDE
+
+		switch rule.Type {
+		case SYNC_RULE_PATH:
+			p := normalizeRulePath(rule.Pattern)
+			if include {
+				r.includePaths = append(r.includePaths, p)
+			} else {
+				r.excludePaths = append(r.excludePaths, p)
+			}
+		case SYNC_RULE_ID:
+			if include {
+				r.includeIDs = append(r.includeIDs, rule.Pattern)
+			} else {
+				r.excludeIDs = append(r.excludeIDs, rule.Pattern)
+			}
+		case SYNC_RULE_NAME:
+			if include {
+				r.includeNames = append(r.includeNames, strings.ToLower(rule.Pattern))
+			} else {
+				r.excludeNames = append(r.excludeNames, strings.ToLower(rule.Pattern))
+			}
+		case SYNC_RULE_EXTENSION:
+			extension := strings.ToLower(strings.TrimPrefix(rule.Pattern, "."))
+			if include {
+				r.includeExtensions = append(r.includeExtensions, extension)
+			} else {
+				r.excludeExtensions = append(r.excludeExtensions, extension)
+			}
+		}
+	}
+
+	r.restrictFolders = len(r.includePaths) > 0 || len(r.includeIDs) > 0
+
+	return r
+}
+
+// Paths returns the folder paths of the rules, lower cased and without trailing slash. The root is the empty string.
+func (r *SyncRules) Paths() (include, exclude []string) {
+	if r == nil {
+		return nil, nil
+	}
+
+	return r.includePaths, r.excludePaths
+}
+
+// IDs returns the folder ids of the rules.
+func (r *SyncRules) IDs() (include, exclude []string) {
+	if r == nil {
+		return nil, nil
+	}
+
+	return r.includeIDs, r.excludeIDs
+}
+
+// RestrictsFolders reports whether only included folders are synced.
+func (r *SyncRules) RestrictsFolders() bool {
+	return r != nil && r.restrictFolders
+}
+
+// WithResolvedIDs returns a copy of the rules with the id rules replaced by the paths they resolved to. Ids missing
+// from paths are dropped, an include rule that no longer resolves still keeps everything else out.
+func (r *SyncRules) WithResolvedIDs(paths map[string]string) *SyncRules {
+	if r == nil {
+		return nil
+	}
+
+	resolved := *r
+	resolved.includeIDs, resolved.excludeIDs = nil, nil
+	resolved.includePaths = append([]string(nil), r.includePaths...)
+	resolved.excludePaths = append([]string(nil), r.excludePaths...)
+
+	for _, id := range r.includeIDs {
+		if p, ok := paths[id]; ok {
+			resolved.includePaths = append(resolved.includePaths, normalizeRulePath(p))
+		}
+	}
+
+	for _, id := range r.excludeIDs {
+		if p, ok := paths[id]; ok {
+			resolved.excludePaths = append(resolved.excludePaths, normalizeRulePath(p))
+		}
+	}
+
+	return &resolved
+}
+
+// AllowsPath reports whether the folder rules let the item at p through.
+func (r *SyncRules) AllowsPath(p string, isFolder bool) bool {
+	if r == nil {
+		return true
+	}
+
+	p = normalizeRulePath(p)
+
+	for _, excluded := range r.excludePaths {
+		if isBelow(p, excluded) {
+			return false
+		}
+	}
+
+	if !r.restrictFolders {
+		return true
+	}
+
+	for _, included := range r.includePaths {
+		if isBelow(p, included) || (isFolder && isBelow(included, p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsName reports whether the name and extension rules let the item through, folders are never filtered by name.
+func (r *SyncRules) AllowsName(name string, isFolder bool) bool {
+	if r == nil || isFolder {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	extension := strings.TrimPrefix(path.Ext(name), ".")
+
+	for _, pattern := range r.excludeNames {
+		if matchGlob(pattern, name) {
+			return false
+		}
+	}
+
+	for _, pattern := range r.excludeExtensions {
+		if extension != "" && matchGlob(pattern, extension) {
+			return false
+		}
+	}
+
+	if len(r.includeNames) == 0 && len(r.includeExtensions) == 0 {
+		return true
+	}
+
+	for _, pattern := range r.includeNames {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+
+	for _, pattern := range r.includeExtensions {
+		if extension != "" && matchGlob(pattern, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidSyncRulePattern reports whether pattern is usable for a rule of the given type.
+func ValidSyncRulePattern(ruleType, pattern string) bool {
+	switch ruleType {
+	case SYNC_RULE_PATH:
+		return strings.HasPrefix(pattern, "/")
+	case SYNC_RULE_NAME, SYNC_RULE_EXTENSION:
+		_, err := path.Match(pattern, "")
+		return err == nil
+	default:
+		return pattern != ""
+	}
+}
+
+// normalizeRulePath lower cases p and strips the trailing slash, the root becomes the empty string.
+func normalizeRulePath(p string) string {
+	return strings.TrimRight(strings.ToLower(path.Clean("/"+p)), "/")
+}
+
+// isBelow reports whether p is folder or lies below it.
+func isBelow(p, folder string) bool {
+	return p == folder || strings.HasPrefix(p, folder+"/")
+}
+
+func matchGlob(pattern, name string) bool {
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
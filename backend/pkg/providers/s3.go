@@ -0,0 +1,385 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+type S3Provider struct{}
+
+type S3Credentials struct {
+	Endpoint        string `validate:"required,url" json:"endpoint"`
+	Region          string `validate:"omitempty" json:"region"`
+	Bucket          string `validate:"required" json:"bucket"`
+	AccessKeyID     string `validate:"required" json:"access_key_id"`
+	SecretAccessKey string `validate:"required" json:"secret_access_key"`
+}
+
+const (
+	S3_PROVIDER_NAME   = string(repository.ProviderEnumS3)
+	S3_SYNC_BATCH_SIZE = 1000
+)
+
+func NewS3Provider() *S3Provider {
+	return &S3Provider{}
+}
+
+func (p *S3Provider) NewCredentials() any {
+	return &S3Credentials{}
+}
+
+func (p *S3Provider) VerifyCredentials(ctx context.Context, creds any) (*UserAccountInfo, error) {
+	s3Credentials, ok := creds.(*S3Credentials)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	client, err := p.newClient(s3Credentials)
+	if err != nil {
+		config.LOGGER.Error("failed to create s3 client", zap.String("provider", S3_PROVIDER_NAME), zap.Error(err))
+		return nil, ErrInvalidCredentials
+	}
+
+	exists, err := client.BucketExists(ctx, s3Credentials.Bucket)
+	if err != nil {
+		config.LOGGER.Error("failed to verify s3 bucket", zap.String("provider", S3_PROVIDER_NAME), zap.String("bucket", s3Credentials.Bucket), zap.Error(err))
+		return nil, ErrInvalidCredentials
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("bucket '%s' does not exist", s3Credentials.Bucket)
+	}
+
+	endpoint, _ := url.Parse(s3Credentials.Endpoint)
+
+	return &UserAccountInfo{
+		Provider:       S3_PROVIDER_NAME,
+		ProviderUserID: fmt.Sprintf("%s/%s", endpoint.Host, s3Credentials.Bucket),
+		Email:          endpoint.Host,
+		Name:           s3Credentials.Bucket,
+	}, nil
+}
+
+func (p *S3Provider) newClient(creds *S3Credentials) (*minio.Client, error) {
+	endpoint, err := url.Parse(creds.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(creds.AccessKeyID, creds.SecretAccessKey, ""),
+		Secure: endpoint.Scheme == "https",
+		Region: creds.Region,
+	})
+}
+
+func (p *S3Provider) Capabilities() Capabilities {
+	return Capabilities{
+		Credentials: true,
+		Sync:        true,
+		Upload:      true,
+		Download:    true,
+		Delete:      true,
+		Move:        true,
+	}
+}
+
+func (p *S3Provider) clientForAccount(ctx context.Context, account Account) (*minio.Client, *S3Credentials, error) {
+	var s3Credentials S3Credentials
+
+	if err := account.credentials(ctx, &s3Credentials); err != nil {
+		config.LOGGER.Error("could not decrypt credentials", zap.String("provider", S3_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	client, err := p.newClient(&s3Credentials)
+	if err != nil {
+		config.LOGGER.Error("failed to create s3 client", zap.String("provider", S3_PROVIDER_NAME), zap.Error(err))
+		return nil, nil, err
+	}
+
+	return client, &s3Credentials, nil
+}
+
+// SyncFiles lists the whole bucket, s3 has no change feed to resume from.
+func (p *S3Provider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
+
+	client, s3Credentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		items          []Item
+		seenFolders    = make(map[string]bool)
+		totalItemCount = 0
+	)
+
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+
+		if err := emit(ctx, SyncPage{Items: items}); err != nil {
+			return err
+		}
+
+		totalItemCount += len(items)
+
+		items = []Item{}
+
+		return nil
+	}
+
+	for object := range client.ListObjects(listCtx, s3Credentials.Bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			config.LOGGER.Error("an error occured while listing s3 objects", zap.String("provider", S3_PROVIDER_NAME), zap.String("bucket", s3Credentials.Bucket), zap.Error(object.Err))
+			return object.Err
+		}
+
+		// prefixes are not real objects in s3, every ancestor of a key is surfaced as a folder
+		for _, prefix := range s3FolderPrefixes(object.Key) {
+			if seenFolders[prefix] {
+				continue
+			}
+
+			seenFolders[prefix] = true
+
+			items = append(items, p.toFolderItem(prefix))
+		}
+
+		if !strings.HasSuffix(object.Key, "/") {
+			items = append(items, p.toItem(object.Key, object.Size, object.ETag, object.LastModified))
+		}
+
+		if len(items) >= S3_SYNC_BATCH_SIZE {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	config.LOGGER.Info("S3 sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
+
+	return nil
+}
+
+func (p *S3Provider) toItem(key string, size int64, etag string, modifiedTime time.Time) Item {
+	name := path.Base(key)
+	ext := filepath.Ext(name)
+
+	return Item{
+		ProviderFileID: key,
+		Name:           name,
+		Extension:      ext,
+		Size:           size,
+		MimeType:       mime.TypeByExtension(ext),
+		ParentFolder:   objectParentFolder(key),
+		IsFolder:       false,
+		ContentHash:    strings.Trim(etag, "\""),
+		ModifiedTime:   modifiedTime,
+	}
+}
+
+func (p *S3Provider) toFolderItem(prefix string) Item {
+	return Item{
+		ProviderFileID: prefix,
+		Name:           path.Base(strings.TrimSuffix(prefix, "/")),
+		ParentFolder:   objectParentFolder(prefix),
+		IsFolder:       true,
+	}
+}
+
+// s3FolderPrefixes returns every "directory" prefix of a key, e.g. "a/b/c.txt" yields "a/" and "a/b/".
+func s3FolderPrefixes(key string) []string {
+	var prefixes []string
+
+	for i, c := range key {
+		if c == '/' {
+			prefixes = append(prefixes, key[:i+1])
+		}
+	}
+
+	return prefixes
+}
+
+// objectParentFolder maps a key to the prefix of its parent folder item, e.g. "a/b/c.txt" becomes "a/b/". Keys
+// without a parent prefix sit at the root.
+func objectParentFolder(key string) string {
+	parent := path.Dir(strings.TrimSuffix(key, "/"))
+
+	if parent == "." {
+		return "/"
+	}
+
+	return parent + "/"
+}
+
+func (p *S3Provider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
+	client, s3Credentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []Item
+		g, _    = errgroup.WithContext(ctx)
+		sem     = make(chan struct{}, 10)
+	)
+
+	for _, f := range uploadedFiles {
+		file := f
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			uploadInfo, err := client.PutObject(ctx, s3Credentials.Bucket, file.FileHeader.Filename, file.File, file.FileHeader.Size, minio.PutObjectOptions{
+				ContentType: file.ContentType,
+			})
+
+			if err != nil {
+				config.LOGGER.Error("upload failed", zap.String("file", file.FileHeader.Filename), zap.String("provider", S3_PROVIDER_NAME), zap.Error(err))
+				return fmt.Errorf("upload failed for file '%s': %v", file.FileHeader.Filename, err)
+			}
+
+			modifiedTime := uploadInfo.LastModified
+			if modifiedTime.IsZero() {
+				modifiedTime = time.Now()
+			}
+
+			mu.Lock()
+			results = append(results, p.toItem(uploadInfo.Key, uploadInfo.Size, uploadInfo.ETag, modifiedTime))
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// putting an existing key overwrites the object, the caller replaces the row for the previous version
+	return results, nil
+}
+
+func (p *S3Provider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	client, s3Credentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObject(ctx, s3Credentials.Bucket, item.ProviderFileID, minio.GetObjectOptions{})
+	if err != nil {
+		config.LOGGER.Error("failed to get s3 object", zap.String("provider", S3_PROVIDER_NAME), zap.String("key", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	// GetObject is lazy, Stat performs the request and surfaces a missing key before anything is streamed
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		config.LOGGER.Error("failed to stat s3 object", zap.String("provider", S3_PROVIDER_NAME), zap.String("key", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	return &Download{
+		Body:        object,
+		Name:        item.Name,
+		ContentType: info.ContentType,
+		Size:        info.Size,
+	}, nil
+}
+
+// DeleteFile removes an object, or every object under the prefix when item is a folder.
+func (p *S3Provider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	client, s3Credentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if !item.IsFolder {
+		err := client.RemoveObject(ctx, s3Credentials.Bucket, item.ProviderFileID, minio.RemoveObjectOptions{})
+		if err != nil {
+			config.LOGGER.Error("failed to remove s3 object", zap.String("provider", S3_PROVIDER_NAME), zap.String("key", item.ProviderFileID), zap.Error(err))
+		}
+		return err
+	}
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := client.ListObjects(listCtx, s3Credentials.Bucket, minio.ListObjectsOptions{Prefix: item.ProviderFileID, Recursive: true})
+
+	for removeErr := range client.RemoveObjects(ctx, s3Credentials.Bucket, objects, minio.RemoveObjectsOptions{}) {
+		config.LOGGER.Error("failed to remove s3 object", zap.String("provider", S3_PROVIDER_NAME), zap.String("key", removeErr.ObjectName), zap.Error(removeErr.Err))
+		return removeErr.Err
+	}
+
+	return nil
+}
+
+// MoveFile copies the object to its new key and removes the old one. Folders would mean copying
+// every object under the prefix one by one, so only files can be moved.
+func (p *S3Provider) MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error) {
+	if item.IsFolder {
+		return nil, ErrUnsupportedAction
+	}
+
+	client, s3Credentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimPrefix(objectParentFolder(item.ProviderFileID), "/")
+
+	if parentID == "/" {
+		prefix = ""
+	} else if parentID != "" {
+		prefix = parentID
+	}
+
+	if name == "" {
+		name = item.Name
+	}
+
+	key := prefix + name
+
+	uploadInfo, err := client.CopyObject(ctx, minio.CopyDestOptions{Bucket: s3Credentials.Bucket, Object: key}, minio.CopySrcOptions{Bucket: s3Credentials.Bucket, Object: item.ProviderFileID})
+	if err != nil {
+		config.LOGGER.Error("failed to copy s3 object", zap.String("provider", S3_PROVIDER_NAME), zap.String("key", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	if err := client.RemoveObject(ctx, s3Credentials.Bucket, item.ProviderFileID, minio.RemoveObjectOptions{}); err != nil {
+		config.LOGGER.Error("failed to remove s3 object", zap.String("provider", S3_PROVIDER_NAME), zap.String("key", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	movedItem := p.toItem(key, item.Size, uploadInfo.ETag, uploadInfo.LastModified)
+
+	return &movedItem, nil
+}
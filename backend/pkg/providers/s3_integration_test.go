@@ -0,0 +1,187 @@
+//go:build integration
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// The S3 tests run against the minio service of docker-compose.dev.yml, e.g.
+//
+//	S3_TEST_ENDPOINT=http://127.0.0.1:9000 S3_TEST_ACCESS_KEY_ID=cloudmesh S3_TEST_SECRET_ACCESS_KEY=cloudmesh-secret
+
+// newS3TestBucket creates an empty bucket that is removed along with its objects when the test ends.
+func newS3TestBucket(t *testing.T) (*minio.Client, map[string]any) {
+	t.Helper()
+
+	env := requireEnv(t, "S3_TEST_ENDPOINT", "S3_TEST_ACCESS_KEY_ID", "S3_TEST_SECRET_ACCESS_KEY")
+
+	endpoint, err := url.Parse(env[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(env[1], env[2], ""),
+		Secure: endpoint.Scheme == "https",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	bucket := fmt.Sprintf("cloudmesh-test-%d", time.Now().UnixNano())
+
+	if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		for object := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+			if object.Err == nil {
+				client.RemoveObject(ctx, bucket, object.Key, minio.RemoveObjectOptions{})
+			}
+		}
+		client.RemoveBucket(ctx, bucket)
+	})
+
+	return client, map[string]any{
+		"endpoint":          env[0],
+		"bucket":            bucket,
+		"access_key_id":     env[1],
+		"secret_access_key": env[2],
+	}
+}
+
+func putS3TestObject(t *testing.T, client *minio.Client, bucket, key, content string) {
+	t.Helper()
+
+	_, err := client.PutObject(context.Background(), bucket, key, bytes.NewReader([]byte(content)), int64(len(content)), minio.PutObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3LinkWithCredentials(t *testing.T) {
+	_, body := newS3TestBucket(t)
+
+	accountInfo, _, err := linkWithCredentials(t, S3_PROVIDER_NAME, body)
+	if err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	endpoint, _ := url.Parse(body["endpoint"].(string))
+
+	if want := endpoint.Host + "/" + body["bucket"].(string); accountInfo.ProviderUserID != want {
+		t.Errorf("provider user id = %q, want %q", accountInfo.ProviderUserID, want)
+	}
+
+	t.Run("wrong secret", func(t *testing.T) {
+		wrongSecret := map[string]any{}
+		for k, v := range body {
+			wrongSecret[k] = v
+		}
+		wrongSecret["secret_access_key"] = "not-the-secret"
+
+		if _, _, err := linkWithCredentials(t, S3_PROVIDER_NAME, wrongSecret); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("err = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("missing bucket", func(t *testing.T) {
+		missingBucket := map[string]any{}
+		for k, v := range body {
+			missingBucket[k] = v
+		}
+		missingBucket["bucket"] = body["bucket"].(string) + "-missing"
+
+		if _, _, err := linkWithCredentials(t, S3_PROVIDER_NAME, missingBucket); err == nil {
+			t.Error("linking a missing bucket succeeded")
+		}
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		if _, _, err := linkWithCredentials(t, S3_PROVIDER_NAME, map[string]any{"endpoint": body["endpoint"]}); err == nil {
+			t.Error("linking without a bucket and keys succeeded")
+		}
+	})
+}
+
+func TestS3SyncFiles(t *testing.T) {
+	client, body := newS3TestBucket(t)
+	bucket := body["bucket"].(string)
+
+	putS3TestObject(t, client, bucket, "root.txt", "root")
+	putS3TestObject(t, client, bucket, "a/b/nested.txt", "nested")
+	putS3TestObject(t, client, bucket, "a/empty/", "")
+
+	_, account, err := linkWithCredentials(t, S3_PROVIDER_NAME, body)
+	if err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	provider := NewS3Provider()
+	items := collectSync(t, provider, account)
+
+	t.Run("parent folders", func(t *testing.T) {
+		want := map[string]struct {
+			parentFolder string
+			isFolder     bool
+		}{
+			"root.txt":       {"/", false},
+			"a/":             {"/", true},
+			"a/b/":           {"a/", true},
+			"a/b/nested.txt": {"a/b/", false},
+			"a/empty/":       {"a/", true},
+		}
+
+		if len(items) != len(want) {
+			t.Errorf("sync emitted %d items, want %d", len(items), len(want))
+		}
+
+		for key, w := range want {
+			item, ok := items[key]
+			if !ok {
+				t.Errorf("%q was not emitted", key)
+				continue
+			}
+
+			if item.ParentFolder != w.parentFolder {
+				t.Errorf("%q parent folder = %q, want %q", key, item.ParentFolder, w.parentFolder)
+			}
+
+			if item.IsFolder != w.isFolder {
+				t.Errorf("%q is folder = %v, want %v", key, item.IsFolder, w.isFolder)
+			}
+		}
+	})
+
+	t.Run("etag change detection", func(t *testing.T) {
+		for _, key := range []string{"root.txt", "a/b/nested.txt"} {
+			if items[key].ContentHash == "" {
+				t.Fatalf("%q has no content hash", key)
+			}
+		}
+
+		putS3TestObject(t, client, bucket, "root.txt", "root, changed")
+
+		relisted := collectSync(t, provider, account)
+
+		if relisted["root.txt"].ContentHash == items["root.txt"].ContentHash {
+			t.Error("content hash of an overwritten object did not change")
+		}
+
+		if relisted["a/b/nested.txt"].ContentHash != items["a/b/nested.txt"].ContentHash {
+			t.Error("content hash of an untouched object changed")
+		}
+	})
+}
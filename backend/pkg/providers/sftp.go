@@ -0,0 +1,470 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+)
+
+type SFTPProvider struct{}
+
+type SFTPCredentials struct {
+	Host       string `validate:"required" json:"host"`
+	Port       int    `json:"port"`
+	Username   string `validate:"required" json:"username"`
+	Password   string `validate:"required_without=PrivateKey" json:"password"`
+	PrivateKey string `validate:"required_without=Password" json:"private_key"`
+	Passphrase string `json:"passphrase"`
+	RootPath   string `json:"root_path"`
+	// HostKey is pinned when the account is linked, every later connection must present the same key
+	HostKey string `json:"host_key"`
+}
+
+const (
+	SFTP_PROVIDER_NAME    = string(repository.ProviderEnumSftp)
+	SFTP_SYNC_BATCH_SIZE  = 1000
+	SFTP_DEFAULT_PORT     = 22
+	SFTP_CONNECT_TIMEOUT  = 30 * time.Second
+	SFTP_DEFAULT_ROOT_DIR = "."
+)
+
+var ErrHostKeyMismatch = errors.New("sftp host key does not match the key pinned when the account was linked")
+
+func NewSFTPProvider() *SFTPProvider {
+	return &SFTPProvider{}
+}
+
+func (p *SFTPProvider) NewCredentials() any {
+	return &SFTPCredentials{}
+}
+
+func (p *SFTPProvider) VerifyCredentials(ctx context.Context, creds any) (*UserAccountInfo, error) {
+	sftpCredentials, ok := creds.(*SFTPCredentials)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	// a key supplied by the client is never trusted, the key seen on this first connection gets pinned instead
+	sftpCredentials.HostKey = ""
+
+	client, err := p.newClient(sftpCredentials)
+	if err != nil {
+		config.LOGGER.Error("failed to connect to sftp server", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("host", sftpCredentials.Host), zap.Error(err))
+		return nil, ErrInvalidCredentials
+	}
+	defer client.Close()
+
+	rootPath, err := client.RealPath(p.rootPath(sftpCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve root path '%s': %v", sftpCredentials.RootPath, err)
+	}
+
+	info, err := client.Stat(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not access root path '%s': %v", rootPath, err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("root path '%s' is not a directory", rootPath)
+	}
+
+	sftpCredentials.RootPath = rootPath
+
+	address := p.address(sftpCredentials)
+
+	return &UserAccountInfo{
+		Provider:       SFTP_PROVIDER_NAME,
+		ProviderUserID: fmt.Sprintf("%s@%s:%s", sftpCredentials.Username, address, rootPath),
+		Email:          fmt.Sprintf("%s@%s", sftpCredentials.Username, address),
+		Name:           sftpCredentials.Username,
+	}, nil
+}
+
+func (p *SFTPProvider) address(creds *SFTPCredentials) string {
+	port := creds.Port
+	if port == 0 {
+		port = SFTP_DEFAULT_PORT
+	}
+
+	return net.JoinHostPort(creds.Host, strconv.Itoa(port))
+}
+
+func (p *SFTPProvider) rootPath(creds *SFTPCredentials) string {
+	if creds.RootPath == "" {
+		return SFTP_DEFAULT_ROOT_DIR
+	}
+
+	return creds.RootPath
+}
+
+func (p *SFTPProvider) newClient(creds *SFTPCredentials) (*sftp.Client, error) {
+	var authMethods []ssh.AuthMethod
+
+	if creds.PrivateKey != "" {
+		var (
+			signer ssh.Signer
+			err    error
+		)
+
+		if creds.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(creds.PrivateKey), []byte(creds.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(creds.PrivateKey))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse private key: %v", err)
+		}
+
+		authMethods = append(authMethods, ssh.PublicKeys(signer))
+	}
+
+	if creds.Password != "" {
+		authMethods = append(authMethods, ssh.Password(creds.Password))
+	}
+
+	sshClient, err := ssh.Dial("tcp", p.address(creds), &ssh.ClientConfig{
+		User:    creds.Username,
+		Auth:    authMethods,
+		Timeout: SFTP_CONNECT_TIMEOUT,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+
+			if creds.HostKey == "" {
+				creds.HostKey = fingerprint
+				return nil
+			}
+
+			if creds.HostKey != fingerprint {
+				return ErrHostKeyMismatch
+			}
+
+			return nil
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// sftpRelativePath maps an absolute remote path to a path relative to the linked root in the same format dropbox uses,
+// e.g. with root "/srv/data" the path "/srv/data/a/b.txt" becomes "/a/b.txt".
+func sftpRelativePath(rootPath string, remotePath string) string {
+	return path.Clean("/" + strings.TrimPrefix(remotePath, rootPath))
+}
+
+func (p *SFTPProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Credentials: true,
+		Sync:        true,
+		Upload:      true,
+		Download:    true,
+		Delete:      true,
+		Move:        true,
+	}
+}
+
+func (p *SFTPProvider) clientForAccount(ctx context.Context, account Account) (*sftp.Client, *SFTPCredentials, error) {
+	var sftpCredentials SFTPCredentials
+
+	if err := account.credentials(ctx, &sftpCredentials); err != nil {
+		config.LOGGER.Error("could not decrypt credentials", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	client, err := p.newClient(&sftpCredentials)
+	if err != nil {
+		config.LOGGER.Error("failed to connect to sftp server", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	return client, &sftpCredentials, nil
+}
+
+// SyncFiles walks the whole tree below the root path, sftp has no change feed to resume from.
+func (p *SFTPProvider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
+	client, sftpCredentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var (
+		items          []Item
+		rootPath       = p.rootPath(sftpCredentials)
+		totalItemCount = 0
+	)
+
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+
+		if err := emit(ctx, SyncPage{Items: items}); err != nil {
+			return err
+		}
+
+		totalItemCount += len(items)
+
+		items = []Item{}
+
+		return nil
+	}
+
+	walker := client.Walk(rootPath)
+
+	for walker.Step() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := walker.Err(); err != nil {
+			if walker.Path() == rootPath {
+				config.LOGGER.Error("could not read sftp root directory", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("root_path", rootPath), zap.Error(err))
+				return err
+			}
+
+			// an unreadable subdirectory should not fail the whole sync
+			config.LOGGER.Warn("skipping unreadable sftp path", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("path", walker.Path()), zap.Error(err))
+			continue
+		}
+
+		if walker.Path() == rootPath {
+			continue
+		}
+
+		info := walker.Stat()
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+
+		items = append(items, p.toItem(sftpRelativePath(rootPath, walker.Path()), info.IsDir(), info.Size(), info.ModTime()))
+
+		if len(items) >= SFTP_SYNC_BATCH_SIZE {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	config.LOGGER.Info("SFTP sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
+
+	return nil
+}
+
+func (p *SFTPProvider) toItem(relativePath string, isFolder bool, size int64, modifiedTime time.Time) Item {
+	name := path.Base(relativePath)
+
+	ext := ""
+	mimeType := ""
+
+	if !isFolder {
+		ext = filepath.Ext(name)
+		mimeType = mime.TypeByExtension(ext)
+	} else {
+		size = 0
+	}
+
+	return Item{
+		ProviderFileID: relativePath,
+		Name:           name,
+		Extension:      ext,
+		Size:           size,
+		MimeType:       mimeType,
+		ParentFolder:   path.Dir(relativePath),
+		IsFolder:       isFolder,
+		ModifiedTime:   modifiedTime,
+	}
+}
+
+func (p *SFTPProvider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
+	client, sftpCredentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	rootPath := p.rootPath(sftpCredentials)
+
+	var (
+		mu    sync.Mutex
+		items []Item
+		g, _  = errgroup.WithContext(ctx)
+		sem   = make(chan struct{}, 10)
+	)
+
+	for _, f := range uploadedFiles {
+		file := f
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			remotePath := path.Join(rootPath, path.Base(file.FileHeader.Filename))
+
+			if err := p.putFile(client, remotePath, file.File); err != nil {
+				config.LOGGER.Error("upload failed", zap.String("file", file.FileHeader.Filename), zap.String("provider", SFTP_PROVIDER_NAME), zap.Error(err))
+				return fmt.Errorf("upload failed for file '%s': %v", file.FileHeader.Filename, err)
+			}
+
+			info, err := client.Stat(remotePath)
+			if err != nil {
+				return fmt.Errorf("could not stat uploaded file '%s': %v", file.FileHeader.Filename, err)
+			}
+
+			mu.Lock()
+			items = append(items, p.toItem(sftpRelativePath(rootPath, remotePath), false, info.Size(), info.ModTime()))
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// uploading to an existing path overwrites the file, the caller replaces the row for the previous version
+	return items, nil
+}
+
+func (p *SFTPProvider) putFile(client *sftp.Client, remotePath string, r io.Reader) error {
+	remoteFile, err := client.Create(remotePath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := remoteFile.ReadFrom(r); err != nil {
+		remoteFile.Close()
+		return err
+	}
+
+	return remoteFile.Close()
+}
+
+// sftpDownload keeps the connection open for as long as the file is being streamed.
+type sftpDownload struct {
+	*sftp.File
+	client *sftp.Client
+}
+
+func (d *sftpDownload) Close() error {
+	err := d.File.Close()
+	d.client.Close()
+	return err
+}
+
+func (p *SFTPProvider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	client, sftpCredentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteFile, err := client.Open(path.Join(p.rootPath(sftpCredentials), item.ProviderFileID))
+	if err != nil {
+		client.Close()
+		config.LOGGER.Error("failed to open sftp file", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("path", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	info, err := remoteFile.Stat()
+	if err != nil {
+		remoteFile.Close()
+		client.Close()
+		return nil, err
+	}
+
+	return &Download{
+		Body:        &sftpDownload{File: remoteFile, client: client},
+		Name:        item.Name,
+		ContentType: mime.TypeByExtension(filepath.Ext(item.Name)),
+		Size:        info.Size(),
+	}, nil
+}
+
+func (p *SFTPProvider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	client, sftpCredentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	remotePath := path.Join(p.rootPath(sftpCredentials), item.ProviderFileID)
+
+	if item.IsFolder {
+		err = client.RemoveAll(remotePath)
+	} else {
+		err = client.Remove(remotePath)
+	}
+
+	if err != nil {
+		config.LOGGER.Error("failed to remove sftp path", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("path", item.ProviderFileID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (p *SFTPProvider) MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error) {
+	client, sftpCredentials, err := p.clientForAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if parentID == "" {
+		parentID = path.Dir(item.ProviderFileID)
+	}
+
+	if name == "" {
+		name = item.Name
+	}
+
+	rootPath := p.rootPath(sftpCredentials)
+	destinationPath := path.Join(rootPath, parentID, name)
+
+	// plain SSH_FXP_RENAME refuses to replace an existing file, which is what we want here
+	if err := client.Rename(path.Join(rootPath, item.ProviderFileID), destinationPath); err != nil {
+		config.LOGGER.Error("failed to rename sftp path", zap.String("provider", SFTP_PROVIDER_NAME), zap.String("path", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	info, err := client.Stat(destinationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	movedItem := p.toItem(sftpRelativePath(rootPath, destinationPath), info.IsDir(), info.Size(), info.ModTime())
+
+	return &movedItem, nil
+}
@@ -0,0 +1,293 @@
+//go:build integration
+
+package providers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	SFTP_TEST_USERNAME = "cloudmesh"
+	SFTP_TEST_PASSWORD = "cloudmesh-secret"
+)
+
+// sftpTestServer is an in-process sftp server serving a temporary directory to SFTP_TEST_USERNAME, who may log in with
+// SFTP_TEST_PASSWORD or the private key of the server.
+type sftpTestServer struct {
+	host       string
+	port       int
+	root       string
+	privateKey string
+	hostKey    string
+}
+
+func newSFTPTestServer(t *testing.T) *sftpTestServer {
+	t.Helper()
+
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userPublicKey, userPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizedKey, err := ssh.NewPublicKey(userPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKeyBlock, err := ssh.MarshalPrivateKey(userPrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == SFTP_TEST_USERNAME && string(password) == SFTP_TEST_PASSWORD {
+				return nil, nil
+			}
+			return nil, errors.New("invalid password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == SFTP_TEST_USERNAME && bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown public key")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	root := t.TempDir()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPTestConn(conn, serverConfig, root)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	return &sftpTestServer{
+		host:       host,
+		port:       portNumber,
+		root:       root,
+		privateKey: string(pem.EncodeToMemory(privateKeyBlock)),
+		hostKey:    ssh.FingerprintSHA256(hostSigner.PublicKey()),
+	}
+}
+
+func serveSFTPTestConn(conn net.Conn, serverConfig *ssh.ServerConfig, root string) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range channelRequests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(root))
+				if err != nil {
+					channel.Close()
+					return
+				}
+
+				server.Serve()
+				server.Close()
+			}
+		}()
+	}
+}
+
+func (s *sftpTestServer) credentials(auth map[string]any) map[string]any {
+	body := map[string]any{
+		"host":      s.host,
+		"port":      s.port,
+		"username":  SFTP_TEST_USERNAME,
+		"root_path": s.root,
+	}
+
+	for k, v := range auth {
+		body[k] = v
+	}
+
+	return body
+}
+
+func TestSFTPLinkWithPassword(t *testing.T) {
+	server := newSFTPTestServer(t)
+
+	accountInfo, account, err := linkWithCredentials(t, SFTP_PROVIDER_NAME, server.credentials(map[string]any{"password": SFTP_TEST_PASSWORD}))
+	if err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	if want := SFTP_TEST_USERNAME + "@" + net.JoinHostPort(server.host, strconv.Itoa(server.port)) + ":" + server.root; accountInfo.ProviderUserID != want {
+		t.Errorf("provider user id = %q, want %q", accountInfo.ProviderUserID, want)
+	}
+
+	t.Run("host key is pinned", func(t *testing.T) {
+		var stored SFTPCredentials
+		if err := account.credentials(t.Context(), &stored); err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.HostKey != server.hostKey {
+			t.Errorf("pinned host key = %q, want %q", stored.HostKey, server.hostKey)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, _, err := linkWithCredentials(t, SFTP_PROVIDER_NAME, server.credentials(map[string]any{"password": "not-the-password"}))
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("err = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("no password or key", func(t *testing.T) {
+		if _, _, err := linkWithCredentials(t, SFTP_PROVIDER_NAME, server.credentials(nil)); err == nil {
+			t.Error("linking without a password or key succeeded")
+		}
+	})
+}
+
+func TestSFTPLinkWithPrivateKey(t *testing.T) {
+	server := newSFTPTestServer(t)
+
+	if _, _, err := linkWithCredentials(t, SFTP_PROVIDER_NAME, server.credentials(map[string]any{"private_key": server.privateKey})); err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block, err := ssh.MarshalPrivateKey(otherKey, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = linkWithCredentials(t, SFTP_PROVIDER_NAME, server.credentials(map[string]any{"private_key": string(pem.EncodeToMemory(block))}))
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("err = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+}
+
+func TestSFTPSyncFiles(t *testing.T) {
+	server := newSFTPTestServer(t)
+
+	for name, content := range map[string]string{
+		"root.txt":            "root",
+		"a/b/nested.txt":      "nested",
+		"a/b/c/deeper.txt":    "deeper",
+		"a/empty/.keep":       "",
+		"other/notes.md":      "notes",
+		"other/more/data.bin": "data",
+	} {
+		file := filepath.Join(server.root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, account, err := linkWithCredentials(t, SFTP_PROVIDER_NAME, server.credentials(map[string]any{"password": SFTP_TEST_PASSWORD}))
+	if err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	items := collectSync(t, NewSFTPProvider(), account)
+
+	want := map[string]struct {
+		parentFolder string
+		isFolder     bool
+		size         int64
+	}{
+		"/root.txt":            {"/", false, 4},
+		"/a":                   {"/", true, 0},
+		"/a/b":                 {"/a", true, 0},
+		"/a/b/nested.txt":      {"/a/b", false, 6},
+		"/a/b/c":               {"/a/b", true, 0},
+		"/a/b/c/deeper.txt":    {"/a/b/c", false, 6},
+		"/a/empty":             {"/a", true, 0},
+		"/a/empty/.keep":       {"/a/empty", false, 0},
+		"/other":               {"/", true, 0},
+		"/other/notes.md":      {"/other", false, 5},
+		"/other/more":          {"/other", true, 0},
+		"/other/more/data.bin": {"/other/more", false, 4},
+	}
+
+	if len(items) != len(want) {
+		t.Errorf("sync emitted %d items, want %d", len(items), len(want))
+	}
+
+	for id, w := range want {
+		item, ok := items[id]
+		if !ok {
+			t.Errorf("%q was not emitted", id)
+			continue
+		}
+
+		if item.ParentFolder != w.parentFolder || item.IsFolder != w.isFolder || item.Size != w.size {
+			t.Errorf("%q = {parent: %q, folder: %v, size: %d}, want {parent: %q, folder: %v, size: %d}", id, item.ParentFolder, item.IsFolder, item.Size, w.parentFolder, w.isFolder, w.size)
+		}
+	}
+}
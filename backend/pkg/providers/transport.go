@@ -0,0 +1,335 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// RETRY_BASE_DELAY is the first backoff delay, it doubles with every attempt up to RETRY_MAX_DELAY
+	RETRY_BASE_DELAY = time.Second
+	RETRY_MAX_DELAY  = 32 * time.Second
+	// RETRY_AFTER_LIMIT is the longest Retry-After waited for, responses asking for more are returned to the caller
+	RETRY_AFTER_LIMIT = 5 * time.Minute
+	// RETRY_INSPECT_BODY_SIZE bounds how much of a rate limited response is read to find the provider error in it
+	RETRY_INSPECT_BODY_SIZE = 64 << 10
+)
+
+// tokenBucketScript takes a token from the bucket of a provider app and returns how many milliseconds the caller has
+// to wait before using it. Tokens are reserved, so concurrent callers queue up behind each other instead of polling.
+// The time comes from Redis, workers with skewed clocks share one bucket.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(state[1]) or burst
+local updated_at = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + (now - updated_at) * rate / 1000) - 1
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "updated_at", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+
+if tokens >= 0 then
+	return 0
+end
+
+return math.ceil(-tokens * 1000 / rate)
+`)
+
+// Provider request counters by provider name, published by expvar. Throttled counts requests the shared token bucket
+// held back, rate limited counts responses the provider rejected for sending too much, retries counts every request
+// sent again.
+var (
+	providerRequestsThrottled   = expvar.NewMap("provider_requests_throttled")
+	providerRequestsRateLimited = expvar.NewMap("provider_requests_rate_limited")
+	providerRequestsRetried     = expvar.NewMap("provider_requests_retried")
+)
+
+// Clients of the optional providers are built when the provider is registered.
+var (
+	googleHTTPClient  = newProviderClient(GOOGLE_PROVIDER_NAME, config.OAuthConfig.GOOGLE.CLIENT_ID)
+	dropboxHTTPClient = newProviderClient(DROPBOX_PROVIDER_NAME, config.OAuthConfig.DROPBOX.CLIENT_ID)
+
+	onedriveHTTPClient *http.Client
+	boxHTTPClient      *http.Client
+)
+
+// providerTransport is the http.RoundTripper provider API calls go through. Every request waits for a token of the
+// provider app first. Rate limited requests are retried after the delay the provider asks for, server errors and
+// network failures with exponential backoff. Requests with a body are only retried when the body can be replayed.
+//
+// Providers with one API share a bucket per app. Self hosted providers such as WebDAV have no app, every server gets a
+// bucket of its own instead so a slow server does not hold back the others.
+type providerTransport struct {
+	provider  string
+	bucketKey string
+	perHost   bool
+	rate      float64
+	base      http.RoundTripper
+}
+
+// newProviderClient returns the client for the API of a provider app.
+func newProviderClient(provider, clientID string) *http.Client {
+	return newClient(&providerTransport{
+		provider:  provider,
+		bucketKey: "ratelimit:" + provider + ":" + clientID,
+	})
+}
+
+// newHostClient returns the client for a self hosted provider, requests are limited per server.
+func newHostClient(provider string) *http.Client {
+	return newClient(&providerTransport{
+		provider:  provider,
+		bucketKey: "ratelimit:" + provider,
+		perHost:   true,
+	})
+}
+
+// newClient completes transport. The client has no overall timeout since downloads and uploads stream for as long as
+// they need, connecting and waiting for response headers are bounded instead.
+func newClient(transport *providerTransport) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(config.ProviderHTTPConfig.DIAL_TIMEOUT) * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport.rate = config.ProviderHTTPConfig.RATE_LIMITS[transport.provider]
+	transport.base = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ResponseHeaderTimeout: time.Duration(config.ProviderHTTPConfig.RESPONSE_TIMEOUT) * time.Second,
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// oauthContext makes the oauth2 package send its token requests through client, exchanges and refreshes count against
+// the rate limit of the provider app and are retried like any other call.
+func oauthContext(ctx context.Context, client *http.Client) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
+}
+
+func (t *providerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		if err := t.wait(ctx, req.URL.Host); err != nil {
+			return nil, err
+		}
+
+		startedAt := time.Now()
+		res, err := t.base.RoundTrip(req)
+
+		fields := []zap.Field{
+			zap.String("provider", t.provider),
+			zap.String("method", req.Method),
+			zap.String("host", req.URL.Host),
+			zap.String("path", req.URL.Path),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("duration", time.Since(startedAt)),
+		}
+
+		if res != nil {
+			fields = append(fields, zap.Int("status_code", res.StatusCode))
+		}
+
+		config.LOGGER.Debug("provider request finished", append(fields, zap.Error(err))...)
+
+		delay, retry := t.retryDelay(req, res, err, attempt)
+		if !retry || attempt >= config.ProviderHTTPConfig.MAX_RETRIES || !replayable(req) {
+			return res, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return res, err
+		}
+
+		if res != nil {
+			io.Copy(io.Discard, io.LimitReader(res.Body, RETRY_INSPECT_BODY_SIZE))
+			res.Body.Close()
+		}
+
+		providerRequestsRetried.Add(t.provider, 1)
+
+		config.LOGGER.Warn("retrying provider request", append(fields, zap.Duration("delay", delay), zap.Error(err))...)
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// wait blocks until the provider app may send the next request. The limit is skipped when Redis can not be reached,
+// the provider answering with rate limit errors is handled by the retries.
+func (t *providerTransport) wait(ctx context.Context, host string) error {
+	if t.rate <= 0 {
+		return nil
+	}
+
+	bucketKey := t.bucketKey
+	if t.perHost {
+		bucketKey += ":" + strings.ToLower(host)
+	}
+
+	waitMs, err := tokenBucketScript.Run(ctx, db.RedisClient, []string{bucketKey}, t.rate, max(t.rate, 1)).Int64()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		config.LOGGER.Warn("could not take provider rate limit token", zap.String("provider", t.provider), zap.Error(err))
+		return nil
+	}
+
+	if waitMs <= 0 {
+		return nil
+	}
+
+	providerRequestsThrottled.Add(t.provider, 1)
+
+	timer := time.NewTimer(time.Duration(waitMs) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryDelay decides whether a request is sent again and after how long. Rate limits are retried for every method
+// since the provider did not act on the request. Server errors and network failures only for idempotent methods, a
+// failed POST may have gone through.
+func (t *providerTransport) retryDelay(req *http.Request, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	backoff := backoffDelay(attempt)
+
+	if err != nil {
+		return backoff, req.Context().Err() == nil && isIdempotent(req.Method)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests, res.StatusCode == http.StatusForbidden && isRateLimitBody(res):
+		providerRequestsRateLimited.Add(t.provider, 1)
+
+		delay, ok := retryAfter(res)
+		if !ok {
+			return backoff, true
+		}
+
+		return delay, delay <= RETRY_AFTER_LIMIT
+	case res.StatusCode == http.StatusServiceUnavailable:
+		if delay, ok := retryAfter(res); ok {
+			return delay, delay <= RETRY_AFTER_LIMIT
+		}
+
+		return backoff, true
+	case res.StatusCode >= http.StatusInternalServerError:
+		return backoff, isIdempotent(req.Method)
+	}
+
+	return 0, false
+}
+
+// backoffDelay doubles the delay with every attempt and picks a random point in its upper half, workers failing at
+// the same moment spread out.
+func backoffDelay(attempt int) time.Duration {
+	delay := min(RETRY_BASE_DELAY<<attempt, RETRY_MAX_DELAY)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryAfter reads the delay a rate limited response asks for, either from the Retry-After header or from the
+// retry_after field of a Dropbox too_many_requests error.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	if value := res.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(max(seconds, 0)) * time.Second, true
+		}
+
+		if at, err := http.ParseTime(value); err == nil {
+			return max(time.Until(at), 0), true
+		}
+	}
+
+	var dropboxError struct {
+		Error struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"error"`
+	}
+
+	if body := peekBody(res); json.Unmarshal(body, &dropboxError) == nil && dropboxError.Error.RetryAfter > 0 {
+		return time.Duration(dropboxError.Error.RetryAfter) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// isRateLimitBody reports whether a 403 is a Drive rate limit rather than a permission error.
+func isRateLimitBody(res *http.Response) bool {
+	body := peekBody(res)
+	return bytes.Contains(body, []byte("rateLimitExceeded")) || bytes.Contains(body, []byte("userRateLimitExceeded"))
+}
+
+// peekBody reads the start of the response body and puts it back, the caller still gets the whole body.
+func peekBody(res *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, RETRY_INSPECT_BODY_SIZE))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+
+	return body
+}
+
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,523 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/middlewares"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+type WebDAVProvider struct {
+	client *http.Client
+}
+
+type WebDAVCredentials struct {
+	URL      string `validate:"required,url" json:"url"`
+	Username string `validate:"required" json:"username"`
+	Password string `validate:"required" json:"password"`
+}
+
+type WebDAVMultiStatus struct {
+	Responses []WebDAVResponse `xml:"DAV: response"`
+}
+
+type WebDAVResponse struct {
+	Href      string           `xml:"DAV: href"`
+	PropStats []WebDAVPropStat `xml:"DAV: propstat"`
+}
+
+type WebDAVPropStat struct {
+	Status string     `xml:"DAV: status"`
+	Prop   WebDAVProp `xml:"DAV: prop"`
+}
+
+type WebDAVProp struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ETag          string `xml:"DAV: getetag"`
+	ContentLength int64  `xml:"DAV: getcontentlength"`
+	ContentType   string `xml:"DAV: getcontenttype"`
+	LastModified  string `xml:"DAV: getlastmodified"`
+}
+
+// WebDAVEntry is a single resource from a PROPFIND response, with its href resolved to a path relative to the linked root.
+type WebDAVEntry struct {
+	Path         string
+	IsFolder     bool
+	ETag         string
+	Size         int64
+	ContentType  string
+	ModifiedTime time.Time
+}
+
+const (
+	WEBDAV_PROVIDER_NAME   = string(repository.ProviderEnumWebdav)
+	WEBDAV_SYNC_BATCH_SIZE = 1000
+	WEBDAV_PROPFIND_BODY   = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:resourcetype/>
+    <d:getetag/>
+    <d:getcontentlength/>
+    <d:getcontenttype/>
+    <d:getlastmodified/>
+  </d:prop>
+</d:propfind>`
+)
+
+func NewWebDAVProvider() *WebDAVProvider {
+	return &WebDAVProvider{
+		client: newHostClient(WEBDAV_PROVIDER_NAME),
+	}
+}
+
+func (p *WebDAVProvider) NewCredentials() any {
+	return &WebDAVCredentials{}
+}
+
+func (p *WebDAVProvider) VerifyCredentials(ctx context.Context, creds any) (*UserAccountInfo, error) {
+	webdavCredentials, ok := creds.(*WebDAVCredentials)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	entries, err := p.propfind(ctx, webdavCredentials, "/", "0")
+	if err != nil {
+		config.LOGGER.Error("failed to verify webdav credentials", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.Error(err))
+		return nil, ErrInvalidCredentials
+	}
+
+	if len(entries) == 0 || !entries[0].IsFolder {
+		return nil, fmt.Errorf("'%s' is not a webdav collection", webdavCredentials.URL)
+	}
+
+	baseURL, _ := url.Parse(webdavCredentials.URL)
+
+	return &UserAccountInfo{
+		Provider:       WEBDAV_PROVIDER_NAME,
+		ProviderUserID: fmt.Sprintf("%s@%s%s", webdavCredentials.Username, baseURL.Host, strings.TrimSuffix(baseURL.Path, "/")),
+		Email:          fmt.Sprintf("%s@%s", webdavCredentials.Username, baseURL.Host),
+		Name:           webdavCredentials.Username,
+	}, nil
+}
+
+// resourceURL joins a path relative to the linked root onto the configured webdav url, escaping every segment.
+func (p *WebDAVProvider) resourceURL(creds *WebDAVCredentials, relativePath string) (string, error) {
+	baseURL, err := url.Parse(creds.URL)
+	if err != nil {
+		return "", err
+	}
+
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/") + relativePath
+	baseURL.RawPath = ""
+
+	return baseURL.String(), nil
+}
+
+func (p *WebDAVProvider) propfind(ctx context.Context, creds *WebDAVCredentials, relativePath string, depth string) ([]WebDAVEntry, error) {
+	resourceURL, err := p.resourceURL(creds, relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", resourceURL, strings.NewReader(WEBDAV_PROPFIND_BODY))
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(creds.Username, creds.Password)
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusMultiStatus {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("propfind on '%s' failed with status %d: %s", relativePath, res.StatusCode, string(body))
+	}
+
+	var multiStatus WebDAVMultiStatus
+
+	if err := xml.NewDecoder(res.Body).Decode(&multiStatus); err != nil {
+		return nil, err
+	}
+
+	baseURL, err := url.Parse(creds.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath := strings.TrimSuffix(baseURL.Path, "/")
+
+	var entries []WebDAVEntry
+
+	for _, response := range multiStatus.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		entryPath := "/" + strings.Trim(strings.TrimPrefix(href.Path, basePath), "/")
+
+		for _, propStat := range response.PropStats {
+			// properties the server does not know about come back in a separate 404 propstat
+			if !strings.Contains(propStat.Status, " 200 ") {
+				continue
+			}
+
+			entry := WebDAVEntry{
+				Path:        entryPath,
+				IsFolder:    propStat.Prop.ResourceType.Collection != nil,
+				ETag:        strings.Trim(strings.TrimPrefix(propStat.Prop.ETag, "W/"), "\""),
+				Size:        propStat.Prop.ContentLength,
+				ContentType: propStat.Prop.ContentType,
+			}
+
+			if modifiedTime, err := http.ParseTime(propStat.Prop.LastModified); err == nil {
+				entry.ModifiedTime = modifiedTime
+			}
+
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (p *WebDAVProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Credentials: true,
+		Sync:        true,
+		Upload:      true,
+		Download:    true,
+		Delete:      true,
+		Move:        true,
+	}
+}
+
+// SyncFiles walks every collection below the linked root. WebDAV has no change feed, but etags are
+// reported as content hashes so unchanged resources are not rewritten.
+func (p *WebDAVProvider) SyncFiles(ctx context.Context, account Account, cursor string, emit SyncFunc) error {
+	var webdavCredentials WebDAVCredentials
+
+	if err := account.credentials(ctx, &webdavCredentials); err != nil {
+		config.LOGGER.Error("could not decrypt credentials", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.String("account_id", account.ID), zap.Error(err))
+		return err
+	}
+
+	var (
+		items          []Item
+		pending        = []string{"/"}
+		totalItemCount = 0
+	)
+
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+
+		if err := emit(ctx, SyncPage{Items: items}); err != nil {
+			return err
+		}
+
+		totalItemCount += len(items)
+
+		items = []Item{}
+
+		return nil
+	}
+
+	// Depth: infinity is disabled on most servers (nextcloud included), so the tree is walked one collection at a time
+	for len(pending) > 0 {
+		collection := pending[0]
+		pending = pending[1:]
+
+		entries, err := p.propfind(ctx, &webdavCredentials, strings.TrimSuffix(collection, "/")+"/", "1")
+		if err != nil {
+			config.LOGGER.Error("an error occured while listing webdav collection", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.String("collection", collection), zap.Error(err))
+			return err
+		}
+
+		for _, entry := range entries {
+			if entry.Path == collection || entry.Path == "/" {
+				continue
+			}
+
+			if entry.IsFolder {
+				pending = append(pending, entry.Path)
+			}
+
+			items = append(items, p.toItem(entry))
+		}
+
+		if len(items) >= WEBDAV_SYNC_BATCH_SIZE {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	config.LOGGER.Info("WebDAV sync successful", zap.String("account_id", account.ID), zap.Int("item_count", totalItemCount))
+
+	return nil
+}
+
+func (p *WebDAVProvider) toItem(entry WebDAVEntry) Item {
+	name := path.Base(entry.Path)
+
+	ext := ""
+	mimeType := ""
+
+	if !entry.IsFolder {
+		ext = filepath.Ext(name)
+		mimeType = entry.ContentType
+
+		if mimeType == "" {
+			mimeType = mime.TypeByExtension(ext)
+		}
+	}
+
+	return Item{
+		ProviderFileID: entry.Path,
+		Name:           name,
+		Extension:      ext,
+		Size:           entry.Size,
+		MimeType:       mimeType,
+		ParentFolder:   path.Dir(entry.Path),
+		IsFolder:       entry.IsFolder,
+		ContentHash:    entry.ETag,
+		ModifiedTime:   entry.ModifiedTime,
+	}
+}
+
+func (p *WebDAVProvider) UploadFiles(ctx context.Context, account Account, uploadedFiles []middlewares.UploadedFile) ([]Item, error) {
+	var webdavCredentials WebDAVCredentials
+
+	if err := account.credentials(ctx, &webdavCredentials); err != nil {
+		config.LOGGER.Error("failed to decrypt credentials", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []Item
+		g, _    = errgroup.WithContext(ctx)
+		sem     = make(chan struct{}, 10)
+	)
+
+	for _, f := range uploadedFiles {
+		file := f
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			entry, err := p.putFile(ctx, &webdavCredentials, file)
+
+			if err != nil {
+				config.LOGGER.Error("upload failed", zap.String("file", file.FileHeader.Filename), zap.String("provider", WEBDAV_PROVIDER_NAME), zap.Error(err))
+				return fmt.Errorf("upload failed for file '%s': %v", file.FileHeader.Filename, err)
+			}
+
+			mu.Lock()
+			results = append(results, p.toItem(*entry))
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// PUT overwrites an existing resource at the same path, the caller replaces the row for the previous version
+	return results, nil
+}
+
+func (p *WebDAVProvider) putFile(ctx context.Context, creds *WebDAVCredentials, file middlewares.UploadedFile) (*WebDAVEntry, error) {
+	relativePath := "/" + file.FileHeader.Filename
+
+	resourceURL, err := p.resourceURL(creds, relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, resourceURL, file.File)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(creds.Username, creds.Password)
+	req.Header.Set("Content-Type", file.ContentType)
+	req.ContentLength = file.FileHeader.Size
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("put failed with status %d: %s", res.StatusCode, string(bytes.TrimSpace(body)))
+	}
+
+	// not every server returns an etag on PUT, in that case the next sync picks it up as a changed item
+	etag := res.Header.Get("OC-ETag")
+	if etag == "" {
+		etag = res.Header.Get("ETag")
+	}
+
+	return &WebDAVEntry{
+		Path:         relativePath,
+		IsFolder:     false,
+		ETag:         strings.Trim(strings.TrimPrefix(etag, "W/"), "\""),
+		Size:         file.FileHeader.Size,
+		ContentType:  file.ContentType,
+		ModifiedTime: time.Now(),
+	}, nil
+}
+
+func (p *WebDAVProvider) do(ctx context.Context, creds *WebDAVCredentials, method, relativePath string, header http.Header) (*http.Response, error) {
+	resourceURL, err := p.resourceURL(creds, relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, resourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.SetBasicAuth(creds.Username, creds.Password)
+
+	return p.client.Do(req)
+}
+
+func (p *WebDAVProvider) DownloadFile(ctx context.Context, account Account, item Item) (*Download, error) {
+	var webdavCredentials WebDAVCredentials
+
+	if err := account.credentials(ctx, &webdavCredentials); err != nil {
+		config.LOGGER.Error("failed to decrypt credentials", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	res, err := p.do(ctx, &webdavCredentials, http.MethodGet, item.ProviderFileID, nil)
+	if err != nil {
+		config.LOGGER.Error("http request to download webdav resource failed", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.String("path", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, fmt.Errorf("get on '%s' failed with status %d: %s", item.ProviderFileID, res.StatusCode, string(bytes.TrimSpace(body)))
+	}
+
+	return &Download{
+		Body:        res.Body,
+		Name:        item.Name,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        res.ContentLength,
+	}, nil
+}
+
+// DeleteFile issues a DELETE, which removes collections together with everything inside them.
+func (p *WebDAVProvider) DeleteFile(ctx context.Context, account Account, item Item) error {
+	var webdavCredentials WebDAVCredentials
+
+	if err := account.credentials(ctx, &webdavCredentials); err != nil {
+		config.LOGGER.Error("failed to decrypt credentials", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.Error(err))
+		return err
+	}
+
+	res, err := p.do(ctx, &webdavCredentials, http.MethodDelete, item.ProviderFileID, nil)
+	if err != nil {
+		config.LOGGER.Error("http request to delete webdav resource failed", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.String("path", item.ProviderFileID), zap.Error(err))
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("delete on '%s' failed with status %d: %s", item.ProviderFileID, res.StatusCode, string(bytes.TrimSpace(body)))
+	}
+
+	return nil
+}
+
+func (p *WebDAVProvider) MoveFile(ctx context.Context, account Account, item Item, parentID, name string) (*Item, error) {
+	var webdavCredentials WebDAVCredentials
+
+	if err := account.credentials(ctx, &webdavCredentials); err != nil {
+		config.LOGGER.Error("failed to decrypt credentials", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.Error(err))
+		return nil, err
+	}
+
+	if parentID == "" {
+		parentID = path.Dir(item.ProviderFileID)
+	}
+
+	if name == "" {
+		name = item.Name
+	}
+
+	destinationPath := path.Join(parentID, name)
+
+	destinationURL, err := p.resourceURL(&webdavCredentials, destinationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.do(ctx, &webdavCredentials, "MOVE", item.ProviderFileID, http.Header{
+		"Destination": []string{destinationURL},
+		"Overwrite":   []string{"F"},
+	})
+	if err != nil {
+		config.LOGGER.Error("http request to move webdav resource failed", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.String("path", item.ProviderFileID), zap.Error(err))
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("move of '%s' failed with status %d", item.ProviderFileID, res.StatusCode)
+	}
+
+	entries, err := p.propfind(ctx, &webdavCredentials, destinationPath, "0")
+	if err != nil || len(entries) == 0 {
+		config.LOGGER.Error("failed to read moved webdav resource", zap.String("provider", WEBDAV_PROVIDER_NAME), zap.String("path", destinationPath), zap.Error(err))
+		return nil, fmt.Errorf("could not read '%s' after moving it", destinationPath)
+	}
+
+	movedItem := p.toItem(entries[0])
+
+	return &movedItem, nil
+}
@@ -3,15 +3,17 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/blackmamoth/cloudmesh/pkg/config"
 	"github.com/blackmamoth/cloudmesh/pkg/db"
 	"github.com/blackmamoth/cloudmesh/pkg/providers"
-	"github.com/blackmamoth/cloudmesh/pkg/utils"
+	"github.com/blackmamoth/cloudmesh/pkg/tokens"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
@@ -19,6 +21,11 @@ const (
 	TypeAuthTokenRenewal = "file:auth-token-renewal"
 )
 
+const (
+	// AUTH_TOKEN_RENEW_BEFORE is how long before its expiry an access token is renewed
+	AUTH_TOKEN_RENEW_BEFORE = 10 * time.Minute
+)
+
 type AuthTokenRenewalPayload struct {
 	UserID    string
 	AccountID string
@@ -32,6 +39,82 @@ func NewAuthTokenRenewalTask(userID, accountID string) (*asynq.Task, error) {
 	return asynq.NewTask(TypeAuthTokenRenewal, payload), nil
 }
 
+// AuthTokenRenewalTaskID is the task id of the renewal of a token expiring at expiry. Linking and renewals racing to
+// schedule the renewal of the same token enqueue it once.
+func AuthTokenRenewalTaskID(accountID string, expiry time.Time) string {
+	return fmt.Sprintf("%s:%s:%d", TypeAuthTokenRenewal, accountID, expiry.Unix())
+}
+
+// EnqueueAuthTokenRenewalTaskAndLog schedules the renewal of a token expiring at expiry AUTH_TOKEN_RENEW_BEFORE ahead of
+// it and records it in job_logs. Tokens without an expiry are not renewed, a renewal that is already scheduled is
+// left as it is.
+func EnqueueAuthTokenRenewalTaskAndLog(
+	ctx context.Context,
+	userID, accountID, providerName string,
+	expiry time.Time,
+	asynqClient *asynq.Client,
+	queries *repository.Queries,
+) error {
+	if expiry.IsZero() {
+		return nil
+	}
+
+	task, err := NewAuthTokenRenewalTask(userID, accountID)
+	if err != nil {
+		config.LOGGER.Error("failed to create auth token renewal task", zap.String("provider", providerName), zap.String("task_type", TypeAuthTokenRenewal), zap.Error(err))
+		return err
+	}
+
+	info, err := asynqClient.Enqueue(
+		task,
+		asynq.MaxRetry(5),
+		asynq.ProcessAt(expiry.Add(-AUTH_TOKEN_RENEW_BEFORE)),
+		asynq.TaskID(AuthTokenRenewalTaskID(accountID, expiry)),
+	)
+
+	if err != nil {
+		if errors.Is(err, asynq.ErrTaskIDConflict) {
+			return nil
+		}
+		config.LOGGER.Error("failed to enqueue auth token renewal task", zap.String("provider", providerName), zap.String("task_type", TypeAuthTokenRenewal), zap.Error(err))
+		return err
+	}
+
+	config.LOGGER.Info("auth token renewal task successfully enqueued", zap.String("provider", providerName), zap.String("task_type", TypeAuthTokenRenewal), zap.String("task_id", info.ID), zap.String("queue", info.Queue), zap.Time("process_at", info.NextProcessAt))
+
+	params, err := json.Marshal(AuthTokenRenewalPayload{UserID: userID, AccountID: accountID})
+	if err != nil {
+		config.LOGGER.Error("failed to marshal auth token renewal task params", zap.String("provider", providerName), zap.Error(err))
+		return nil
+	}
+
+	accountUUID, err := db.PGUUID(accountID)
+	if err != nil {
+		config.LOGGER.Error("invalid accountID UUID format", zap.String("provider", providerName), zap.String("accountID", accountID), zap.Error(err))
+		return nil
+	}
+
+	err = queries.AddNewJobLog(ctx, repository.AddNewJobLogParams{
+		JobID:     info.ID,
+		AccountID: *accountUUID,
+		Type:      info.Type,
+		Status:    repository.JobStatusEnumQueued,
+		Queue:     info.Queue,
+		Params:    params,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to insert job log", zap.String("provider", providerName), zap.String("task_type", TypeAuthTokenRenewal), zap.String("task_id", info.ID), zap.String("queue", info.Queue), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// HandleAuthTokenRenewalTask renews the access token of the account and schedules the renewal of the new one. A token
+// that was renewed in the meantime, by a provider call that found it expired, is not renewed again, the renewal of
+// the stored token is scheduled instead. Accounts without a refresh token or waiting to be linked again are not renewed,
+// their job is logged as skipped.
 func HandleAuthTokenRenewalTask(ctx context.Context, t *asynq.Task) error {
 
 	var p AuthTokenRenewalPayload
@@ -85,23 +168,58 @@ func HandleAuthTokenRenewalTask(ctx context.Context, t *asynq.Task) error {
 	})
 
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// the account was unlinked
+			return nil
+		}
 		config.LOGGER.Error("failed to fetch auth tokens from db", zap.Error(err), zap.String("user_id", p.UserID), zap.String("account_id", p.AccountID))
 		return fmt.Errorf("failed to fetch auth tokens from db: %v", err)
 	}
 
-	provider, ok := providers.OAuthProviders[string(authToken.Provider)]
+	providerName := string(authToken.Provider)
+
+	if _, ok := providers.GetAuthenticator(providerName); !ok {
+		err = queries.UpdateJobLogFailed(ctx, repository.UpdateJobLogFailedParams{
+			Error: db.PGTextField(providers.ErrUnsupportedProvider.Error()),
+			JobID: jobID,
+		})
+
+		if err != nil {
+			config.LOGGER.Error("failed to insert failed log for job", zap.String("job_id", jobID), zap.Error(err))
+		}
 
-	if !ok {
-		return providers.ErrUnsupportedProvider
+		return fmt.Errorf("%w: %w", providers.ErrUnsupportedProvider, asynq.SkipRetry)
 	}
 
-	refreshToken, err := utils.Decrypt(authToken.RefreshToken)
-	if err != nil {
-		config.LOGGER.Error("could not decrypt refresh token", zap.String("provider", string(authToken.Provider)), zap.String("account_id", accountID.String()))
-		return err
+	// credentials without a refresh token, such as webdav passwords, do not expire. Accounts waiting to be linked again
+	// get a new token and renewal from the link
+	if authToken.RefreshToken == "" || authToken.Status == repository.AccountStatusEnumNeedsReauth {
+		err = queries.UpdateJobLogSkipped(ctx, repository.UpdateJobLogSkippedParams{
+			FinishedAt: db.PGTimestamptzField(time.Now()),
+			JobID:      jobID,
+		})
+
+		if err != nil {
+			config.LOGGER.Error("failed to insert skipped log for job", zap.String("job_id", jobID), zap.Error(err))
+		}
+
+		return nil
+	}
+
+	if authToken.Expiry.Valid && time.Until(authToken.Expiry.Time) > 2*AUTH_TOKEN_RENEW_BEFORE {
+		err = queries.UpdateJobLogFinish(ctx, repository.UpdateJobLogFinishParams{
+			FinishedAt: db.PGTimestamptzField(time.Now()),
+			JobID:      jobID,
+		})
+
+		if err != nil {
+			config.LOGGER.Error("failed to insert finish log for job", zap.String("job_id", jobID), zap.Error(err))
+		}
+
+		return EnqueueAuthTokenRenewalTaskAndLog(ctx, p.UserID, p.AccountID, providerName, authToken.Expiry.Time, db.GetAsynqClient(), queries)
 	}
 
-	_, expiresIn, err := provider.RenewOAuthTokens(ctx, conn, *accountID, refreshToken)
+	token, err := tokens.New(conn, *accountID, authToken).Refresh(ctx)
 
 	if err != nil {
 
@@ -114,6 +232,23 @@ func HandleAuthTokenRenewalTask(ctx context.Context, t *asynq.Task) error {
 			config.LOGGER.Error("failed to insert failed log for job", zap.String("job_id", jobID), zap.Error(err))
 		}
 
+		// the account was flagged as needing re-authentication, retrying can not bring the grant back
+		if errors.Is(err, providers.ErrInvalidGrant) {
+			return fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+		}
+
+		if maxRetry, ok := asynq.GetMaxRetry(ctx); ok && retryCount >= maxRetry {
+			dbErr = queries.UpdateAccountStatus(ctx, repository.UpdateAccountStatusParams{
+				Status:       repository.AccountStatusEnumError,
+				StatusReason: db.PGTextField(err.Error()),
+				AccountID:    *accountID,
+			})
+
+			if dbErr != nil {
+				config.LOGGER.Error("failed to update account status", zap.String("account_id", p.AccountID), zap.Error(dbErr))
+			}
+		}
+
 		return err
 	}
 
@@ -126,12 +261,9 @@ func HandleAuthTokenRenewalTask(ctx context.Context, t *asynq.Task) error {
 		config.LOGGER.Error("failed to insert finish log for job", zap.String("job_id", jobID), zap.Error(err))
 	}
 
-	newTask, err := NewAuthTokenRenewalTask(p.UserID, p.AccountID)
-
-	if err == nil {
-		asynqclient := db.GetAsynqClient()
-
-		asynqclient.Enqueue(newTask, asynq.ProcessIn(time.Duration(expiresIn)), asynq.Unique(6*time.Minute))
+	// the token is renewed, failing the task over the next renewal would renew it again
+	if err := EnqueueAuthTokenRenewalTaskAndLog(ctx, p.UserID, p.AccountID, providerName, token.Expiry, db.GetAsynqClient(), queries); err != nil {
+		config.LOGGER.Error("failed to schedule next auth token renewal", zap.String("provider", providerName), zap.String("account_id", p.AccountID), zap.Error(err))
 	}
 
 	config.LOGGER.Info("worker completed token renewal task and saved new token to db", zap.String("user_id", p.UserID), zap.String("account_id", p.AccountID))
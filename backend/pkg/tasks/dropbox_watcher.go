@@ -0,0 +1,246 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// DROPBOX_LONGPOLL_TIMEOUT is the longpoll timeout in seconds, Dropbox accepts 30 to 480
+	DROPBOX_LONGPOLL_TIMEOUT = 480
+	// DROPBOX_WATCH_RELOAD_INTERVAL is how often the watched accounts and their cursors are read again
+	DROPBOX_WATCH_RELOAD_INTERVAL = time.Minute
+	// DROPBOX_WATCH_LEADER_TTL is how long the watching worker stays leader without renewing, another worker takes
+	// the watches over once it ran out
+	DROPBOX_WATCH_LEADER_TTL = 3 * DROPBOX_WATCH_RELOAD_INTERVAL
+	// DROPBOX_WATCH_SETTLE_TIME is how long a watch waits after enqueueing a sync before it polls the same cursor again,
+	// by then the sync usually stored a newer cursor and the watch was restarted with it
+	DROPBOX_WATCH_SETTLE_TIME = 5 * time.Minute
+	DROPBOX_WATCH_MIN_BACKOFF = 5 * time.Second
+	DROPBOX_WATCH_MAX_BACKOFF = 5 * time.Minute
+)
+
+// DropboxWatcher longpolls the stored cursor of every Dropbox account and enqueues an incremental sync as soon as
+// Dropbox reports changes. Each account is watched by its own goroutine, a longpoll is an idle connection that needs no
+// access token so thousands of them are cheap. Every worker runs a watcher but only the one holding the leader lock
+// watches, so each account is longpolled once.
+type DropboxWatcher struct {
+	poller providers.ChangePoller
+	leader *leaderLock
+	// sleep waits between longpolls, tests replace it to follow the backoff without waiting
+	sleep func(ctx context.Context, d time.Duration) bool
+
+	mu      sync.Mutex
+	watches map[string]*dropboxWatch
+}
+
+type dropboxWatch struct {
+	cursor string
+	cancel context.CancelFunc
+}
+
+func NewDropboxWatcher() (*DropboxWatcher, error) {
+	leader, err := newLeaderLock("dropbox-watcher", DROPBOX_WATCH_LEADER_TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	poller, ok := providers.GetChangePoller(providers.DROPBOX_PROVIDER_NAME)
+	if !ok {
+		return nil, providers.ErrUnsupportedProvider
+	}
+
+	return &DropboxWatcher{
+		poller:  poller,
+		leader:  leader,
+		sleep:   sleep,
+		watches: make(map[string]*dropboxWatch),
+	}, nil
+}
+
+// Run watches the accounts while this worker leads until ctx is cancelled. Accounts linked later and cursors moved by
+// syncs are picked up on the next reload.
+func (w *DropboxWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(DROPBOX_WATCH_RELOAD_INTERVAL)
+	defer ticker.Stop()
+
+	config.LOGGER.Info("dropbox watcher started")
+
+	leading := false
+
+	for {
+		isLeader, err := w.leader.hold(ctx)
+		if err != nil {
+			// a watcher that cannot tell whether it still leads stops, the lock runs out and another worker takes over
+			config.LOGGER.Error("failed to hold dropbox watcher leader lock", zap.Error(err))
+			isLeader = false
+		}
+
+		if isLeader != leading {
+			config.LOGGER.Info("dropbox watcher leadership changed", zap.Bool("leading", isLeader))
+			leading = isLeader
+		}
+
+		if leading {
+			if err := w.reload(ctx); err != nil {
+				config.LOGGER.Error("failed to reload dropbox watches", zap.Error(err))
+			}
+		} else {
+			w.stopAll()
+		}
+
+		select {
+		case <-ctx.Done():
+			w.stopAll()
+			if leading {
+				if err := w.leader.release(ctx); err != nil {
+					config.LOGGER.Warn("failed to release dropbox watcher leader lock", zap.Error(err))
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *DropboxWatcher) reload(ctx context.Context) error {
+	conn, err := db.ConnPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	accounts, err := repository.New(conn).GetAccountsWithSyncCursor(ctx, repository.ProviderEnumDropbox)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seen := make(map[string]bool, len(accounts))
+
+	for _, account := range accounts {
+		accountID := account.ID.String()
+		seen[accountID] = true
+
+		watch, ok := w.watches[accountID]
+		if ok && watch.cursor == account.SyncPageToken.String {
+			continue
+		}
+
+		if ok {
+			watch.cancel()
+		}
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		w.watches[accountID] = &dropboxWatch{cursor: account.SyncPageToken.String, cancel: cancel}
+
+		go w.watch(watchCtx, account.UserID, accountID, account.SyncPageToken.String)
+	}
+
+	for accountID, watch := range w.watches {
+		if !seen[accountID] {
+			watch.cancel()
+			delete(w.watches, accountID)
+		}
+	}
+
+	return nil
+}
+
+func (w *DropboxWatcher) stopAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for accountID, watch := range w.watches {
+		watch.cancel()
+		delete(w.watches, accountID)
+	}
+}
+
+// watch longpolls a single cursor until the watch is cancelled.
+func (w *DropboxWatcher) watch(ctx context.Context, userID, accountID, cursor string) {
+	backoff := DROPBOX_WATCH_MIN_BACKOFF
+
+	// spread the first polls of a reload instead of opening every connection at once
+	if !w.sleep(ctx, rand.N(DROPBOX_WATCH_MIN_BACKOFF)) {
+		return
+	}
+
+	for {
+		res, err := w.poller.Longpoll(ctx, cursor, DROPBOX_LONGPOLL_TIMEOUT)
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, providers.ErrCursorReset):
+			// the cursor stays invalid, the watch idles until a sync stores a new one and the next reload restarts it
+			config.LOGGER.Warn("dropbox cursor was reset", zap.String("account_id", accountID))
+			w.enqueueSync(ctx, userID, accountID)
+			return
+		case err != nil:
+			config.LOGGER.Warn("dropbox longpoll failed", zap.String("account_id", accountID), zap.Duration("backoff", backoff), zap.Error(err))
+			if !w.sleep(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, DROPBOX_WATCH_MAX_BACKOFF)
+			continue
+		}
+
+		backoff = DROPBOX_WATCH_MIN_BACKOFF
+
+		if res.Changes {
+			w.enqueueSync(ctx, userID, accountID)
+
+			if !w.sleep(ctx, DROPBOX_WATCH_SETTLE_TIME) {
+				return
+			}
+			continue
+		}
+
+		// dropbox asks clients to wait backoff seconds before the next longpoll
+		if res.Backoff > 0 && !w.sleep(ctx, time.Duration(res.Backoff)*time.Second) {
+			return
+		}
+	}
+}
+
+func (w *DropboxWatcher) enqueueSync(ctx context.Context, userID, accountID string) {
+	conn, err := db.ConnPool.Acquire(ctx)
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		return
+	}
+	defer conn.Release()
+
+	info, alreadyQueued, err := EnqueueFileSyncOnce(ctx, userID, accountID, providers.DROPBOX_PROVIDER_NAME, QUEUE_DEFAULT, repository.New(conn))
+	if err != nil {
+		config.LOGGER.Error("failed to enqueue sync for dropbox changes", zap.String("account_id", accountID), zap.Error(err))
+		return
+	}
+
+	config.LOGGER.Info("dropbox reported changes", zap.String("account_id", accountID), zap.String("task_id", info.ID), zap.Bool("already_queued", alreadyQueued))
+}
+
+// sleep waits for d and reports false when ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
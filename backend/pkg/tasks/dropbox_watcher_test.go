@@ -0,0 +1,82 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+)
+
+// scriptedPoller answers longpolls from a script, the watch is cancelled once the script ran out.
+type scriptedPoller struct {
+	providers.ChangePoller
+
+	cancel  context.CancelFunc
+	results []*providers.LongpollResult
+	errs    []error
+}
+
+func (p *scriptedPoller) Longpoll(ctx context.Context, cursor string, timeout int) (*providers.LongpollResult, error) {
+	if len(p.results) == 0 {
+		p.cancel()
+		return nil, ctx.Err()
+	}
+
+	res, err := p.results[0], p.errs[0]
+	p.results, p.errs = p.results[1:], p.errs[1:]
+
+	return res, err
+}
+
+func TestDropboxWatchBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failed := errors.New("connection reset by peer")
+	poller := &scriptedPoller{cancel: cancel}
+
+	// eight failures run into the cap, a quiet longpoll resets the backoff and asks for a pause of its own
+	for range 8 {
+		poller.results = append(poller.results, nil)
+		poller.errs = append(poller.errs, failed)
+	}
+
+	poller.results = append(poller.results, &providers.LongpollResult{Backoff: 60}, nil)
+	poller.errs = append(poller.errs, nil, failed)
+
+	var slept []time.Duration
+
+	w := &DropboxWatcher{
+		poller: poller,
+		sleep: func(ctx context.Context, d time.Duration) bool {
+			slept = append(slept, d)
+			return ctx.Err() == nil
+		},
+	}
+
+	w.watch(ctx, "user", "account", "cursor")
+
+	if len(slept) == 0 || slept[0] >= DROPBOX_WATCH_MIN_BACKOFF {
+		t.Fatalf("first poll was not spread below %s: %v", DROPBOX_WATCH_MIN_BACKOFF, slept)
+	}
+
+	want := []time.Duration{
+		5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second,
+		DROPBOX_WATCH_MAX_BACKOFF, DROPBOX_WATCH_MAX_BACKOFF,
+		60 * time.Second,
+		DROPBOX_WATCH_MIN_BACKOFF,
+	}
+
+	got := slept[1:]
+	if len(got) != len(want) {
+		t.Fatalf("watch slept %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("watch slept %v, want %v", got, want)
+		}
+	}
+}
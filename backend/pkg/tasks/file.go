@@ -3,14 +3,20 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/blackmamoth/cloudmesh/pkg/catalog"
 	"github.com/blackmamoth/cloudmesh/pkg/config"
 	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/progress"
 	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/tokens"
 	"github.com/blackmamoth/cloudmesh/repository"
 	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +24,12 @@ const (
 	TypeFileSync = "file:sync"
 )
 
+const (
+	QUEUE_CRITICAL = "critical"
+	QUEUE_DEFAULT  = "default"
+	QUEUE_LOW      = "low"
+)
+
 type FileSyncPayload struct {
 	UserID    string
 	AccountID string
@@ -31,6 +43,190 @@ func NewFileSyncTask(userID, accountID string) (*asynq.Task, error) {
 	return asynq.NewTask(TypeFileSync, payload), nil
 }
 
+// FileSyncTaskID is the task id of on demand syncs, asynq rejects a second task with the same id while the first one
+// is still around.
+func FileSyncTaskID(accountID string) string {
+	return fmt.Sprintf("%s:%s", TypeFileSync, accountID)
+}
+
+// EnqueueFileSyncTaskAndLog enqueues a file sync task for the account and records it in job_logs. opts are applied
+// on top of the default retry policy.
+func EnqueueFileSyncTaskAndLog(
+	ctx context.Context,
+	userId, accountID, providerName string,
+	asynqClient *asynq.Client,
+	queries *repository.Queries,
+	opts ...asynq.Option,
+) (*asynq.TaskInfo, error) {
+	task, err := NewFileSyncTask(userId, accountID)
+	if err != nil {
+		config.LOGGER.Error("failed to create file sync task", zap.String("provider", providerName), zap.String("task_type", TypeFileSync), zap.Error(err))
+		return nil, err
+	}
+
+	info, err := asynqClient.Enqueue(task, append([]asynq.Option{asynq.MaxRetry(3)}, opts...)...)
+	if err != nil {
+		config.LOGGER.Error("failed to enqueue file sync task", zap.String("provider", providerName), zap.String("task_type", TypeFileSync), zap.Error(err))
+		return nil, err
+	}
+
+	config.LOGGER.Info("file sync task successfully enqueued", zap.String("provider", providerName), zap.String("task_type", TypeFileSync), zap.String("task_id", info.ID), zap.String("queue", info.Queue))
+
+	params, err := json.Marshal(FileSyncPayload{UserID: userId, AccountID: accountID})
+	if err != nil {
+		config.LOGGER.Error("failed to marshal file sync task params", zap.String("provider", providerName), zap.Error(err))
+		return info, nil
+	}
+
+	accountUUID, err := db.PGUUID(accountID)
+	if err != nil {
+		config.LOGGER.Error("invalid accountID UUID format", zap.String("provider", providerName), zap.String("accountID", accountID), zap.Error(err))
+		return info, nil
+	}
+
+	err = queries.AddNewJobLog(ctx, repository.AddNewJobLogParams{
+		JobID:     info.ID,
+		AccountID: *accountUUID,
+		Type:      info.Type,
+		Status:    repository.JobStatusEnumQueued,
+		Queue:     info.Queue,
+		Params:    params,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to insert job log", zap.String("provider", providerName), zap.String("task_type", TypeFileSync), zap.String("task_id", info.ID), zap.String("queue", info.Queue), zap.Error(err))
+		return info, err
+	}
+
+	return info, nil
+}
+
+// EnqueueFileSyncOnce enqueues a sync of the account under FileSyncTaskID unless a sync of the account is already
+// waiting or running, the task of that sync is returned together with true instead. A finished task still holding the
+// task id is replaced.
+func EnqueueFileSyncOnce(ctx context.Context, userID, accountID, providerName, queue string, queries *repository.Queries) (*asynq.TaskInfo, bool, error) {
+	accountUUID, err := db.PGUUID(accountID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	inspector := db.GetAsynqInspector()
+
+	// syncs enqueued elsewhere (linking) carry random task ids, job_logs knows about them
+	activeJob, err := queries.GetActiveJobLog(ctx, repository.GetActiveJobLogParams{
+		AccountID: *accountUUID,
+		Type:      TypeFileSync,
+	})
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		config.LOGGER.Error("failed to fetch active sync job", zap.String("account_id", accountID), zap.Error(err))
+		return nil, false, err
+	}
+
+	if err == nil {
+		if info, err := inspector.GetTaskInfo(activeJob.Queue, activeJob.JobID); err == nil && isTaskInFlight(info) {
+			return info, true, nil
+		}
+	}
+
+	taskID := FileSyncTaskID(accountID)
+
+	for attempt := 0; ; attempt++ {
+		info, err := EnqueueFileSyncTaskAndLog(ctx, userID, accountID, providerName, db.GetAsynqClient(), queries, asynq.Queue(queue), asynq.TaskID(taskID))
+
+		if info != nil {
+			// a missing job log does not undo the enqueue
+			return info, false, nil
+		}
+
+		if !errors.Is(err, asynq.ErrTaskIDConflict) {
+			return nil, false, err
+		}
+
+		existing := findTask(inspector, taskID)
+
+		if existing != nil && isTaskInFlight(existing) {
+			return existing, true, nil
+		}
+
+		// a previous sync that failed for good or is kept for retention still holds the id
+		if attempt > 0 || existing == nil {
+			return nil, false, err
+		}
+
+		if err := inspector.DeleteTask(existing.Queue, taskID); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+			config.LOGGER.Error("failed to delete finished sync task", zap.String("account_id", accountID), zap.String("task_id", taskID), zap.Error(err))
+			return nil, false, err
+		}
+	}
+}
+
+// findTask looks the task id up in every queue, on demand syncs are enqueued on different queues.
+func findTask(inspector *asynq.Inspector, taskID string) *asynq.TaskInfo {
+	for _, queue := range []string{QUEUE_CRITICAL, QUEUE_DEFAULT, QUEUE_LOW} {
+		if info, err := inspector.GetTaskInfo(queue, taskID); err == nil {
+			return info
+		}
+	}
+
+	return nil
+}
+
+// CancelAccountTasks takes the tasks of the account that job_logs knows to be waiting or running out of their queues,
+// running tasks are asked to stop. It returns how many tasks were cancelled. Tasks that finished or moved on since
+// are skipped.
+func CancelAccountTasks(ctx context.Context, accountID pgtype.UUID, queries *repository.Queries) (int, error) {
+	jobs, err := queries.GetPendingJobLogs(ctx, accountID)
+	if err != nil {
+		config.LOGGER.Error("failed to fetch pending jobs", zap.String("account_id", accountID.String()), zap.Error(err))
+		return 0, err
+	}
+
+	inspector := db.GetAsynqInspector()
+	cancelled := 0
+
+	for _, job := range jobs {
+		info, err := inspector.GetTaskInfo(job.Queue, job.JobID)
+		if err != nil {
+			if !errors.Is(err, asynq.ErrTaskNotFound) && !errors.Is(err, asynq.ErrQueueNotFound) {
+				config.LOGGER.Warn("failed to fetch task", zap.String("account_id", accountID.String()), zap.String("task_id", job.JobID), zap.Error(err))
+			}
+			continue
+		}
+
+		if !isTaskInFlight(info) {
+			continue
+		}
+
+		if info.State == asynq.TaskStateActive {
+			err = inspector.CancelProcessing(job.JobID)
+		} else {
+			err = inspector.DeleteTask(job.Queue, job.JobID)
+		}
+
+		if err != nil {
+			if !errors.Is(err, asynq.ErrTaskNotFound) {
+				config.LOGGER.Warn("failed to cancel task", zap.String("account_id", accountID.String()), zap.String("task_id", job.JobID), zap.String("state", info.State.String()), zap.Error(err))
+			}
+			continue
+		}
+
+		cancelled++
+	}
+
+	return cancelled, nil
+}
+
+// isTaskInFlight reports whether the task is still waiting for or being processed by a worker.
+func isTaskInFlight(info *asynq.TaskInfo) bool {
+	switch info.State {
+	case asynq.TaskStatePending, asynq.TaskStateActive, asynq.TaskStateRetry, asynq.TaskStateScheduled, asynq.TaskStateAggregating:
+		return true
+	}
+
+	return false
+}
+
 func HandleFileSyncTask(ctx context.Context, t *asynq.Task) error {
 
 	var p FileSyncPayload
@@ -49,6 +245,8 @@ func HandleFileSyncTask(ctx context.Context, t *asynq.Task) error {
 
 	jobID := t.ResultWriter().TaskID()
 
+	reporter := progress.NewReporter(p.AccountID, jobID)
+
 	retryCount, ok := asynq.GetRetryCount(ctx)
 
 	if !ok || retryCount == 0 {
@@ -60,6 +258,8 @@ func HandleFileSyncTask(ctx context.Context, t *asynq.Task) error {
 		if err != nil {
 			config.LOGGER.Error("failed to insert start log for job", zap.String("job_id", jobID), zap.Error(err))
 		}
+
+		reporter.PublishStatus(ctx, string(repository.JobStatusEnumProcessing), nil)
 	} else {
 		err = queries.UpdateJobLogRetryCount(ctx, repository.UpdateJobLogRetryCountParams{
 			Retries: db.PGInt4Field(int32(retryCount)),
@@ -69,6 +269,8 @@ func HandleFileSyncTask(ctx context.Context, t *asynq.Task) error {
 		if err != nil {
 			config.LOGGER.Error("failed to insert retry count log for job", zap.String("job_id", jobID), zap.Int("retry_count", retryCount), zap.Error(err))
 		}
+
+		reporter.PublishStatus(ctx, string(repository.JobStatusEnumRetrying), nil)
 	}
 
 	accountID, err := db.PGUUID(p.AccountID)
@@ -85,16 +287,41 @@ func HandleFileSyncTask(ctx context.Context, t *asynq.Task) error {
 
 	if err != nil {
 		config.LOGGER.Error("failed to fetch auth tokens from db", zap.Error(err), zap.String("user_id", p.UserID), zap.String("account_id", p.AccountID))
+
+		// the account was unlinked while the sync was waiting
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to fetch auth tokens from db: %v: %w", err, asynq.SkipRetry)
+		}
+
 		return fmt.Errorf("failed to fetch auth tokens from db: %v", err)
 	}
 
-	provider, ok := providers.OAuthProviders[string(authToken.Provider)]
+	syncer, ok := providers.GetSyncer(string(authToken.Provider))
 
 	if !ok {
 		return providers.ErrUnsupportedProvider
 	}
 
-	err = provider.SyncFiles(ctx, conn, *accountID, authToken)
+	if authToken.Status == repository.AccountStatusEnumNeedsReauth {
+		err := fmt.Errorf("%w, link it again to resume syncing", providers.ErrInvalidGrant)
+
+		dbErr := queries.UpdateJobLogFailed(ctx, repository.UpdateJobLogFailedParams{
+			Error: db.PGTextField(err.Error()),
+			JobID: jobID,
+		})
+
+		if dbErr != nil {
+			config.LOGGER.Error("failed to insert failed log for job", zap.String("job_id", jobID), zap.Error(dbErr))
+		}
+
+		reporter.PublishStatus(ctx, string(repository.JobStatusEnumFailed), err)
+
+		return fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+	}
+
+	accountTokens := tokens.New(conn, *accountID, authToken)
+
+	itemCount, err := catalog.Sync(ctx, conn, *accountID, string(authToken.Provider), syncer, accountTokens.Account(), reporter)
 
 	if err != nil {
 
@@ -107,6 +334,13 @@ func HandleFileSyncTask(ctx context.Context, t *asynq.Task) error {
 			config.LOGGER.Error("failed to insert failed log for job", zap.String("job_id", jobID), zap.Error(err))
 		}
 
+		reporter.PublishStatus(ctx, string(repository.JobStatusEnumFailed), err)
+
+		// the account was flagged as needing re-authentication, retrying can not bring the grant back
+		if errors.Is(err, providers.ErrInvalidGrant) {
+			return fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+		}
+
 		return err
 	}
 
@@ -119,16 +353,8 @@ func HandleFileSyncTask(ctx context.Context, t *asynq.Task) error {
 		config.LOGGER.Error("failed to insert finish log for job", zap.String("job_id", jobID), zap.Error(err))
 	}
 
-	newTask, err := NewFileSyncTask(p.UserID, p.AccountID)
-
-	if err == nil {
-		asynqclient := db.GetAsynqClient()
-
-		processAt := time.Now().Add(time.Duration(config.AsynqConfig.FILE_SYNC_INTERVAL) * time.Minute)
-
-		asynqclient.Enqueue(newTask, asynq.ProcessAt(processAt), asynq.Unique(6*time.Minute))
-	}
+	reporter.PublishStatus(ctx, string(repository.JobStatusEnumSucceeded), nil)
 
-	config.LOGGER.Info("worker completed synching files to the db", zap.String("user_id", p.UserID), zap.String("account_id", p.AccountID))
+	config.LOGGER.Info("worker completed synching files to the db", zap.String("user_id", p.UserID), zap.String("account_id", p.AccountID), zap.Int("item_count", itemCount))
 	return nil
 }
@@ -0,0 +1,232 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/tokens"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+const (
+	TypeGoogleChannelRenewal = "google:channel-renewal"
+)
+
+const (
+	GOOGLE_WEBHOOK_PATH = "/api/v1/webhooks/google"
+	// GOOGLE_CHANNEL_RENEW_BEFORE is how long before its expiry a channel is replaced
+	GOOGLE_CHANNEL_RENEW_BEFORE      = time.Hour
+	GOOGLE_CHANNEL_RENEWAL_MAX_RETRY = 5
+)
+
+type GoogleChannelRenewalPayload struct {
+	UserID    string
+	AccountID string
+}
+
+func NewGoogleChannelRenewalTask(userID, accountID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(GoogleChannelRenewalPayload{UserID: userID, AccountID: accountID})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TypeGoogleChannelRenewal, payload), nil
+}
+
+// GoogleChannelRenewalTaskID is the task id of the channel renewal of an account due at processAt. A renewal retried
+// after its channel was already replaced schedules the next one once.
+func GoogleChannelRenewalTaskID(accountID string, processAt time.Time) string {
+	return fmt.Sprintf("%s:%s:%d", TypeGoogleChannelRenewal, accountID, processAt.Unix())
+}
+
+// EnqueueGoogleChannelRenewalTask schedules the channel renewal of an account at processAt, a renewal that is already
+// scheduled for then is left as it is.
+func EnqueueGoogleChannelRenewalTask(userID, accountID string, processAt time.Time, asynqClient *asynq.Client) error {
+	task, err := NewGoogleChannelRenewalTask(userID, accountID)
+	if err != nil {
+		return err
+	}
+
+	_, err = asynqClient.Enqueue(
+		task,
+		asynq.Queue(QUEUE_LOW),
+		asynq.MaxRetry(GOOGLE_CHANNEL_RENEWAL_MAX_RETRY),
+		asynq.ProcessAt(processAt),
+		asynq.TaskID(GoogleChannelRenewalTaskID(accountID, processAt)),
+	)
+
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+
+	return err
+}
+
+// ensureGoogleChannel renews the channel of an account right away when it has none or it expired. Renewals schedule
+// each other, a chain broken by a renewal that ran out of retries is picked up again by the next scheduled sync.
+func ensureGoogleChannel(ctx context.Context, queries *repository.Queries, userID string, accountID pgtype.UUID) {
+	if config.APIConfig.PUBLIC_URL == "" {
+		return
+	}
+
+	channel, err := queries.GetGoogleChannelByAccountID(ctx, accountID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		config.LOGGER.Error("failed to fetch google channel", zap.String("account_id", accountID.String()), zap.Error(err))
+		return
+	}
+
+	if err == nil && time.Now().Before(channel.ExpiresAt.Time) {
+		return
+	}
+
+	if err := EnqueueGoogleChannelRenewalTask(userID, accountID.String(), time.Now(), db.GetAsynqClient()); err != nil {
+		config.LOGGER.Error("failed to enqueue google channel renewal", zap.String("account_id", accountID.String()), zap.Error(err))
+		return
+	}
+
+	config.LOGGER.Warn("google channel missing or expired, renewing it", zap.String("account_id", accountID.String()))
+}
+
+// HandleGoogleChannelRenewalTask opens a new change channel for the account, stores it in place of the previous one and
+// stops the previous one. Drive channels cannot be extended, the task schedules itself again shortly before the new
+// channel expires. A stored channel that is not due for renewal is left alone, only its renewal is scheduled again in
+// case this is the retry of a renewal that replaced it but failed to schedule the next one.
+func HandleGoogleChannelRenewalTask(ctx context.Context, t *asynq.Task) error {
+
+	var p GoogleChannelRenewalPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("file to unmarshal task payload: %v", err)
+	}
+
+	if config.APIConfig.PUBLIC_URL == "" {
+		config.LOGGER.Warn("PUBLIC_URL is not set, skipping google channel renewal", zap.String("account_id", p.AccountID))
+		return nil
+	}
+
+	conn, err := db.ConnPool.Acquire(ctx)
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		return fmt.Errorf("failed to acquire new connection from connection pool: %v", err)
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, err := db.PGUUID(p.AccountID)
+
+	if err != nil {
+		config.LOGGER.Error("failed to parse UUID string", zap.Error(err))
+		return fmt.Errorf("failed to parse UUID string")
+	}
+
+	authToken, err := queries.GetAuthTokens(ctx, repository.GetAuthTokensParams{
+		UserID:    p.UserID,
+		AccountID: *accountID,
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// the account was unlinked, its channel went with it
+			return nil
+		}
+		config.LOGGER.Error("failed to fetch auth tokens from db", zap.Error(err), zap.String("user_id", p.UserID), zap.String("account_id", p.AccountID))
+		return fmt.Errorf("failed to fetch auth tokens from db: %v", err)
+	}
+
+	// paused accounts and accounts waiting to be linked again are not synced, the channel is left to expire. The
+	// scheduled sync opens a new one once the account is active again
+	if authToken.Status != repository.AccountStatusEnumActive {
+		config.LOGGER.Info("account is not active, skipping google channel renewal", zap.String("account_id", p.AccountID), zap.String("status", string(authToken.Status)))
+		return fmt.Errorf("account is %s: %w", authToken.Status, asynq.SkipRetry)
+	}
+
+	watcher, ok := providers.GetChangeWatcher(string(authToken.Provider))
+	if !ok {
+		return providers.ErrUnsupportedProvider
+	}
+
+	previous, err := queries.GetGoogleChannelByAccountID(ctx, *accountID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		config.LOGGER.Error("failed to fetch google channel", zap.String("account_id", p.AccountID), zap.Error(err))
+		return err
+	}
+
+	hasPrevious := err == nil
+
+	if hasPrevious && time.Until(previous.ExpiresAt.Time) > 2*GOOGLE_CHANNEL_RENEW_BEFORE {
+		return EnqueueGoogleChannelRenewalTask(p.UserID, p.AccountID, previous.ExpiresAt.Time.Add(-GOOGLE_CHANNEL_RENEW_BEFORE), db.GetAsynqClient())
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	channelToken := hex.EncodeToString(secret)
+
+	encryptedToken, err := utils.Encrypt(channelToken)
+	if err != nil {
+		config.LOGGER.Error("failed to encrypt channel token", zap.String("account_id", p.AccountID), zap.Error(err))
+		return err
+	}
+
+	account := tokens.New(conn, *accountID, authToken).Account()
+
+	address := strings.TrimSuffix(config.APIConfig.PUBLIC_URL, "/") + GOOGLE_WEBHOOK_PATH
+
+	channel, err := watcher.Watch(ctx, account, uuid.NewString(), channelToken, address)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := channel.ExpiresAt
+
+	err = queries.SaveGoogleChannel(ctx, repository.SaveGoogleChannelParams{
+		ChannelID:  channel.ID,
+		AccountID:  *accountID,
+		ResourceID: channel.ResourceID,
+		Token:      encryptedToken,
+		ExpiresAt:  db.PGTimestamptzField(expiresAt),
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to save google channel", zap.String("account_id", p.AccountID), zap.Error(err))
+
+		if err := watcher.Stop(ctx, account, channel.ID, channel.ResourceID); err != nil {
+			config.LOGGER.Warn("failed to stop unsaved google channel", zap.String("account_id", p.AccountID), zap.Error(err))
+		}
+
+		return err
+	}
+
+	// notifications of the previous channel are rejected once it is replaced, stopping it only saves the traffic
+	if hasPrevious && time.Now().Before(previous.ExpiresAt.Time) {
+		if err := watcher.Stop(ctx, account, previous.ChannelID, previous.ResourceID); err != nil {
+			config.LOGGER.Warn("failed to stop previous google channel", zap.String("account_id", p.AccountID), zap.String("channel_id", previous.ChannelID), zap.Error(err))
+		}
+	}
+
+	config.LOGGER.Info("worker renewed google channel", zap.String("account_id", p.AccountID), zap.String("channel_id", channel.ID), zap.Time("expires_at", expiresAt))
+
+	// the retry finds the new channel and only schedules its renewal
+	if err := EnqueueGoogleChannelRenewalTask(p.UserID, p.AccountID, expiresAt.Add(-GOOGLE_CHANNEL_RENEW_BEFORE), db.GetAsynqClient()); err != nil {
+		config.LOGGER.Error("failed to schedule next google channel renewal", zap.String("account_id", p.AccountID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/redis/go-redis/v9"
+)
+
+// holdLeaderScript takes the lock when it is free and extends it when the caller already holds it.
+var holdLeaderScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+
+if current == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+
+if not current then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+
+return 0
+`)
+
+// releaseLeaderScript deletes the lock only when it is still held by the caller.
+var releaseLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+
+return 0
+`)
+
+// leaderLock elects one process among the workers for work that must not run twice. The leader has to call hold
+// again before ttl runs out, a leader that stops doing so is replaced once the lock expired.
+type leaderLock struct {
+	key   string
+	value string
+	ttl   time.Duration
+}
+
+func newLeaderLock(name string, ttl time.Duration) (*leaderLock, error) {
+	value := make([]byte, 16)
+	if _, err := rand.Read(value); err != nil {
+		return nil, err
+	}
+
+	return &leaderLock{key: "leader:" + name, value: hex.EncodeToString(value), ttl: ttl}, nil
+}
+
+// hold takes or extends the lock and reports whether the caller leads.
+func (l *leaderLock) hold(ctx context.Context) (bool, error) {
+	return holdLeaderScript.Run(ctx, db.RedisClient, []string{l.key}, l.value, l.ttl.Milliseconds()).Bool()
+}
+
+func (l *leaderLock) release(ctx context.Context) error {
+	return releaseLeaderScript.Run(context.WithoutCancel(ctx), db.RedisClient, []string{l.key}, l.value).Err()
+}
@@ -0,0 +1,215 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	TypeFileSyncSchedule = "file:schedule"
+	TypeSyncOverdueCheck = "sync:overdue-check"
+)
+
+const (
+	// SYNC_SCHEDULE_RELOAD_INTERVAL is how often the scheduler reads the schedules again, new accounts, changed
+	// intervals, paused and unlinked accounts are picked up within it
+	SYNC_SCHEDULE_RELOAD_INTERVAL = time.Minute
+	SYNC_OVERDUE_CHECK_CRONSPEC   = "*/15 * * * *"
+	// SYNC_MIN_INTERVAL_MINUTES is the shortest interval an account is synced at
+	SYNC_MIN_INTERVAL_MINUTES = 5
+	// SYNC_OVERDUE_GRACE_MINUTES is added to twice the interval of an account before its last successful sync counts
+	// as overdue
+	SYNC_OVERDUE_GRACE_MINUTES = 15
+)
+
+// SyncScheduleProvider hands the schedule of every active account to the asynq periodic task manager. A schedule
+// enqueues a small tick task rather than the sync itself, the tick enqueues the sync through EnqueueFileSyncOnce so it
+// is logged in job_logs and does not pile up behind a sync that is still running.
+type SyncScheduleProvider struct{}
+
+func (p *SyncScheduleProvider) GetConfigs() ([]*asynq.PeriodicTaskConfig, error) {
+	ctx := context.Background()
+
+	conn, err := db.ConnPool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	schedules, err := repository.New(conn).GetActiveSyncSchedules(ctx, int32(config.AsynqConfig.FILE_SYNC_INTERVAL))
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]*asynq.PeriodicTaskConfig, 0, len(schedules)+1)
+
+	for _, schedule := range schedules {
+		if _, ok := providers.GetSyncer(string(schedule.Provider)); !ok {
+			continue
+		}
+
+		payload, err := json.Marshal(FileSyncPayload{UserID: schedule.UserID, AccountID: schedule.ID.String()})
+		if err != nil {
+			return nil, err
+		}
+
+		interval := time.Duration(schedule.IntervalMinutes) * time.Minute
+
+		configs = append(configs, &asynq.PeriodicTaskConfig{
+			Cronspec: syncCronspec(schedule.ID.String(), int(schedule.IntervalMinutes)),
+			Task:     asynq.NewTask(TypeFileSyncSchedule, payload),
+			// every worker runs a scheduler, the lock lets one tick per interval through
+			Opts: []asynq.Option{asynq.Queue(QUEUE_LOW), asynq.MaxRetry(0), asynq.Unique(interval)},
+		})
+	}
+
+	configs = append(configs, &asynq.PeriodicTaskConfig{
+		Cronspec: SYNC_OVERDUE_CHECK_CRONSPEC,
+		Task:     asynq.NewTask(TypeSyncOverdueCheck, nil),
+		Opts:     []asynq.Option{asynq.Queue(QUEUE_LOW), asynq.MaxRetry(0), asynq.Unique(10 * time.Minute)},
+	})
+
+	return configs, nil
+}
+
+// syncCronspec returns the cronspec running every interval minutes. Accounts sharing an interval are spread over it by
+// their id, so they do not all start syncing in the same minute. Intervals that do not divide an hour or a day fall
+// back to @every, which counts from when the scheduler started. Intervals below SYNC_MIN_INTERVAL_MINUTES, such as a
+// misconfigured default, are raised to it.
+func syncCronspec(accountID string, interval int) string {
+	interval = max(interval, SYNC_MIN_INTERVAL_MINUTES)
+
+	h := fnv.New32a()
+	h.Write([]byte(accountID))
+	spread := int(h.Sum32())
+
+	switch {
+	case interval < 60 && 60%interval == 0:
+		return fmt.Sprintf("%d-59/%d * * * *", spread%interval, interval)
+	case interval%60 == 0 && 24%(interval/60) == 0:
+		hours := interval / 60
+		return fmt.Sprintf("%d %d-23/%d * * *", spread%60, (spread/60)%hours, hours)
+	}
+
+	return fmt.Sprintf("@every %dm", interval)
+}
+
+func NewSyncScheduler() (*asynq.PeriodicTaskManager, error) {
+	return asynq.NewPeriodicTaskManager(asynq.PeriodicTaskManagerOpts{
+		RedisConnOpt: asynq.RedisClientOpt{
+			Addr:     fmt.Sprintf("%s:%s", config.RedisConfig.HOST, config.RedisConfig.PORT),
+			Password: config.RedisConfig.PASS,
+			DB:       config.RedisConfig.DB,
+		},
+		PeriodicTaskConfigProvider: &SyncScheduleProvider{},
+		SyncInterval:               SYNC_SCHEDULE_RELOAD_INTERVAL,
+	})
+}
+
+// HandleFileSyncScheduleTask enqueues the scheduled sync of an account and replaces its change channel when it is
+// missing or expired. Ticks still queued for an account that was unlinked or left the active status since are dropped.
+func HandleFileSyncScheduleTask(ctx context.Context, t *asynq.Task) error {
+
+	var p FileSyncPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("file to unmarshal task payload: %v", err)
+	}
+
+	conn, err := db.ConnPool.Acquire(ctx)
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		return fmt.Errorf("failed to acquire new connection from connection pool: %v", err)
+	}
+	defer conn.Release()
+
+	queries := repository.New(conn)
+
+	accountID, err := db.PGUUID(p.AccountID)
+	if err != nil {
+		config.LOGGER.Error("failed to parse UUID string", zap.Error(err))
+		return fmt.Errorf("failed to parse UUID string")
+	}
+
+	schedule, err := queries.GetSyncSchedule(ctx, repository.GetSyncScheduleParams{
+		DefaultInterval: int32(config.AsynqConfig.FILE_SYNC_INTERVAL),
+		AccountID:       *accountID,
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		config.LOGGER.Error("failed to fetch sync schedule", zap.String("account_id", p.AccountID), zap.Error(err))
+		return err
+	}
+
+	if schedule.Status != repository.AccountStatusEnumActive {
+		return nil
+	}
+
+	if _, ok := providers.GetChangeWatcher(string(schedule.Provider)); ok {
+		ensureGoogleChannel(ctx, queries, schedule.UserID, *accountID)
+	}
+
+	info, alreadyQueued, err := EnqueueFileSyncOnce(ctx, schedule.UserID, p.AccountID, string(schedule.Provider), QUEUE_DEFAULT, queries)
+	if err != nil {
+		return err
+	}
+
+	if alreadyQueued {
+		config.LOGGER.Debug("scheduled sync skipped, a sync is already queued", zap.String("account_id", p.AccountID), zap.String("task_id", info.ID))
+	}
+
+	return nil
+}
+
+// HandleSyncOverdueCheckTask marks active accounts that have not synced successfully for more than twice their interval,
+// their syncs keep failing or are not being scheduled. The mark is listed with the accounts and cleared by the first
+// check after a successful sync, an account is reported once per overdue stretch rather than on every check.
+func HandleSyncOverdueCheckTask(ctx context.Context, t *asynq.Task) error {
+	conn, err := db.ConnPool.Acquire(ctx)
+	if err != nil {
+		config.LOGGER.Error("failed to acquire new connection from connection pool", zap.Error(err))
+		return fmt.Errorf("failed to acquire new connection from connection pool: %v", err)
+	}
+	defer conn.Release()
+
+	accounts, err := repository.New(conn).MarkOverdueAccounts(ctx, repository.MarkOverdueAccountsParams{
+		DefaultInterval: int32(config.AsynqConfig.FILE_SYNC_INTERVAL),
+		GraceMinutes:    SYNC_OVERDUE_GRACE_MINUTES,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to mark overdue accounts", zap.Error(err))
+		return err
+	}
+
+	for _, account := range accounts {
+		fields := []zap.Field{
+			zap.String("provider", string(account.Provider)),
+			zap.String("user_id", account.UserID),
+			zap.String("account_id", account.ID.String()),
+			zap.Int32("interval_minutes", account.IntervalMinutes),
+		}
+
+		if account.LastSucceededAt.Valid {
+			fields = append(fields, zap.Time("last_succeeded_at", account.LastSucceededAt.Time))
+		}
+
+		config.LOGGER.Error("account sync is overdue", fields...)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// REFRESH_LOCK_TTL bounds how long a refresh holds the lock of an account, the refresh itself is cancelled before
+	// the lock runs out so a second refresh never starts next to it
+	REFRESH_LOCK_TTL = time.Minute
+	// REFRESH_LOCK_POLL_INTERVAL is how often a caller waiting for the lock tries again
+	REFRESH_LOCK_POLL_INTERVAL = 100 * time.Millisecond
+)
+
+var ErrRefreshLockTimeout = errors.New("timed out waiting for the token refresh of this account")
+
+// releaseLockScript deletes the lock only when it is still held by the caller, a lock that expired and was taken by
+// someone else is left alone.
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+
+return 0
+`)
+
+// refreshLock serialises token refreshes of one account across processes.
+type refreshLock struct {
+	key   string
+	value string
+}
+
+func newRefreshLock(accountID string) *refreshLock {
+	return &refreshLock{key: "token-refresh:" + accountID}
+}
+
+// acquire waits until the lock is taken or REFRESH_LOCK_TTL passed, whoever holds it has either finished or lost it
+// by then.
+func (l *refreshLock) acquire(ctx context.Context) error {
+	value := make([]byte, 16)
+	if _, err := rand.Read(value); err != nil {
+		return err
+	}
+
+	l.value = hex.EncodeToString(value)
+
+	ctx, cancel := context.WithTimeout(ctx, REFRESH_LOCK_TTL)
+	defer cancel()
+
+	ticker := time.NewTicker(REFRESH_LOCK_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		ok, err := db.RedisClient.SetNX(ctx, l.key, l.value, REFRESH_LOCK_TTL).Result()
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrRefreshLockTimeout
+			}
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrRefreshLockTimeout
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *refreshLock) release(ctx context.Context) error {
+	return releaseLockScript.Run(context.WithoutCancel(ctx), db.RedisClient, []string{l.key}, l.value).Err()
+}
@@ -0,0 +1,275 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"github.com/blackmamoth/cloudmesh/pkg/db"
+	"github.com/blackmamoth/cloudmesh/pkg/providers"
+	"github.com/blackmamoth/cloudmesh/pkg/utils"
+	"github.com/blackmamoth/cloudmesh/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// EXPIRY_MARGIN is how long before its expiry an access token is renewed instead of handed out, a call started
+	// with it should not outlive it
+	EXPIRY_MARGIN = 2 * time.Minute
+	// REFRESH_TIMEOUT bounds the call to the provider, it ends well within REFRESH_LOCK_TTL
+	REFRESH_TIMEOUT = 30 * time.Second
+)
+
+var ErrNoRefreshToken = errors.New("this account has no refresh token")
+
+// AccountTokens is the providers.TokenSource of a linked account, it decrypts the stored tokens on demand and writes
+// renewed tokens back to linked_account. Access tokens about to expire are renewed before they are handed out.
+type AccountTokens struct {
+	conn      *pgxpool.Conn
+	accountID pgtype.UUID
+	provider  string
+
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiry       time.Time
+}
+
+func New(conn *pgxpool.Conn, accountID pgtype.UUID, authToken repository.GetAuthTokensRow) *AccountTokens {
+	t := &AccountTokens{
+		conn:         conn,
+		accountID:    accountID,
+		provider:     string(authToken.Provider),
+		accessToken:  authToken.AccessToken,
+		refreshToken: authToken.RefreshToken,
+	}
+
+	if authToken.Expiry.Valid {
+		t.expiry = authToken.Expiry.Time
+	}
+
+	return t
+}
+
+// Account returns the providers.Account handed to provider calls.
+func (t *AccountTokens) Account() providers.Account {
+	return providers.Account{ID: t.accountID.String(), Tokens: t}
+}
+
+func (t *AccountTokens) AccessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.expiresSoon() {
+		token, err := t.refresh(ctx)
+		if err == nil {
+			return token.AccessToken, nil
+		}
+
+		// the provider may be briefly unreachable, the stored token is still good for a little while
+		if time.Now().After(t.expiry) {
+			return "", err
+		}
+
+		config.LOGGER.Warn("could not renew expiring access token, using the stored one", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()), zap.Error(err))
+	}
+
+	accessToken, err := utils.Decrypt(t.accessToken)
+	if err != nil {
+		config.LOGGER.Error("could not decrypt access token", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()))
+		return "", err
+	}
+
+	return accessToken, nil
+}
+
+func (t *AccountTokens) Renew(ctx context.Context) (string, error) {
+	token, err := t.Refresh(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+func (t *AccountTokens) RefreshToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.refreshToken == "" {
+		return "", nil
+	}
+
+	refreshToken, err := utils.Decrypt(t.refreshToken)
+	if err != nil {
+		config.LOGGER.Error("could not decrypt refresh token", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()))
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// Refresh exchanges the stored refresh token for a new token and persists it, a rotated refresh token replaces the
+// stored one in the same statement. Refreshes of an account are serialised across processes by a Redis lock. A caller
+// that waited for the lock reuses the token stored by the refresh before it instead of refreshing again, and always
+// refreshes with the latest stored refresh token, so a rotated one is never overwritten by a stale one. Without the lock
+// there is no refresh, the call fails instead.
+func (t *AccountTokens) Refresh(ctx context.Context) (*oauth2.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.refresh(ctx)
+}
+
+// expiresSoon reports whether the access token expires within EXPIRY_MARGIN and can be renewed.
+func (t *AccountTokens) expiresSoon() bool {
+	return t.refreshToken != "" && !t.expiry.IsZero() && time.Until(t.expiry) < EXPIRY_MARGIN
+}
+
+func (t *AccountTokens) refresh(ctx context.Context) (*oauth2.Token, error) {
+	authenticator, ok := providers.GetAuthenticator(t.provider)
+	if !ok {
+		return nil, providers.ErrUnsupportedAction
+	}
+
+	if t.refreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	lock := newRefreshLock(t.accountID.String())
+
+	// refreshing without the lock could race a rotation elsewhere and store a refresh token that no longer works, the
+	// caller retries once the lock can be taken
+	if err := lock.acquire(ctx); err != nil {
+		config.LOGGER.Error("could not take token refresh lock", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()), zap.Error(err))
+		return nil, err
+	}
+
+	defer func() {
+		if err := lock.release(ctx); err != nil {
+			config.LOGGER.Warn("could not release token refresh lock", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()), zap.Error(err))
+		}
+	}()
+
+	stored, err := repository.New(t.conn).GetAccountTokens(ctx, t.accountID)
+	if err != nil {
+		config.LOGGER.Error("failed to fetch stored oauth tokens", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()), zap.Error(err))
+		return nil, err
+	}
+
+	renewedElsewhere := stored.AccessToken != t.accessToken
+
+	t.accessToken = stored.AccessToken
+	t.refreshToken = stored.RefreshToken
+	t.expiry = time.Time{}
+
+	if stored.Expiry.Valid {
+		t.expiry = stored.Expiry.Time
+	}
+
+	if renewedElsewhere && !t.expiresSoon() {
+		accessToken, err := utils.Decrypt(t.accessToken)
+		if err != nil {
+			config.LOGGER.Error("could not decrypt access token", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()))
+			return nil, err
+		}
+
+		return &oauth2.Token{AccessToken: accessToken, Expiry: t.expiry}, nil
+	}
+
+	if t.refreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	refreshToken, err := utils.Decrypt(t.refreshToken)
+	if err != nil {
+		config.LOGGER.Error("could not decrypt refresh token", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()))
+		return nil, err
+	}
+
+	refreshCtx, cancel := context.WithTimeout(ctx, REFRESH_TIMEOUT)
+	defer cancel()
+
+	token, err := authenticator.RefreshToken(refreshCtx, refreshToken)
+	if err != nil {
+		config.LOGGER.Error("failed to renew oauth token", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()), zap.Error(err))
+
+		if errors.Is(err, providers.ErrInvalidGrant) {
+			t.setStatus(ctx, repository.AccountStatusEnumNeedsReauth, err)
+		}
+
+		return nil, err
+	}
+
+	encryptedAccessToken, err := utils.Encrypt(token.AccessToken)
+	if err != nil {
+		config.LOGGER.Error("failed to encrypt new access token", zap.String("provider", t.provider), zap.Error(err))
+		return nil, err
+	}
+
+	encryptedRefreshToken := t.refreshToken
+
+	// the provider may have invalidated the old refresh token already, the new one is stored even if the caller gave up
+	ctx = context.WithoutCancel(ctx)
+
+	err = utils.WithTransaction(ctx, t.conn, func(tx pgx.Tx) error {
+		qx := repository.New(t.conn).WithTx(tx)
+
+		if token.RefreshToken == "" || token.RefreshToken == refreshToken {
+			return qx.UpdateRenewedAuthToken(ctx, repository.UpdateRenewedAuthTokenParams{
+				AccountID:   t.accountID,
+				AccessToken: encryptedAccessToken,
+				TokenType:   db.PGTextField(token.TokenType),
+				Expiry:      db.PGTimestamptzField(token.Expiry),
+			})
+		}
+
+		// dropbox keeps refresh tokens, microsoft and box rotate them on every renewal
+		encryptedRefreshToken, err = utils.Encrypt(token.RefreshToken)
+		if err != nil {
+			config.LOGGER.Error("failed to encrypt new refresh token", zap.String("provider", t.provider), zap.Error(err))
+			return err
+		}
+
+		return qx.UpdateAuthTokens(ctx, repository.UpdateAuthTokensParams{
+			AccountID:    t.accountID,
+			AccessToken:  encryptedAccessToken,
+			RefreshToken: encryptedRefreshToken,
+			TokenType:    db.PGTextField(token.TokenType),
+			Expiry:       db.PGTimestamptzField(token.Expiry),
+		})
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to update oauth tokens in db", zap.String("provider", t.provider), zap.Error(err))
+		return nil, err
+	}
+
+	t.accessToken = encryptedAccessToken
+	t.refreshToken = encryptedRefreshToken
+	t.expiry = token.Expiry
+
+	return token, nil
+}
+
+// setStatus records why the account stopped working, scheduled syncs skip it until it is linked again.
+func (t *AccountTokens) setStatus(ctx context.Context, status repository.AccountStatusEnum, reason error) {
+	err := repository.New(t.conn).UpdateAccountStatus(context.WithoutCancel(ctx), repository.UpdateAccountStatusParams{
+		Status:       status,
+		StatusReason: db.PGTextField(reason.Error()),
+		AccountID:    t.accountID,
+	})
+
+	if err != nil {
+		config.LOGGER.Error("failed to update account status", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()), zap.String("status", string(status)), zap.Error(err))
+		return
+	}
+
+	config.LOGGER.Warn("account status changed", zap.String("provider", t.provider), zap.String("account_id", t.accountID.String()), zap.String("status", string(status)), zap.Error(reason))
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"expvar"
+	"net/http"
+
+	"github.com/blackmamoth/cloudmesh/pkg/config"
+	"go.uber.org/zap"
+)
+
+// ServeMetrics publishes the expvar counters of the process at /debug/vars on addr. Nothing there is authenticated,
+// addr should only be reachable from inside the deployment.
+func ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			config.LOGGER.Error("metrics server stopped", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+}
@@ -11,6 +11,9 @@ var Validate = validator.New()
 
 func generateMsgForField(fe validator.FieldError, v interface{}) (string, string) {
 	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 
 	field, _ := t.FieldByName(fe.StructField())
 
@@ -43,6 +46,11 @@ func generateMsgForField(fe validator.FieldError, v interface{}) (string, string
 		return jsonTag, fmt.Sprintf("`%s` should be all lower case", jsonTag)
 	case "uuid":
 		return jsonTag, fmt.Sprintf("`%s` should be a valid UUID", jsonTag)
+	case "url":
+		return jsonTag, fmt.Sprintf("`%s` should be a valid URL", jsonTag)
+	case "required_without":
+		otherField, _ := t.FieldByName(fe.Param())
+		return jsonTag, fmt.Sprintf("`%s` is required when `%s` is not provided", jsonTag, otherField.Tag.Get("json"))
 	}
 
 	return fe.Field(), fe.Error()
@@ -40,6 +40,60 @@ func (q *Queries) AddNewJobLog(ctx context.Context, arg AddNewJobLogParams) erro
 	return err
 }
 
+const getActiveJobLog = `-- name: GetActiveJobLog :one
+SELECT job_id, queue, status FROM job_logs
+WHERE account_id = $1 AND type = $2 AND status IN ('queued', 'processing', 'retrying')
+ORDER BY created_at DESC LIMIT 1
+`
+
+type GetActiveJobLogParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	Type      string      `json:"type"`
+}
+
+type GetActiveJobLogRow struct {
+	JobID  string        `json:"job_id"`
+	Queue  string        `json:"queue"`
+	Status JobStatusEnum `json:"status"`
+}
+
+func (q *Queries) GetActiveJobLog(ctx context.Context, arg GetActiveJobLogParams) (GetActiveJobLogRow, error) {
+	row := q.db.QueryRow(ctx, getActiveJobLog, arg.AccountID, arg.Type)
+	var i GetActiveJobLogRow
+	err := row.Scan(&i.JobID, &i.Queue, &i.Status)
+	return i, err
+}
+
+const getPendingJobLogs = `-- name: GetPendingJobLogs :many
+SELECT job_id, queue FROM job_logs
+WHERE account_id = $1 AND status IN ('queued', 'processing', 'retrying')
+`
+
+type GetPendingJobLogsRow struct {
+	JobID string `json:"job_id"`
+	Queue string `json:"queue"`
+}
+
+func (q *Queries) GetPendingJobLogs(ctx context.Context, accountID pgtype.UUID) ([]GetPendingJobLogsRow, error) {
+	rows, err := q.db.Query(ctx, getPendingJobLogs, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetPendingJobLogsRow{}
+	for rows.Next() {
+		var i GetPendingJobLogsRow
+		if err := rows.Scan(&i.JobID, &i.Queue); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateJobLogFailed = `-- name: UpdateJobLogFailed :exec
 UPDATE job_logs SET
 status = 'failed', error = $1
@@ -88,6 +142,22 @@ func (q *Queries) UpdateJobLogRetryCount(ctx context.Context, arg UpdateJobLogRe
 	return err
 }
 
+const updateJobLogSkipped = `-- name: UpdateJobLogSkipped :exec
+UPDATE job_logs SET
+status = 'skipped', finished_at = $1
+WHERE job_id = $2
+`
+
+type UpdateJobLogSkippedParams struct {
+	FinishedAt pgtype.Timestamptz `json:"finished_at"`
+	JobID      string             `json:"job_id"`
+}
+
+func (q *Queries) UpdateJobLogSkipped(ctx context.Context, arg UpdateJobLogSkippedParams) error {
+	_, err := q.db.Exec(ctx, updateJobLogSkipped, arg.FinishedAt, arg.JobID)
+	return err
+}
+
 const updateJobLogStart = `-- name: UpdateJobLogStart :exec
 UPDATE job_logs SET 
 status = 'processing', started_at = $1 
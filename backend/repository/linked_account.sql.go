@@ -50,6 +50,43 @@ func (q *Queries) AddAccountDetails(ctx context.Context, arg AddAccountDetailsPa
 	return id, err
 }
 
+const bumpSyncRulesVersion = `-- name: BumpSyncRulesVersion :one
+UPDATE linked_account SET sync_rules_version = sync_rules_version + 1 WHERE id = $1 RETURNING sync_rules_version
+`
+
+func (q *Queries) BumpSyncRulesVersion(ctx context.Context, accountID pgtype.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, bumpSyncRulesVersion, accountID)
+	var sync_rules_version int32
+	err := row.Scan(&sync_rules_version)
+	return sync_rules_version, err
+}
+
+const clearSyncPageToken = `-- name: ClearSyncPageToken :exec
+UPDATE linked_account SET sync_page_token = NULL WHERE id = $1
+`
+
+func (q *Queries) ClearSyncPageToken(ctx context.Context, accountID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, clearSyncPageToken, accountID)
+	return err
+}
+
+const deleteLinkedAccount = `-- name: DeleteLinkedAccount :execrows
+DELETE FROM linked_account WHERE user_id = $1 AND id = $2
+`
+
+type DeleteLinkedAccountParams struct {
+	UserID    string      `json:"user_id"`
+	AccountID pgtype.UUID `json:"account_id"`
+}
+
+func (q *Queries) DeleteLinkedAccount(ctx context.Context, arg DeleteLinkedAccountParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteLinkedAccount, arg.UserID, arg.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getAccountByProviderID = `-- name: GetAccountByProviderID :one
 SELECT id FROM linked_account WHERE user_id = $1 AND provider = $2 AND provider_user_id = $3 LIMIT 1
 `
@@ -67,8 +104,108 @@ func (q *Queries) GetAccountByProviderID(ctx context.Context, arg GetAccountByPr
 	return id, err
 }
 
+const getAccountDataCounts = `-- name: GetAccountDataCounts :one
+SELECT (SELECT COUNT(*) FROM synced_items WHERE synced_items.account_id = $1)::BIGINT AS synced_items,
+       (SELECT COUNT(*) FROM job_logs WHERE job_logs.account_id = $1)::BIGINT AS job_logs,
+       (SELECT COUNT(*) FROM sync_runs WHERE sync_runs.account_id = $1)::BIGINT AS sync_runs
+`
+
+type GetAccountDataCountsRow struct {
+	SyncedItems int64 `json:"synced_items"`
+	JobLogs     int64 `json:"job_logs"`
+	SyncRuns    int64 `json:"sync_runs"`
+}
+
+func (q *Queries) GetAccountDataCounts(ctx context.Context, accountID pgtype.UUID) (GetAccountDataCountsRow, error) {
+	row := q.db.QueryRow(ctx, getAccountDataCounts, accountID)
+	var i GetAccountDataCountsRow
+	err := row.Scan(&i.SyncedItems, &i.JobLogs, &i.SyncRuns)
+	return i, err
+}
+
+const getAccountTokens = `-- name: GetAccountTokens :one
+SELECT access_token, refresh_token, expiry FROM linked_account WHERE id = $1
+`
+
+type GetAccountTokensRow struct {
+	AccessToken  string             `json:"access_token"`
+	RefreshToken string             `json:"refresh_token"`
+	Expiry       pgtype.Timestamptz `json:"expiry"`
+}
+
+func (q *Queries) GetAccountTokens(ctx context.Context, accountID pgtype.UUID) (GetAccountTokensRow, error) {
+	row := q.db.QueryRow(ctx, getAccountTokens, accountID)
+	var i GetAccountTokensRow
+	err := row.Scan(&i.AccessToken, &i.RefreshToken, &i.Expiry)
+	return i, err
+}
+
+const getAccountsByProviderUserIDs = `-- name: GetAccountsByProviderUserIDs :many
+SELECT id, user_id FROM linked_account WHERE provider = $1 AND provider_user_id = ANY($2::text[]) AND status = 'active'
+`
+
+type GetAccountsByProviderUserIDsParams struct {
+	Provider        ProviderEnum `json:"provider"`
+	ProviderUserIds []string     `json:"provider_user_ids"`
+}
+
+type GetAccountsByProviderUserIDsRow struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID string      `json:"user_id"`
+}
+
+func (q *Queries) GetAccountsByProviderUserIDs(ctx context.Context, arg GetAccountsByProviderUserIDsParams) ([]GetAccountsByProviderUserIDsRow, error) {
+	rows, err := q.db.Query(ctx, getAccountsByProviderUserIDs, arg.Provider, arg.ProviderUserIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAccountsByProviderUserIDsRow{}
+	for rows.Next() {
+		var i GetAccountsByProviderUserIDsRow
+		if err := rows.Scan(&i.ID, &i.UserID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAccountsWithSyncCursor = `-- name: GetAccountsWithSyncCursor :many
+SELECT id, user_id, sync_page_token FROM linked_account WHERE provider = $1 AND sync_page_token IS NOT NULL AND sync_page_token <> '' AND status = 'active'
+`
+
+type GetAccountsWithSyncCursorRow struct {
+	ID            pgtype.UUID `json:"id"`
+	UserID        string      `json:"user_id"`
+	SyncPageToken pgtype.Text `json:"sync_page_token"`
+}
+
+func (q *Queries) GetAccountsWithSyncCursor(ctx context.Context, provider ProviderEnum) ([]GetAccountsWithSyncCursorRow, error) {
+	rows, err := q.db.Query(ctx, getAccountsWithSyncCursor, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAccountsWithSyncCursorRow{}
+	for rows.Next() {
+		var i GetAccountsWithSyncCursorRow
+		if err := rows.Scan(&i.ID, &i.UserID, &i.SyncPageToken); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAuthTokens = `-- name: GetAuthTokens :one
-SELECT provider, access_token, refresh_token FROM linked_account WHERE
+SELECT provider, access_token, refresh_token, expiry, status FROM linked_account WHERE
 user_id = $1 AND id = $2
 `
 
@@ -78,31 +215,46 @@ type GetAuthTokensParams struct {
 }
 
 type GetAuthTokensRow struct {
-	Provider     ProviderEnum `json:"provider"`
-	AccessToken  string       `json:"access_token"`
-	RefreshToken string       `json:"refresh_token"`
+	Provider     ProviderEnum       `json:"provider"`
+	AccessToken  string             `json:"access_token"`
+	RefreshToken string             `json:"refresh_token"`
+	Expiry       pgtype.Timestamptz `json:"expiry"`
+	Status       AccountStatusEnum  `json:"status"`
 }
 
 func (q *Queries) GetAuthTokens(ctx context.Context, arg GetAuthTokensParams) (GetAuthTokensRow, error) {
 	row := q.db.QueryRow(ctx, getAuthTokens, arg.UserID, arg.AccountID)
 	var i GetAuthTokensRow
-	err := row.Scan(&i.Provider, &i.AccessToken, &i.RefreshToken)
+	err := row.Scan(
+		&i.Provider,
+		&i.AccessToken,
+		&i.RefreshToken,
+		&i.Expiry,
+		&i.Status,
+	)
 	return i, err
 }
 
 const getLatestSyncTimeAndPagetoken = `-- name: GetLatestSyncTimeAndPagetoken :one
-SELECT last_synced_at, sync_page_token FROM linked_account WHERE id = $1
+SELECT last_synced_at, sync_page_token, sync_rules_version, synced_rules_version FROM linked_account WHERE id = $1
 `
 
 type GetLatestSyncTimeAndPagetokenRow struct {
-	LastSyncedAt  pgtype.Timestamptz `json:"last_synced_at"`
-	SyncPageToken pgtype.Text        `json:"sync_page_token"`
+	LastSyncedAt       pgtype.Timestamptz `json:"last_synced_at"`
+	SyncPageToken      pgtype.Text        `json:"sync_page_token"`
+	SyncRulesVersion   int32              `json:"sync_rules_version"`
+	SyncedRulesVersion int32              `json:"synced_rules_version"`
 }
 
 func (q *Queries) GetLatestSyncTimeAndPagetoken(ctx context.Context, accountID pgtype.UUID) (GetLatestSyncTimeAndPagetokenRow, error) {
 	row := q.db.QueryRow(ctx, getLatestSyncTimeAndPagetoken, accountID)
 	var i GetLatestSyncTimeAndPagetokenRow
-	err := row.Scan(&i.LastSyncedAt, &i.SyncPageToken)
+	err := row.Scan(
+		&i.LastSyncedAt,
+		&i.SyncPageToken,
+		&i.SyncRulesVersion,
+		&i.SyncedRulesVersion,
+	)
 	return i, err
 }
 
@@ -118,15 +270,19 @@ func (q *Queries) GetLatestSyncTimeByUserID(ctx context.Context, userID string)
 }
 
 const getLinkedAccountsByUserID = `-- name: GetLinkedAccountsByUserID :many
-SELECT provider, name, email, avatar_url, last_synced_at FROM linked_account WHERE user_id = $1
+SELECT id, provider, name, email, avatar_url, last_synced_at, status, status_reason, sync_overdue_since FROM linked_account WHERE user_id = $1
 `
 
 type GetLinkedAccountsByUserIDRow struct {
-	Provider     ProviderEnum       `json:"provider"`
-	Name         string             `json:"name"`
-	Email        string             `json:"email"`
-	AvatarUrl    pgtype.Text        `json:"avatar_url"`
-	LastSyncedAt pgtype.Timestamptz `json:"last_synced_at"`
+	ID               pgtype.UUID        `json:"id"`
+	Provider         ProviderEnum       `json:"provider"`
+	Name             string             `json:"name"`
+	Email            string             `json:"email"`
+	AvatarUrl        pgtype.Text        `json:"avatar_url"`
+	LastSyncedAt     pgtype.Timestamptz `json:"last_synced_at"`
+	Status           AccountStatusEnum  `json:"status"`
+	StatusReason     pgtype.Text        `json:"status_reason"`
+	SyncOverdueSince pgtype.Timestamptz `json:"sync_overdue_since"`
 }
 
 func (q *Queries) GetLinkedAccountsByUserID(ctx context.Context, userID string) ([]GetLinkedAccountsByUserIDRow, error) {
@@ -139,11 +295,15 @@ func (q *Queries) GetLinkedAccountsByUserID(ctx context.Context, userID string)
 	for rows.Next() {
 		var i GetLinkedAccountsByUserIDRow
 		if err := rows.Scan(
+			&i.ID,
 			&i.Provider,
 			&i.Name,
 			&i.Email,
 			&i.AvatarUrl,
 			&i.LastSyncedAt,
+			&i.Status,
+			&i.StatusReason,
+			&i.SyncOverdueSince,
 		); err != nil {
 			return nil, err
 		}
@@ -155,8 +315,41 @@ func (q *Queries) GetLinkedAccountsByUserID(ctx context.Context, userID string)
 	return items, nil
 }
 
+const setAccountPaused = `-- name: SetAccountPaused :execrows
+UPDATE linked_account SET status = CASE WHEN $1::BOOLEAN THEN 'paused' ELSE 'active' END::account_status_enum, updated_at = NOW()
+WHERE id = $2 AND status IN ('active', 'paused')
+`
+
+type SetAccountPausedParams struct {
+	Paused    bool        `json:"paused"`
+	AccountID pgtype.UUID `json:"account_id"`
+}
+
+func (q *Queries) SetAccountPaused(ctx context.Context, arg SetAccountPausedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setAccountPaused, arg.Paused, arg.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateAccountStatus = `-- name: UpdateAccountStatus :exec
+UPDATE linked_account SET status = $1, status_reason = $2, updated_at = NOW() WHERE id = $3
+`
+
+type UpdateAccountStatusParams struct {
+	Status       AccountStatusEnum `json:"status"`
+	StatusReason pgtype.Text       `json:"status_reason"`
+	AccountID    pgtype.UUID       `json:"account_id"`
+}
+
+func (q *Queries) UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) error {
+	_, err := q.db.Exec(ctx, updateAccountStatus, arg.Status, arg.StatusReason, arg.AccountID)
+	return err
+}
+
 const updateAuthTokens = `-- name: UpdateAuthTokens :exec
-UPDATE linked_account SET access_token = $1, refresh_token = $2, token_type = $3, expiry = $4, updated_at = NOW() WHERE id = $5
+UPDATE linked_account SET access_token = $1, refresh_token = $2, token_type = $3, expiry = $4, status = CASE WHEN status = 'paused' THEN status ELSE 'active' END, status_reason = NULL, updated_at = NOW() WHERE id = $5
 `
 
 type UpdateAuthTokensParams struct {
@@ -193,7 +386,7 @@ func (q *Queries) UpdateLastSyncedTimestamp(ctx context.Context, arg UpdateLastS
 }
 
 const updateRenewedAuthToken = `-- name: UpdateRenewedAuthToken :exec
-UPDATE linked_account SET access_token = $1, token_type = $2, expiry = $3, updated_at = NOW() WHERE id = $4
+UPDATE linked_account SET access_token = $1, token_type = $2, expiry = $3, status = CASE WHEN status = 'paused' THEN status ELSE 'active' END, status_reason = NULL, updated_at = NOW() WHERE id = $4
 `
 
 type UpdateRenewedAuthTokenParams struct {
@@ -212,3 +405,17 @@ func (q *Queries) UpdateRenewedAuthToken(ctx context.Context, arg UpdateRenewedA
 	)
 	return err
 }
+
+const updateSyncedRulesVersion = `-- name: UpdateSyncedRulesVersion :exec
+UPDATE linked_account SET synced_rules_version = $1 WHERE id = $2
+`
+
+type UpdateSyncedRulesVersionParams struct {
+	SyncedRulesVersion int32       `json:"synced_rules_version"`
+	AccountID          pgtype.UUID `json:"account_id"`
+}
+
+func (q *Queries) UpdateSyncedRulesVersion(ctx context.Context, arg UpdateSyncedRulesVersionParams) error {
+	_, err := q.db.Exec(ctx, updateSyncedRulesVersion, arg.SyncedRulesVersion, arg.AccountID)
+	return err
+}
@@ -11,6 +11,50 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AccountStatusEnum string
+
+const (
+	AccountStatusEnumActive      AccountStatusEnum = "active"
+	AccountStatusEnumNeedsReauth AccountStatusEnum = "needs_reauth"
+	AccountStatusEnumPaused      AccountStatusEnum = "paused"
+	AccountStatusEnumError       AccountStatusEnum = "error"
+)
+
+func (e *AccountStatusEnum) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = AccountStatusEnum(s)
+	case string:
+		*e = AccountStatusEnum(s)
+	default:
+		return fmt.Errorf("unsupported scan type for AccountStatusEnum: %T", src)
+	}
+	return nil
+}
+
+type NullAccountStatusEnum struct {
+	AccountStatusEnum AccountStatusEnum `json:"account_status_enum"`
+	Valid             bool              `json:"valid"` // Valid is true if AccountStatusEnum is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullAccountStatusEnum) Scan(value interface{}) error {
+	if value == nil {
+		ns.AccountStatusEnum, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.AccountStatusEnum.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullAccountStatusEnum) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.AccountStatusEnum), nil
+}
+
 type JobStatusEnum string
 
 const (
@@ -19,6 +63,7 @@ const (
 	JobStatusEnumSucceeded  JobStatusEnum = "succeeded"
 	JobStatusEnumFailed     JobStatusEnum = "failed"
 	JobStatusEnumRetrying   JobStatusEnum = "retrying"
+	JobStatusEnumSkipped    JobStatusEnum = "skipped"
 )
 
 func (e *JobStatusEnum) Scan(src interface{}) error {
@@ -59,8 +104,14 @@ func (ns NullJobStatusEnum) Value() (driver.Value, error) {
 type ProviderEnum string
 
 const (
-	ProviderEnumGoogle  ProviderEnum = "google"
-	ProviderEnumDropbox ProviderEnum = "dropbox"
+	ProviderEnumGoogle    ProviderEnum = "google"
+	ProviderEnumDropbox   ProviderEnum = "dropbox"
+	ProviderEnumOnedrive  ProviderEnum = "onedrive"
+	ProviderEnumS3        ProviderEnum = "s3"
+	ProviderEnumWebdav    ProviderEnum = "webdav"
+	ProviderEnumSftp      ProviderEnum = "sftp"
+	ProviderEnumBox       ProviderEnum = "box"
+	ProviderEnumAzureBlob ProviderEnum = "azure_blob"
 )
 
 func (e *ProviderEnum) Scan(src interface{}) error {
@@ -98,6 +149,92 @@ func (ns NullProviderEnum) Value() (driver.Value, error) {
 	return string(ns.ProviderEnum), nil
 }
 
+type SyncRuleActionEnum string
+
+const (
+	SyncRuleActionEnumInclude SyncRuleActionEnum = "include"
+	SyncRuleActionEnumExclude SyncRuleActionEnum = "exclude"
+)
+
+func (e *SyncRuleActionEnum) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = SyncRuleActionEnum(s)
+	case string:
+		*e = SyncRuleActionEnum(s)
+	default:
+		return fmt.Errorf("unsupported scan type for SyncRuleActionEnum: %T", src)
+	}
+	return nil
+}
+
+type NullSyncRuleActionEnum struct {
+	SyncRuleActionEnum SyncRuleActionEnum `json:"sync_rule_action_enum"`
+	Valid              bool               `json:"valid"` // Valid is true if SyncRuleActionEnum is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullSyncRuleActionEnum) Scan(value interface{}) error {
+	if value == nil {
+		ns.SyncRuleActionEnum, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.SyncRuleActionEnum.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullSyncRuleActionEnum) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.SyncRuleActionEnum), nil
+}
+
+type SyncRuleTypeEnum string
+
+const (
+	SyncRuleTypeEnumPath      SyncRuleTypeEnum = "path"
+	SyncRuleTypeEnumID        SyncRuleTypeEnum = "id"
+	SyncRuleTypeEnumName      SyncRuleTypeEnum = "name"
+	SyncRuleTypeEnumExtension SyncRuleTypeEnum = "extension"
+)
+
+func (e *SyncRuleTypeEnum) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = SyncRuleTypeEnum(s)
+	case string:
+		*e = SyncRuleTypeEnum(s)
+	default:
+		return fmt.Errorf("unsupported scan type for SyncRuleTypeEnum: %T", src)
+	}
+	return nil
+}
+
+type NullSyncRuleTypeEnum struct {
+	SyncRuleTypeEnum SyncRuleTypeEnum `json:"sync_rule_type_enum"`
+	Valid            bool             `json:"valid"` // Valid is true if SyncRuleTypeEnum is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullSyncRuleTypeEnum) Scan(value interface{}) error {
+	if value == nil {
+		ns.SyncRuleTypeEnum, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.SyncRuleTypeEnum.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullSyncRuleTypeEnum) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.SyncRuleTypeEnum), nil
+}
+
 type Account struct {
 	ID                    string           `json:"id"`
 	AccountID             string           `json:"account_id"`
@@ -120,6 +257,16 @@ type DrizzleDrizzleMigration struct {
 	CreatedAt pgtype.Int8 `json:"created_at"`
 }
 
+type GoogleChannel struct {
+	ChannelID  string             `json:"channel_id"`
+	AccountID  pgtype.UUID        `json:"account_id"`
+	ResourceID string             `json:"resource_id"`
+	Token      string             `json:"token"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
+}
+
 type JobLog struct {
 	ID         pgtype.UUID        `json:"id"`
 	JobID      string             `json:"job_id"`
@@ -144,21 +291,26 @@ type Jwk struct {
 }
 
 type LinkedAccount struct {
-	ID             pgtype.UUID        `json:"id"`
-	UserID         string             `json:"user_id"`
-	Provider       ProviderEnum       `json:"provider"`
-	ProviderUserID string             `json:"provider_user_id"`
-	Name           string             `json:"name"`
-	Email          string             `json:"email"`
-	AvatarUrl      pgtype.Text        `json:"avatar_url"`
-	AccessToken    string             `json:"access_token"`
-	RefreshToken   string             `json:"refresh_token"`
-	TokenType      pgtype.Text        `json:"token_type"`
-	Expiry         pgtype.Timestamptz `json:"expiry"`
-	CreatedAt      pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
-	LastSyncedAt   pgtype.Timestamptz `json:"last_synced_at"`
-	SyncPageToken  pgtype.Text        `json:"sync_page_token"`
+	ID                 pgtype.UUID        `json:"id"`
+	UserID             string             `json:"user_id"`
+	Provider           ProviderEnum       `json:"provider"`
+	ProviderUserID     string             `json:"provider_user_id"`
+	Name               string             `json:"name"`
+	Email              string             `json:"email"`
+	AvatarUrl          pgtype.Text        `json:"avatar_url"`
+	AccessToken        string             `json:"access_token"`
+	RefreshToken       string             `json:"refresh_token"`
+	TokenType          pgtype.Text        `json:"token_type"`
+	Expiry             pgtype.Timestamptz `json:"expiry"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt          pgtype.Timestamptz `json:"updated_at"`
+	LastSyncedAt       pgtype.Timestamptz `json:"last_synced_at"`
+	SyncPageToken      pgtype.Text        `json:"sync_page_token"`
+	SyncRulesVersion   int32              `json:"sync_rules_version"`
+	SyncedRulesVersion int32              `json:"synced_rules_version"`
+	Status             AccountStatusEnum  `json:"status"`
+	StatusReason       pgtype.Text        `json:"status_reason"`
+	SyncOverdueSince   pgtype.Timestamptz `json:"sync_overdue_since"`
 }
 
 type Session struct {
@@ -172,6 +324,56 @@ type Session struct {
 	UserID    string           `json:"user_id"`
 }
 
+type SyncCheckpoint struct {
+	AccountID    pgtype.UUID        `json:"account_id"`
+	Checkpoint   string             `json:"checkpoint"`
+	FullSync     bool               `json:"full_sync"`
+	PagesSynced  int32              `json:"pages_synced"`
+	ItemsSynced  int64              `json:"items_synced"`
+	ItemsDeleted int64              `json:"items_deleted"`
+	StartedAt    pgtype.Timestamptz `json:"started_at"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
+}
+
+type SyncRule struct {
+	ID        pgtype.UUID        `json:"id"`
+	AccountID pgtype.UUID        `json:"account_id"`
+	Action    SyncRuleActionEnum `json:"action"`
+	Type      SyncRuleTypeEnum   `json:"type"`
+	Pattern   string             `json:"pattern"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type SyncRun struct {
+	ID             pgtype.UUID        `json:"id"`
+	AccountID      pgtype.UUID        `json:"account_id"`
+	JobID          pgtype.Text        `json:"job_id"`
+	Status         JobStatusEnum      `json:"status"`
+	FullSync       bool               `json:"full_sync"`
+	Resumed        bool               `json:"resumed"`
+	ItemsAdded     int64              `json:"items_added"`
+	ItemsUpdated   int64              `json:"items_updated"`
+	ItemsUnchanged int64              `json:"items_unchanged"`
+	ItemsDeleted   int64              `json:"items_deleted"`
+	ItemsSkipped   int64              `json:"items_skipped"`
+	BytesSeen      int64              `json:"bytes_seen"`
+	PagesFetched   int32              `json:"pages_fetched"`
+	CursorBefore   pgtype.Text        `json:"cursor_before"`
+	CursorAfter    pgtype.Text        `json:"cursor_after"`
+	Error          pgtype.Text        `json:"error"`
+	StartedAt      pgtype.Timestamptz `json:"started_at"`
+	FinishedAt     pgtype.Timestamptz `json:"finished_at"`
+	DurationMs     pgtype.Int8        `json:"duration_ms"`
+}
+
+type SyncSchedule struct {
+	AccountID       pgtype.UUID        `json:"account_id"`
+	IntervalMinutes int32              `json:"interval_minutes"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+}
+
 type SyncedItem struct {
 	ID             pgtype.UUID        `json:"id"`
 	AccountID      pgtype.UUID        `json:"account_id"`
@@ -192,6 +394,11 @@ type SyncedItem struct {
 	ContentHash    pgtype.Text        `json:"content_hash"`
 	CreatedAt      pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	ParentID       pgtype.UUID        `json:"parent_id"`
+	Path           pgtype.Text        `json:"path"`
+	Owner          pgtype.Text        `json:"owner"`
+	IsShared       bool               `json:"is_shared"`
+	SharedWithMe   bool               `json:"shared_with_me"`
 }
 
 type User struct {
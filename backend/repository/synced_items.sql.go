@@ -11,56 +11,53 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type AddSyncedItemsParams struct {
-	AccountID      pgtype.UUID        `json:"account_id"`
-	ProviderFileID string             `json:"provider_file_id"`
-	Name           string             `json:"name"`
-	Extension      string             `json:"extension"`
-	Size           int64              `json:"size"`
-	MimeType       pgtype.Text        `json:"mime_type"`
-	ParentFolder   pgtype.Text        `json:"parent_folder"`
-	IsFolder       bool               `json:"is_folder"`
-	ContentHash    pgtype.Text        `json:"content_hash"`
-	CreatedTime    pgtype.Timestamptz `json:"created_time"`
-	ModifiedTime   pgtype.Timestamptz `json:"modified_time"`
-	ThumbnailLink  pgtype.Text        `json:"thumbnail_link"`
-	PreviewLink    pgtype.Text        `json:"preview_link"`
-	WebViewLink    pgtype.Text        `json:"web_view_link"`
-	WebContentLink pgtype.Text        `json:"web_content_link"`
-	LinkExpiresAt  pgtype.Timestamptz `json:"link_expires_at"`
-}
-
 const countFilesWithFilters = `-- name: CountFilesWithFilters :one
 SELECT COUNT(*)
 FROM   synced_items
        JOIN linked_account
        ON linked_account.id = synced_items.account_id
 WHERE  linked_account.user_id = $1
-       AND (NULLIF($2, '') IS NULL OR synced_items.parent_folder = $2)
-       AND (NULLIF($3, '') IS NULL OR linked_account.provider = $3::provider_enum)
-       AND (NULLIF($4, '') IS NULL OR synced_items.name ILIKE '%' || $4::TEXT || '%')
+       AND (NULLIF($2, '') IS NULL
+            OR ($2 = '/' AND synced_items.parent_id IS NULL AND synced_items.path IS NOT NULL)
+            OR synced_items.parent_id::TEXT = $2
+            -- provider folder ids from before parent references existed are still matched against the stored parent
+            OR ($2 <> '/' AND synced_items.parent_folder = $2))
+       AND (NULLIF($3, '') IS NULL OR LOWER(LEFT(synced_items.path, LENGTH(synced_items.path) - LENGTH(synced_items.name) - 1)) = LOWER(RTRIM($3::TEXT, '/')))
+       AND (NULLIF($4, '') IS NULL OR linked_account.provider = $4::provider_enum)
+       AND (NULLIF($5, '') IS NULL OR synced_items.name ILIKE '%' || $5::TEXT || '%')
+       AND (NULLIF($6, '') IS NULL OR LOWER(synced_items.owner) = LOWER($6::TEXT))
+       AND ($7::BOOLEAN IS NULL OR synced_items.is_shared = $7::BOOLEAN)
+       AND ($8::BOOLEAN IS NULL OR synced_items.shared_with_me = $8::BOOLEAN)
 `
 
 type CountFilesWithFiltersParams struct {
 	UserID       string      `json:"user_id"`
 	ParentFolder interface{} `json:"parent_folder"`
+	Path         interface{} `json:"path"`
 	Provider     interface{} `json:"provider"`
 	Search       interface{} `json:"search"`
+	Owner        interface{} `json:"owner"`
+	IsShared     pgtype.Bool `json:"is_shared"`
+	SharedWithMe pgtype.Bool `json:"shared_with_me"`
 }
 
 func (q *Queries) CountFilesWithFilters(ctx context.Context, arg CountFilesWithFiltersParams) (int64, error) {
 	row := q.db.QueryRow(ctx, countFilesWithFilters,
 		arg.UserID,
 		arg.ParentFolder,
+		arg.Path,
 		arg.Provider,
 		arg.Search,
+		arg.Owner,
+		arg.IsShared,
+		arg.SharedWithMe,
 	)
 	var count int64
 	err := row.Scan(&count)
 	return count, err
 }
 
-const deleteConflictingItems = `-- name: DeleteConflictingItems :exec
+const deleteConflictingItems = `-- name: DeleteConflictingItems :execrows
 DELETE FROM synced_items WHERE provider_file_id = ANY($1::TEXT[]) AND account_id = $2
 `
 
@@ -69,9 +66,228 @@ type DeleteConflictingItemsParams struct {
 	AccountID       pgtype.UUID `json:"account_id"`
 }
 
-func (q *Queries) DeleteConflictingItems(ctx context.Context, arg DeleteConflictingItemsParams) error {
-	_, err := q.db.Exec(ctx, deleteConflictingItems, arg.ProviderFileIds, arg.AccountID)
-	return err
+func (q *Queries) DeleteConflictingItems(ctx context.Context, arg DeleteConflictingItemsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteConflictingItems, arg.ProviderFileIds, arg.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteDescendantItems = `-- name: DeleteDescendantItems :execrows
+WITH RECURSIVE descendants AS (
+    SELECT synced_items.id, synced_items.provider_file_id FROM synced_items
+    WHERE  synced_items.account_id = $1
+           AND (synced_items.parent_folder = ANY($2::TEXT[])
+                OR synced_items.parent_id IN (SELECT parent.id FROM synced_items parent WHERE parent.account_id = $1 AND parent.provider_file_id = ANY($2::TEXT[])))
+    UNION
+    SELECT synced_items.id, synced_items.provider_file_id FROM synced_items JOIN descendants ON synced_items.parent_folder = descendants.provider_file_id OR synced_items.parent_id = descendants.id WHERE synced_items.account_id = $1
+)
+DELETE FROM synced_items WHERE account_id = $1 AND provider_file_id IN (SELECT provider_file_id FROM descendants)
+`
+
+type DeleteDescendantItemsParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	ParentIds []string    `json:"parent_ids"`
+}
+
+func (q *Queries) DeleteDescendantItems(ctx context.Context, arg DeleteDescendantItemsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteDescendantItems, arg.AccountID, arg.ParentIds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteItemsByPath = `-- name: DeleteItemsByPath :execrows
+DELETE FROM synced_items
+WHERE  account_id = $1
+       AND EXISTS (
+           SELECT 1 FROM UNNEST($2::TEXT[]) AS deleted(path)
+           WHERE  LOWER(RTRIM(synced_items.parent_folder, '/') || '/' || synced_items.name) = deleted.path
+                  OR LOWER(synced_items.parent_folder) = deleted.path
+                  OR STARTS_WITH(LOWER(synced_items.parent_folder), deleted.path || '/')
+       )
+`
+
+type DeleteItemsByPathParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	Paths     []string    `json:"paths"`
+}
+
+func (q *Queries) DeleteItemsByPath(ctx context.Context, arg DeleteItemsByPathParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteItemsByPath, arg.AccountID, arg.Paths)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteItemsNotSyncedSince = `-- name: DeleteItemsNotSyncedSince :execrows
+DELETE FROM synced_items WHERE account_id = $1 AND updated_at < $2
+`
+
+type DeleteItemsNotSyncedSinceParams struct {
+	AccountID   pgtype.UUID        `json:"account_id"`
+	SyncedSince pgtype.Timestamptz `json:"synced_since"`
+}
+
+func (q *Queries) DeleteItemsNotSyncedSince(ctx context.Context, arg DeleteItemsNotSyncedSinceParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteItemsNotSyncedSince, arg.AccountID, arg.SyncedSince)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteItemsUnderPaths = `-- name: DeleteItemsUnderPaths :execrows
+DELETE FROM synced_items
+WHERE  account_id = $1
+       AND EXISTS (
+           SELECT 1 FROM UNNEST($2::TEXT[]) AS excluded(path)
+           WHERE  LOWER(synced_items.path) = excluded.path
+                  OR STARTS_WITH(LOWER(synced_items.path), excluded.path || '/')
+       )
+`
+
+type DeleteItemsUnderPathsParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	Paths     []string    `json:"paths"`
+}
+
+func (q *Queries) DeleteItemsUnderPaths(ctx context.Context, arg DeleteItemsUnderPathsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteItemsUnderPaths, arg.AccountID, arg.Paths)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getItemBreadcrumbs = `-- name: GetItemBreadcrumbs :many
+WITH RECURSIVE ancestors AS (
+    SELECT synced_items.id, synced_items.parent_id, synced_items.name, synced_items.path, 0 AS depth
+    FROM   synced_items
+           JOIN linked_account
+           ON linked_account.id = synced_items.account_id
+    WHERE  synced_items.id = $1 AND linked_account.user_id = $2
+    UNION ALL
+    SELECT synced_items.id, synced_items.parent_id, synced_items.name, synced_items.path, ancestors.depth + 1
+    FROM   synced_items
+           JOIN ancestors
+           ON synced_items.id = ancestors.parent_id
+    WHERE  ancestors.depth < 256
+)
+SELECT id, name, path FROM ancestors ORDER BY depth DESC
+`
+
+type GetItemBreadcrumbsParams struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID string      `json:"user_id"`
+}
+
+type GetItemBreadcrumbsRow struct {
+	ID   pgtype.UUID `json:"id"`
+	Name string      `json:"name"`
+	Path pgtype.Text `json:"path"`
+}
+
+func (q *Queries) GetItemBreadcrumbs(ctx context.Context, arg GetItemBreadcrumbsParams) ([]GetItemBreadcrumbsRow, error) {
+	rows, err := q.db.Query(ctx, getItemBreadcrumbs, arg.ID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetItemBreadcrumbsRow{}
+	for rows.Next() {
+		var i GetItemBreadcrumbsRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.Path); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSyncedItemByID = `-- name: GetSyncedItemByID :one
+SELECT synced_items.account_id,
+       synced_items.provider_file_id,
+       synced_items.name,
+       synced_items.extension,
+       synced_items.size,
+       synced_items.mime_type,
+       synced_items.parent_folder,
+       synced_items.is_folder,
+       linked_account.provider
+FROM   synced_items
+       JOIN linked_account
+       ON linked_account.id = synced_items.account_id
+WHERE  synced_items.id = $1 AND linked_account.user_id = $2
+`
+
+type GetSyncedItemByIDParams struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID string      `json:"user_id"`
+}
+
+type GetSyncedItemByIDRow struct {
+	AccountID      pgtype.UUID  `json:"account_id"`
+	ProviderFileID string       `json:"provider_file_id"`
+	Name           string       `json:"name"`
+	Extension      string       `json:"extension"`
+	Size           int64        `json:"size"`
+	MimeType       pgtype.Text  `json:"mime_type"`
+	ParentFolder   pgtype.Text  `json:"parent_folder"`
+	IsFolder       bool         `json:"is_folder"`
+	Provider       ProviderEnum `json:"provider"`
+}
+
+func (q *Queries) GetSyncedItemByID(ctx context.Context, arg GetSyncedItemByIDParams) (GetSyncedItemByIDRow, error) {
+	row := q.db.QueryRow(ctx, getSyncedItemByID, arg.ID, arg.UserID)
+	var i GetSyncedItemByIDRow
+	err := row.Scan(
+		&i.AccountID,
+		&i.ProviderFileID,
+		&i.Name,
+		&i.Extension,
+		&i.Size,
+		&i.MimeType,
+		&i.ParentFolder,
+		&i.IsFolder,
+		&i.Provider,
+	)
+	return i, err
+}
+
+const getSyncedItemHashes = `-- name: GetSyncedItemHashes :many
+SELECT provider_file_id, content_hash FROM synced_items WHERE account_id = $1
+`
+
+type GetSyncedItemHashesRow struct {
+	ProviderFileID string      `json:"provider_file_id"`
+	ContentHash    pgtype.Text `json:"content_hash"`
+}
+
+func (q *Queries) GetSyncedItemHashes(ctx context.Context, accountID pgtype.UUID) ([]GetSyncedItemHashesRow, error) {
+	rows, err := q.db.Query(ctx, getSyncedItemHashes, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetSyncedItemHashesRow{}
+	for rows.Next() {
+		var i GetSyncedItemHashesRow
+		if err := rows.Scan(&i.ProviderFileID, &i.ContentHash); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getSyncedItems = `-- name: GetSyncedItems :many
@@ -86,48 +302,65 @@ SELECT synced_items.id,
        synced_items.modified_time,
        linked_account.name AS account_name,
        linked_account.avatar_url,
-       linked_account.provider
+       linked_account.provider,
+       synced_items.parent_id,
+       synced_items.path,
+       synced_items.owner,
+       synced_items.is_shared,
+       synced_items.shared_with_me
 FROM   synced_items
        JOIN linked_account
        ON linked_account.id = synced_items.account_id
 WHERE  linked_account.user_id = $1
-       AND (NULLIF($2, '') IS NULL OR synced_items.parent_folder = $2)
-       AND (NULLIF($3, '') IS NULL OR linked_account.provider = $3::provider_enum)
-       AND (NULLIF($4, '') IS NULL OR synced_items.name ILIKE '%' || $4::TEXT || '%')
+       AND (NULLIF($2, '') IS NULL
+            OR ($2 = '/' AND synced_items.parent_id IS NULL AND synced_items.path IS NOT NULL)
+            OR synced_items.parent_id::TEXT = $2
+            -- provider folder ids from before parent references existed are still matched against the stored parent
+            OR ($2 <> '/' AND synced_items.parent_folder = $2))
+       AND (NULLIF($3, '') IS NULL OR LOWER(LEFT(synced_items.path, LENGTH(synced_items.path) - LENGTH(synced_items.name) - 1)) = LOWER(RTRIM($3::TEXT, '/')))
+       AND (NULLIF($4, '') IS NULL OR linked_account.provider = $4::provider_enum)
+       AND (NULLIF($5, '') IS NULL OR synced_items.name ILIKE '%' || $5::TEXT || '%')
+       AND (NULLIF($6, '') IS NULL OR LOWER(synced_items.owner) = LOWER($6::TEXT))
+       AND ($7::BOOLEAN IS NULL OR synced_items.is_shared = $7::BOOLEAN)
+       AND ($8::BOOLEAN IS NULL OR synced_items.shared_with_me = $8::BOOLEAN)
        ORDER BY 
        CASE
-           WHEN $5 = 'file_name' AND $6 = 'asc' THEN synced_items.name
+           WHEN $9 = 'file_name' AND $10 = 'asc' THEN synced_items.name
            ELSE NULL -- Explicitly return NULL when not sorting by this
        END ASC,
        CASE
-           WHEN $5 = 'file_name' AND $6 = 'desc' THEN synced_items.name
+           WHEN $9 = 'file_name' AND $10 = 'desc' THEN synced_items.name
            ELSE NULL
        END DESC,
        CASE
-           WHEN $5 = 'size' AND $6 = 'asc' THEN synced_items.size
+           WHEN $9 = 'size' AND $10 = 'asc' THEN synced_items.size
            ELSE NULL
        END ASC,
        CASE
-           WHEN $5 = 'size' AND $6 = 'desc' THEN synced_items.size
+           WHEN $9 = 'size' AND $10 = 'desc' THEN synced_items.size
            ELSE NULL
        END DESC,
        CASE
-           WHEN $5 = 'modified_time' AND $6 = 'asc' THEN synced_items.modified_time::TIMESTAMPTZ
+           WHEN $9 = 'modified_time' AND $10 = 'asc' THEN synced_items.modified_time::TIMESTAMPTZ
            ELSE NULL
        END ASC,
        CASE
-           WHEN $5 = 'modified_time' AND $6 = 'desc' THEN synced_items.modified_time::TIMESTAMPTZ
+           WHEN $9 = 'modified_time' AND $10 = 'desc' THEN synced_items.modified_time::TIMESTAMPTZ
            ELSE NULL
        END DESC,
        synced_items.modified_time DESC
-       LIMIT $8 OFFSET $7
+       LIMIT $12 OFFSET $11
 `
 
 type GetSyncedItemsParams struct {
 	UserID       string      `json:"user_id"`
 	ParentFolder interface{} `json:"parent_folder"`
+	Path         interface{} `json:"path"`
 	Provider     interface{} `json:"provider"`
 	Search       interface{} `json:"search"`
+	Owner        interface{} `json:"owner"`
+	IsShared     pgtype.Bool `json:"is_shared"`
+	SharedWithMe pgtype.Bool `json:"shared_with_me"`
 	SortOn       interface{} `json:"sort_on"`
 	SortBy       interface{} `json:"sort_by"`
 	OffsetBy     int32       `json:"offset_by"`
@@ -147,14 +380,23 @@ type GetSyncedItemsRow struct {
 	AccountName    string             `json:"account_name"`
 	AvatarUrl      pgtype.Text        `json:"avatar_url"`
 	Provider       ProviderEnum       `json:"provider"`
+	ParentID       pgtype.UUID        `json:"parent_id"`
+	Path           pgtype.Text        `json:"path"`
+	Owner          pgtype.Text        `json:"owner"`
+	IsShared       bool               `json:"is_shared"`
+	SharedWithMe   bool               `json:"shared_with_me"`
 }
 
 func (q *Queries) GetSyncedItems(ctx context.Context, arg GetSyncedItemsParams) ([]GetSyncedItemsRow, error) {
 	rows, err := q.db.Query(ctx, getSyncedItems,
 		arg.UserID,
 		arg.ParentFolder,
+		arg.Path,
 		arg.Provider,
 		arg.Search,
+		arg.Owner,
+		arg.IsShared,
+		arg.SharedWithMe,
 		arg.SortOn,
 		arg.SortBy,
 		arg.OffsetBy,
@@ -180,6 +422,11 @@ func (q *Queries) GetSyncedItems(ctx context.Context, arg GetSyncedItemsParams)
 			&i.AccountName,
 			&i.AvatarUrl,
 			&i.Provider,
+			&i.ParentID,
+			&i.Path,
+			&i.Owner,
+			&i.IsShared,
+			&i.SharedWithMe,
 		); err != nil {
 			return nil, err
 		}
@@ -190,3 +437,163 @@ func (q *Queries) GetSyncedItems(ctx context.Context, arg GetSyncedItemsParams)
 	}
 	return items, nil
 }
+
+const refreshItemHierarchy = `-- name: RefreshItemHierarchy :execrows
+WITH RECURSIVE anchors AS (
+    SELECT synced_items.id,
+           synced_items.provider_file_id,
+           parent.id AS parent_id,
+           COALESCE(parent.path, '') || '/' || synced_items.name AS path
+    FROM   synced_items
+           -- dropbox references parents by path, every other provider by the provider file id of the parent
+           LEFT JOIN LATERAL (
+               SELECT candidates.id, candidates.path
+               FROM   (
+                   SELECT candidate.id, candidate.path, 0 AS rank FROM synced_items candidate
+                   WHERE  candidate.account_id = synced_items.account_id AND candidate.provider_file_id = synced_items.parent_folder
+                   UNION ALL
+                   SELECT candidate.id, candidate.path, 1 AS rank FROM synced_items candidate
+                   WHERE  candidate.account_id = synced_items.account_id AND LOWER(candidate.path) = LOWER(synced_items.parent_folder)
+               ) candidates
+               ORDER BY candidates.rank
+               LIMIT 1
+           ) parent ON TRUE
+    WHERE  synced_items.account_id = $1
+           AND synced_items.path IS NULL
+           -- items whose parent is unresolved as well are reached from that parent, items whose parent was never
+           -- synced are placed at the root
+           AND (parent.id IS NULL OR parent.path IS NOT NULL)
+), tree AS (
+    SELECT anchors.id, anchors.provider_file_id, anchors.parent_id, anchors.path, 0 AS depth
+    FROM   anchors
+    UNION ALL
+    SELECT children.id, children.provider_file_id, tree.id, tree.path || '/' || children.name, tree.depth + 1
+    FROM   tree
+           CROSS JOIN LATERAL (
+               SELECT child.id, child.provider_file_id, child.name FROM synced_items child
+               WHERE  child.account_id = $1 AND child.parent_folder = tree.provider_file_id
+               UNION ALL
+               SELECT child.id, child.provider_file_id, child.name FROM synced_items child
+               WHERE  child.account_id = $1
+                      AND LOWER(child.parent_folder) = LOWER(tree.path)
+                      AND NOT EXISTS (
+                          SELECT 1 FROM synced_items parent
+                          WHERE  parent.account_id = child.account_id AND parent.provider_file_id = child.parent_folder
+                      )
+           ) children
+    WHERE  tree.depth < 256
+) CYCLE id SET is_cycle USING visited, resolved AS (
+    -- an item below another unresolved item is reached from both, the longest chain starts at the topmost one
+    SELECT DISTINCT ON (tree.id) tree.id, tree.parent_id, tree.path
+    FROM   tree
+    WHERE  NOT tree.is_cycle
+    ORDER BY tree.id, tree.depth DESC
+)
+UPDATE synced_items
+SET    parent_id = resolved.parent_id, path = resolved.path
+FROM   resolved
+WHERE  synced_items.id = resolved.id
+       AND (synced_items.parent_id IS DISTINCT FROM resolved.parent_id OR synced_items.path IS DISTINCT FROM resolved.path)
+`
+
+// rows written since the last refresh have no path yet, only they and the items below them are resolved again
+func (q *Queries) RefreshItemHierarchy(ctx context.Context, accountID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, refreshItemHierarchy, accountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const touchSyncedItems = `-- name: TouchSyncedItems :exec
+UPDATE synced_items SET updated_at = NOW() WHERE account_id = $1 AND provider_file_id = ANY($2::TEXT[])
+`
+
+type TouchSyncedItemsParams struct {
+	AccountID       pgtype.UUID `json:"account_id"`
+	ProviderFileIds []string    `json:"provider_file_ids"`
+}
+
+func (q *Queries) TouchSyncedItems(ctx context.Context, arg TouchSyncedItemsParams) error {
+	_, err := q.db.Exec(ctx, touchSyncedItems, arg.AccountID, arg.ProviderFileIds)
+	return err
+}
+
+const upsertSyncedItems = `-- name: UpsertSyncedItems :one
+WITH upserted AS (
+    INSERT INTO synced_items (
+        account_id, provider_file_id, name, extension, size, mime_type, parent_folder, is_folder, content_hash, created_time, modified_time, thumbnail_link, preview_link, web_view_link, web_content_link, link_expires_at, owner, is_shared, shared_with_me
+    )
+    SELECT $1::UUID, items.provider_file_id, items.name, items.extension, items.size, NULLIF(items.mime_type, ''), NULLIF(items.parent_folder, ''), items.is_folder, NULLIF(items.content_hash, ''), items.created_time, items.modified_time, NULLIF(items.thumbnail_link, ''), NULLIF(items.preview_link, ''), NULLIF(items.web_view_link, ''), NULLIF(items.web_content_link, ''), items.link_expires_at, NULLIF(items.owner, ''), items.is_shared, items.shared_with_me
+    FROM   UNNEST(
+               $2::TEXT[], $3::TEXT[], $4::TEXT[], $5::BIGINT[], $6::TEXT[], $7::TEXT[], $8::BOOLEAN[], $9::TEXT[],
+               $10::TIMESTAMPTZ[], $11::TIMESTAMPTZ[], $12::TEXT[], $13::TEXT[], $14::TEXT[], $15::TEXT[],
+               $16::TIMESTAMPTZ[], $17::TEXT[], $18::BOOLEAN[], $19::BOOLEAN[]
+           ) AS items (provider_file_id, name, extension, size, mime_type, parent_folder, is_folder, content_hash, created_time, modified_time, thumbnail_link, preview_link, web_view_link, web_content_link, link_expires_at, owner, is_shared, shared_with_me)
+    ON CONFLICT (account_id, provider_file_id) DO UPDATE SET
+    name = EXCLUDED.name, extension = EXCLUDED.extension, size = EXCLUDED.size, mime_type = EXCLUDED.mime_type, parent_folder = EXCLUDED.parent_folder, is_folder = EXCLUDED.is_folder,
+    content_hash = EXCLUDED.content_hash, created_time = EXCLUDED.created_time, modified_time = EXCLUDED.modified_time, thumbnail_link = EXCLUDED.thumbnail_link, preview_link = EXCLUDED.preview_link,
+    web_view_link = EXCLUDED.web_view_link, web_content_link = EXCLUDED.web_content_link, link_expires_at = EXCLUDED.link_expires_at, owner = EXCLUDED.owner, is_shared = EXCLUDED.is_shared,
+    shared_with_me = EXCLUDED.shared_with_me, updated_at = NOW(),
+    -- a renamed or moved item is resolved again by RefreshItemHierarchy along with everything below it
+    path = CASE WHEN synced_items.name = EXCLUDED.name AND synced_items.parent_folder IS NOT DISTINCT FROM EXCLUDED.parent_folder THEN synced_items.path END
+    -- xmax is only zero on rows the statement inserted
+    RETURNING xmax = 0 AS inserted
+)
+SELECT COUNT(*)::BIGINT AS written, COUNT(*) FILTER (WHERE NOT upserted.inserted)::BIGINT AS replaced FROM upserted
+`
+
+type UpsertSyncedItemsParams struct {
+	AccountID       pgtype.UUID          `json:"account_id"`
+	ProviderFileIds []string             `json:"provider_file_ids"`
+	Names           []string             `json:"names"`
+	Extensions      []string             `json:"extensions"`
+	Sizes           []int64              `json:"sizes"`
+	MimeTypes       []string             `json:"mime_types"`
+	ParentFolders   []string             `json:"parent_folders"`
+	IsFolders       []bool               `json:"is_folders"`
+	ContentHashes   []string             `json:"content_hashes"`
+	CreatedTimes    []pgtype.Timestamptz `json:"created_times"`
+	ModifiedTimes   []pgtype.Timestamptz `json:"modified_times"`
+	ThumbnailLinks  []string             `json:"thumbnail_links"`
+	PreviewLinks    []string             `json:"preview_links"`
+	WebViewLinks    []string             `json:"web_view_links"`
+	WebContentLinks []string             `json:"web_content_links"`
+	LinkExpiresAts  []pgtype.Timestamptz `json:"link_expires_ats"`
+	Owners          []string             `json:"owners"`
+	IsShareds       []bool               `json:"is_shareds"`
+	SharedWithMes   []bool               `json:"shared_with_mes"`
+}
+
+type UpsertSyncedItemsRow struct {
+	Written  int64 `json:"written"`
+	Replaced int64 `json:"replaced"`
+}
+
+// rows are written in place of the ones stored under the same provider file id, which keep their id
+func (q *Queries) UpsertSyncedItems(ctx context.Context, arg UpsertSyncedItemsParams) (UpsertSyncedItemsRow, error) {
+	row := q.db.QueryRow(ctx, upsertSyncedItems,
+		arg.AccountID,
+		arg.ProviderFileIds,
+		arg.Names,
+		arg.Extensions,
+		arg.Sizes,
+		arg.MimeTypes,
+		arg.ParentFolders,
+		arg.IsFolders,
+		arg.ContentHashes,
+		arg.CreatedTimes,
+		arg.ModifiedTimes,
+		arg.ThumbnailLinks,
+		arg.PreviewLinks,
+		arg.WebViewLinks,
+		arg.WebContentLinks,
+		arg.LinkExpiresAts,
+		arg.Owners,
+		arg.IsShareds,
+		arg.SharedWithMes,
+	)
+	var i UpsertSyncedItemsRow
+	err := row.Scan(&i.Written, &i.Replaced)
+	return i, err
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE provider_enum ADD VALUE IF NOT EXISTS 'onedrive';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM linked_account WHERE provider = 'onedrive';
+
+ALTER TYPE provider_enum RENAME TO provider_enum_old;
+
+CREATE TYPE provider_enum AS ENUM ('google', 'dropbox');
+
+ALTER TABLE linked_account ALTER COLUMN provider TYPE provider_enum USING provider::TEXT::provider_enum;
+
+DROP TYPE IF EXISTS provider_enum_old;
+-- +goose StatementEnd
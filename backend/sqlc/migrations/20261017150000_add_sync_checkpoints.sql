@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_checkpoints (
+    account_id UUID NOT NULL,
+
+    checkpoint TEXT NOT NULL,
+    full_sync BOOLEAN NOT NULL,
+    pages_synced INT NOT NULL DEFAULT 0,
+    items_synced BIGINT NOT NULL DEFAULT 0,
+    items_deleted BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (account_id),
+    FOREIGN KEY (account_id) REFERENCES linked_account(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sync_checkpoints;
+-- +goose StatementEnd
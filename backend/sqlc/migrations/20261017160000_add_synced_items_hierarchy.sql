@@ -0,0 +1,78 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE synced_items ADD COLUMN IF NOT EXISTS parent_id UUID DEFAULT NULL;
+
+ALTER TABLE synced_items ADD COLUMN IF NOT EXISTS path TEXT DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS synced_items_account_id_provider_file_id_idx ON synced_items (account_id, provider_file_id);
+
+CREATE INDEX IF NOT EXISTS synced_items_account_id_parent_folder_idx ON synced_items (account_id, parent_folder);
+
+CREATE INDEX IF NOT EXISTS synced_items_parent_id_idx ON synced_items (parent_id);
+
+-- object storage parents used to be stored as paths, they now reference the prefix of the parent folder item
+UPDATE synced_items
+SET    parent_folder = SUBSTRING(synced_items.parent_folder FROM 2) || '/'
+FROM   linked_account
+WHERE  linked_account.id = synced_items.account_id
+       AND linked_account.provider IN ('s3', 'azure_blob')
+       AND synced_items.parent_folder <> '/';
+
+-- google files directly in My Drive reference the root folder id, which is never synced itself
+UPDATE synced_items
+SET    parent_folder = '/'
+FROM   linked_account
+WHERE  linked_account.id = synced_items.account_id
+       AND linked_account.provider = 'google'
+       AND NOT EXISTS (
+           SELECT 1 FROM synced_items parent
+           WHERE  parent.account_id = synced_items.account_id AND parent.provider_file_id = synced_items.parent_folder
+       );
+
+WITH RECURSIVE items AS (
+    SELECT synced_items.id,
+           synced_items.account_id,
+           synced_items.provider_file_id,
+           synced_items.parent_folder,
+           synced_items.name,
+           NOT EXISTS (
+               SELECT 1 FROM synced_items parent
+               WHERE  parent.account_id = synced_items.account_id AND parent.provider_file_id = synced_items.parent_folder
+           ) AS parent_by_path
+    FROM   synced_items
+), tree AS (
+    SELECT items.id, items.account_id, items.provider_file_id, NULL::UUID AS parent_id, '/' || items.name AS path, 1 AS depth
+    FROM   items
+    WHERE  items.parent_folder IS NULL OR items.parent_folder = '/'
+    UNION ALL
+    SELECT items.id, items.account_id, items.provider_file_id, tree.id, tree.path || '/' || items.name, tree.depth + 1
+    FROM   items
+           JOIN tree
+           ON items.account_id = tree.account_id
+              AND ((NOT items.parent_by_path AND items.parent_folder = tree.provider_file_id)
+                   OR (items.parent_by_path AND LOWER(items.parent_folder) = LOWER(tree.path)))
+    WHERE  tree.depth < 256
+), resolved AS (
+    SELECT DISTINCT ON (items.id) items.id, tree.parent_id, COALESCE(tree.path, '/' || items.name) AS path
+    FROM   items
+           LEFT JOIN tree ON tree.id = items.id
+    ORDER BY items.id, tree.depth
+)
+UPDATE synced_items
+SET    parent_id = resolved.parent_id, path = resolved.path
+FROM   resolved
+WHERE  synced_items.id = resolved.id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS synced_items_parent_id_idx;
+
+DROP INDEX IF EXISTS synced_items_account_id_parent_folder_idx;
+
+DROP INDEX IF EXISTS synced_items_account_id_provider_file_id_idx;
+
+ALTER TABLE synced_items DROP COLUMN IF EXISTS path;
+
+ALTER TABLE synced_items DROP COLUMN IF EXISTS parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS google_channels (
+    channel_id TEXT NOT NULL,
+    account_id UUID NOT NULL,
+
+    resource_id TEXT NOT NULL,
+    token TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (channel_id),
+    UNIQUE (account_id),
+    FOREIGN KEY (account_id) REFERENCES linked_account(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS google_channels;
+-- +goose StatementEnd
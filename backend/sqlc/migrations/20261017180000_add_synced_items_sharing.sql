@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE synced_items ADD COLUMN IF NOT EXISTS owner TEXT DEFAULT NULL;
+
+ALTER TABLE synced_items ADD COLUMN IF NOT EXISTS is_shared BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE synced_items ADD COLUMN IF NOT EXISTS shared_with_me BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- shared drives and files shared with the account only show up in a full listing
+UPDATE linked_account SET sync_page_token = NULL WHERE provider = 'google';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE synced_items DROP COLUMN IF EXISTS shared_with_me;
+
+ALTER TABLE synced_items DROP COLUMN IF EXISTS is_shared;
+
+ALTER TABLE synced_items DROP COLUMN IF EXISTS owner;
+-- +goose StatementEnd
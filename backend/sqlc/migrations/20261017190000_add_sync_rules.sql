@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE sync_rule_action_enum AS ENUM ('include', 'exclude');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TYPE sync_rule_type_enum AS ENUM ('path', 'id', 'name', 'extension');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_rules (
+    id UUID NOT NULL DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL,
+
+    action sync_rule_action_enum NOT NULL,
+    type sync_rule_type_enum NOT NULL,
+    pattern TEXT NOT NULL,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (account_id) REFERENCES linked_account(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_sync_rules_account_id ON sync_rules (account_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE linked_account ADD COLUMN IF NOT EXISTS sync_rules_version INT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE linked_account ADD COLUMN IF NOT EXISTS synced_rules_version INT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE linked_account DROP COLUMN IF EXISTS synced_rules_version;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE linked_account DROP COLUMN IF EXISTS sync_rules_version;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sync_rules;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TYPE IF EXISTS sync_rule_type_enum;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TYPE IF EXISTS sync_rule_action_enum;
+-- +goose StatementEnd
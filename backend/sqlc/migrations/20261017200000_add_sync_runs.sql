@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id UUID NOT NULL DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL,
+    job_id TEXT DEFAULT NULL,
+
+    status job_status_enum NOT NULL DEFAULT 'processing',
+    full_sync BOOLEAN NOT NULL DEFAULT FALSE,
+    resumed BOOLEAN NOT NULL DEFAULT FALSE,
+
+    items_added BIGINT NOT NULL DEFAULT 0,
+    items_updated BIGINT NOT NULL DEFAULT 0,
+    items_unchanged BIGINT NOT NULL DEFAULT 0,
+    items_deleted BIGINT NOT NULL DEFAULT 0,
+    items_skipped BIGINT NOT NULL DEFAULT 0,
+    bytes_seen BIGINT NOT NULL DEFAULT 0,
+    pages_fetched INT NOT NULL DEFAULT 0,
+
+    cursor_before TEXT DEFAULT NULL,
+    cursor_after TEXT DEFAULT NULL,
+    error TEXT DEFAULT NULL,
+
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ DEFAULT NULL,
+    duration_ms BIGINT DEFAULT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (account_id) REFERENCES linked_account(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_sync_runs_account_id_started_at ON sync_runs (account_id, started_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sync_runs;
+-- +goose StatementEnd
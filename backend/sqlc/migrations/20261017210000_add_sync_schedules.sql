@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_schedules (
+    account_id UUID NOT NULL,
+
+    interval_minutes INT NOT NULL CHECK (interval_minutes >= 5),
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (account_id),
+    FOREIGN KEY (account_id) REFERENCES linked_account(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sync_schedules;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE account_status_enum AS ENUM ('active', 'needs_reauth', 'paused', 'error');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE linked_account ADD COLUMN IF NOT EXISTS status account_status_enum NOT NULL DEFAULT 'active';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE linked_account ADD COLUMN IF NOT EXISTS status_reason TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE linked_account DROP COLUMN IF EXISTS status_reason;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE linked_account DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TYPE IF EXISTS account_status_enum;
+-- +goose StatementEnd
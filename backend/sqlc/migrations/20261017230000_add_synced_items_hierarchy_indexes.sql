@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- rows without a path are the ones RefreshItemHierarchy resolves
+CREATE INDEX IF NOT EXISTS synced_items_account_id_unresolved_idx ON synced_items (account_id) WHERE path IS NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- dropbox items reference their parent by path, the parent is looked up by its path and its children by their parent
+CREATE INDEX IF NOT EXISTS synced_items_account_id_lower_path_idx ON synced_items (account_id, LOWER(path));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS synced_items_account_id_lower_parent_folder_idx ON synced_items (account_id, LOWER(parent_folder));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS synced_items_account_id_lower_parent_folder_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS synced_items_account_id_lower_path_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS synced_items_account_id_unresolved_idx;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE linked_account ADD COLUMN IF NOT EXISTS sync_overdue_since TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE linked_account DROP COLUMN IF EXISTS sync_overdue_since;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE job_status_enum ADD VALUE IF NOT EXISTS 'skipped';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- enum values can not be dropped, skipped jobs count as succeeded again
+UPDATE job_logs SET status = 'succeeded' WHERE status = 'skipped';
+-- +goose StatementEnd
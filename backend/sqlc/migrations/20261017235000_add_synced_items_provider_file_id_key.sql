@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- an item listed twice in one page was stored twice, only the copy written last is kept
+DELETE FROM synced_items
+WHERE  id IN (
+    SELECT duplicates.id
+    FROM   (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY account_id, provider_file_id ORDER BY updated_at DESC NULLS LAST, created_at DESC NULLS LAST) AS position
+        FROM   synced_items
+    ) duplicates
+    WHERE  duplicates.position > 1
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- synced items are upserted on their provider file id so their id stays the same across syncs
+CREATE UNIQUE INDEX IF NOT EXISTS synced_items_account_id_provider_file_id_key ON synced_items (account_id, provider_file_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS synced_items_account_id_provider_file_id_idx;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS synced_items_account_id_provider_file_id_idx ON synced_items (account_id, provider_file_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS synced_items_account_id_provider_file_id_key;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- name: SaveGoogleChannel :exec
+INSERT INTO google_channels (
+    channel_id, account_id, resource_id, token, expires_at
+) VALUES (
+    @channel_id, @account_id, @resource_id, @token, @expires_at
+) ON CONFLICT (account_id) DO UPDATE SET
+channel_id = EXCLUDED.channel_id, resource_id = EXCLUDED.resource_id, token = EXCLUDED.token, expires_at = EXCLUDED.expires_at, updated_at = NOW();
+
+-- name: GetGoogleChannel :one
+SELECT gc.account_id, gc.resource_id, gc.token, la.user_id
+FROM google_channels gc JOIN linked_account la ON la.id = gc.account_id
+WHERE gc.channel_id = @channel_id AND la.status = 'active';
+
+-- name: GetGoogleChannelByAccountID :one
+SELECT channel_id, resource_id, expires_at FROM google_channels WHERE account_id = @account_id;
\ No newline at end of file
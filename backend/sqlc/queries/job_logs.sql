@@ -20,7 +20,21 @@ UPDATE job_logs SET
 status = 'succeeded', finished_at = @finished_at
 WHERE job_id = @job_id;
 
+-- name: UpdateJobLogSkipped :exec
+UPDATE job_logs SET
+status = 'skipped', finished_at = @finished_at
+WHERE job_id = @job_id;
+
 -- name: UpdateJobLogFailed :exec
 UPDATE job_logs SET
 status = 'failed', error = @error
-WHERE job_id = @job_id;
\ No newline at end of file
+WHERE job_id = @job_id;
+
+-- name: GetActiveJobLog :one
+SELECT job_id, queue, status FROM job_logs
+WHERE account_id = @account_id AND type = @type AND status IN ('queued', 'processing', 'retrying')
+ORDER BY created_at DESC LIMIT 1;
+
+-- name: GetPendingJobLogs :many
+SELECT job_id, queue FROM job_logs
+WHERE account_id = @account_id AND status IN ('queued', 'processing', 'retrying');
\ No newline at end of file
@@ -6,26 +6,59 @@ INSERT INTO linked_account (
 ) RETURNING id;
 
 -- name: UpdateAuthTokens :exec
-UPDATE linked_account SET access_token = @access_token, refresh_token = @refresh_token, token_type = @token_type, expiry = @expiry, updated_at = NOW() WHERE id = @account_id;
+UPDATE linked_account SET access_token = @access_token, refresh_token = @refresh_token, token_type = @token_type, expiry = @expiry, status = CASE WHEN status = 'paused' THEN status ELSE 'active' END, status_reason = NULL, updated_at = NOW() WHERE id = @account_id;
 
 -- name: UpdateRenewedAuthToken :exec
-UPDATE linked_account SET access_token = @access_token, token_type = @token_type, expiry = @expiry, updated_at = NOW() WHERE id = @account_id;
+UPDATE linked_account SET access_token = @access_token, token_type = @token_type, expiry = @expiry, status = CASE WHEN status = 'paused' THEN status ELSE 'active' END, status_reason = NULL, updated_at = NOW() WHERE id = @account_id;
 
 -- name: GetLatestSyncTimeAndPagetoken :one
-SELECT last_synced_at, sync_page_token FROM linked_account WHERE id = @account_id;
+SELECT last_synced_at, sync_page_token, sync_rules_version, synced_rules_version FROM linked_account WHERE id = @account_id;
 
 -- name: GetAccountByProviderID :one
 SELECT id FROM linked_account WHERE user_id = @user_id AND provider = @provider AND provider_user_id = @provider_user_id LIMIT 1;
 
 -- name: GetAuthTokens :one
-SELECT provider, access_token, refresh_token FROM linked_account WHERE
+SELECT provider, access_token, refresh_token, expiry, status FROM linked_account WHERE
 user_id = @user_id AND id = @account_id;
 
+-- name: GetAccountTokens :one
+SELECT access_token, refresh_token, expiry FROM linked_account WHERE id = @account_id;
+
 -- name: UpdateLastSyncedTimestamp :exec
 UPDATE linked_account SET last_synced_at = NOW(), sync_page_token = @sync_page_token WHERE id = @account_id;
 
 -- name: GetLinkedAccountsByUserID :many
-SELECT provider, name, email, avatar_url, last_synced_at FROM linked_account WHERE user_id = @user_id;
+SELECT id, provider, name, email, avatar_url, last_synced_at, status, status_reason, sync_overdue_since FROM linked_account WHERE user_id = @user_id;
 
 -- name: GetLatestSyncTimeByUserID :one
-SELECT last_synced_at FROM linked_account WHERE user_id = @user_id ORDER BY last_synced_at DESC;
\ No newline at end of file
+SELECT last_synced_at FROM linked_account WHERE user_id = @user_id ORDER BY last_synced_at DESC;
+
+-- name: GetAccountsWithSyncCursor :many
+SELECT id, user_id, sync_page_token FROM linked_account WHERE provider = @provider AND sync_page_token IS NOT NULL AND sync_page_token <> '' AND status = 'active';
+
+-- name: GetAccountsByProviderUserIDs :many
+SELECT id, user_id FROM linked_account WHERE provider = @provider AND provider_user_id = ANY(@provider_user_ids::text[]) AND status = 'active';
+
+-- name: BumpSyncRulesVersion :one
+UPDATE linked_account SET sync_rules_version = sync_rules_version + 1 WHERE id = @account_id RETURNING sync_rules_version;
+
+-- name: UpdateSyncedRulesVersion :exec
+UPDATE linked_account SET synced_rules_version = @synced_rules_version WHERE id = @account_id;
+
+-- name: UpdateAccountStatus :exec
+UPDATE linked_account SET status = @status, status_reason = @status_reason, updated_at = NOW() WHERE id = @account_id;
+
+-- name: SetAccountPaused :execrows
+UPDATE linked_account SET status = CASE WHEN @paused::BOOLEAN THEN 'paused' ELSE 'active' END::account_status_enum, updated_at = NOW()
+WHERE id = @account_id AND status IN ('active', 'paused');
+
+-- name: GetAccountDataCounts :one
+SELECT (SELECT COUNT(*) FROM synced_items WHERE synced_items.account_id = @account_id)::BIGINT AS synced_items,
+       (SELECT COUNT(*) FROM job_logs WHERE job_logs.account_id = @account_id)::BIGINT AS job_logs,
+       (SELECT COUNT(*) FROM sync_runs WHERE sync_runs.account_id = @account_id)::BIGINT AS sync_runs;
+
+-- name: DeleteLinkedAccount :execrows
+DELETE FROM linked_account WHERE user_id = @user_id AND id = @account_id;
+
+-- name: ClearSyncPageToken :exec
+UPDATE linked_account SET sync_page_token = NULL WHERE id = @account_id;
\ No newline at end of file
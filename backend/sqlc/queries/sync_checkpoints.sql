@@ -0,0 +1,20 @@
+-- name: GetSyncCheckpoint :one
+SELECT checkpoint, full_sync, pages_synced, items_synced, items_deleted, started_at, updated_at
+FROM sync_checkpoints WHERE account_id = @account_id;
+
+-- name: StartSyncCheckpoint :one
+INSERT INTO sync_checkpoints (
+    account_id, checkpoint, full_sync
+) VALUES (
+    @account_id, '', @full_sync
+) ON CONFLICT (account_id) DO UPDATE SET
+checkpoint = '', full_sync = EXCLUDED.full_sync, pages_synced = 0, items_synced = 0, items_deleted = 0, started_at = NOW(), updated_at = NOW()
+RETURNING started_at;
+
+-- name: UpdateSyncCheckpoint :exec
+UPDATE sync_checkpoints SET
+checkpoint = @checkpoint, pages_synced = pages_synced + 1, items_synced = items_synced + @items_synced::BIGINT, items_deleted = items_deleted + @items_deleted::BIGINT, updated_at = NOW()
+WHERE account_id = @account_id;
+
+-- name: DeleteSyncCheckpoint :exec
+DELETE FROM sync_checkpoints WHERE account_id = @account_id;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: GetSyncRules :many
+SELECT id, account_id, action, type, pattern, created_at FROM sync_rules WHERE account_id = @account_id ORDER BY created_at, id;
+
+-- name: AddSyncRules :copyfrom
+INSERT INTO sync_rules (
+    account_id, action, type, pattern
+) VALUES (
+    @account_id, @action, @type, @pattern
+);
+
+-- name: DeleteSyncRules :exec
+DELETE FROM sync_rules WHERE account_id = @account_id;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- name: StartSyncRun :one
+INSERT INTO sync_runs (
+    account_id, job_id, full_sync, resumed, cursor_before
+) VALUES (
+    @account_id, @job_id, @full_sync, @resumed, @cursor_before
+) RETURNING id;
+
+-- name: FinishSyncRun :exec
+UPDATE sync_runs
+SET    status = @status,
+       items_added = @items_added,
+       items_updated = @items_updated,
+       items_unchanged = @items_unchanged,
+       items_deleted = @items_deleted,
+       items_skipped = @items_skipped,
+       bytes_seen = @bytes_seen,
+       pages_fetched = @pages_fetched,
+       cursor_after = @cursor_after,
+       error = @error,
+       finished_at = NOW(),
+       duration_ms = (EXTRACT(EPOCH FROM NOW() - started_at) * 1000)::BIGINT
+WHERE  id = @id;
+
+-- name: GetSyncRuns :many
+SELECT * FROM sync_runs WHERE account_id = @account_id ORDER BY started_at DESC LIMIT @limit_by OFFSET @offset_by;
\ No newline at end of file
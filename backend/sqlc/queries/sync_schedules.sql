@@ -0,0 +1,51 @@
+-- name: GetSyncSchedule :one
+SELECT la.user_id,
+       la.provider,
+       COALESCE(ss.interval_minutes, @default_interval::INT)::INT AS interval_minutes,
+       la.status
+FROM   linked_account la LEFT JOIN sync_schedules ss ON ss.account_id = la.id
+WHERE  la.id = @account_id;
+
+-- name: GetActiveSyncSchedules :many
+SELECT la.id,
+       la.user_id,
+       la.provider,
+       COALESCE(ss.interval_minutes, @default_interval::INT)::INT AS interval_minutes
+FROM   linked_account la LEFT JOIN sync_schedules ss ON ss.account_id = la.id
+WHERE  la.status = 'active';
+
+-- name: SaveSyncSchedule :exec
+INSERT INTO sync_schedules (
+    account_id, interval_minutes
+) VALUES (
+    @account_id, @interval_minutes
+) ON CONFLICT (account_id) DO UPDATE SET
+interval_minutes = EXCLUDED.interval_minutes, updated_at = NOW();
+
+-- name: MarkOverdueAccounts :many
+-- Marks active accounts that have not synced successfully for more than twice their interval plus the grace period as
+-- overdue and clears the mark of every other account. Only the accounts that just became overdue are returned.
+WITH overdue AS (
+    SELECT la.id,
+           COALESCE(ss.interval_minutes, @default_interval::INT)::INT AS interval_minutes,
+           runs.last_succeeded_at
+    FROM   linked_account la
+           LEFT JOIN sync_schedules ss ON ss.account_id = la.id
+           LEFT JOIN LATERAL (
+               SELECT MAX(sync_runs.finished_at) AS last_succeeded_at FROM sync_runs
+               WHERE  sync_runs.account_id = la.id AND sync_runs.status = 'succeeded'
+           ) runs ON TRUE
+    WHERE  la.status = 'active'
+           AND COALESCE(runs.last_succeeded_at, la.created_at) < NOW() - MAKE_INTERVAL(mins => 2 * COALESCE(ss.interval_minutes, @default_interval::INT) + @grace_minutes::INT)
+), recovered AS (
+    UPDATE linked_account SET sync_overdue_since = NULL
+    WHERE  sync_overdue_since IS NOT NULL AND id NOT IN (SELECT id FROM overdue)
+)
+UPDATE linked_account SET sync_overdue_since = NOW()
+FROM   overdue
+WHERE  linked_account.id = overdue.id AND linked_account.sync_overdue_since IS NULL
+RETURNING linked_account.id,
+          linked_account.user_id,
+          linked_account.provider,
+          overdue.interval_minutes,
+          overdue.last_succeeded_at::TIMESTAMPTZ AS last_succeeded_at;
\ No newline at end of file
@@ -1,9 +1,26 @@
--- name: AddSyncedItems :copyfrom
-INSERT INTO synced_items (
-    account_id, provider_file_id, name, extension, size, mime_type, parent_folder, is_folder, content_hash, created_time, modified_time, thumbnail_link, preview_link, web_view_link, web_content_link, link_expires_at
-) VALUES (
-    @account_id, @provider_file_id, @name, @extension ,@size, @mime_type, @parent_folder, @is_folder, @content_hash, @created_time, @modified_time, @thumbnail_link, @preview_link, @web_view_link, @web_content_link, @link_expires_at
-);
+-- name: UpsertSyncedItems :one
+-- rows are written in place of the ones stored under the same provider file id, which keep their id
+WITH upserted AS (
+    INSERT INTO synced_items (
+        account_id, provider_file_id, name, extension, size, mime_type, parent_folder, is_folder, content_hash, created_time, modified_time, thumbnail_link, preview_link, web_view_link, web_content_link, link_expires_at, owner, is_shared, shared_with_me
+    )
+    SELECT @account_id::UUID, items.provider_file_id, items.name, items.extension, items.size, NULLIF(items.mime_type, ''), NULLIF(items.parent_folder, ''), items.is_folder, NULLIF(items.content_hash, ''), items.created_time, items.modified_time, NULLIF(items.thumbnail_link, ''), NULLIF(items.preview_link, ''), NULLIF(items.web_view_link, ''), NULLIF(items.web_content_link, ''), items.link_expires_at, NULLIF(items.owner, ''), items.is_shared, items.shared_with_me
+    FROM   UNNEST(
+               @provider_file_ids::TEXT[], @names::TEXT[], @extensions::TEXT[], @sizes::BIGINT[], @mime_types::TEXT[], @parent_folders::TEXT[], @is_folders::BOOLEAN[], @content_hashes::TEXT[],
+               @created_times::TIMESTAMPTZ[], @modified_times::TIMESTAMPTZ[], @thumbnail_links::TEXT[], @preview_links::TEXT[], @web_view_links::TEXT[], @web_content_links::TEXT[],
+               @link_expires_ats::TIMESTAMPTZ[], @owners::TEXT[], @is_shareds::BOOLEAN[], @shared_with_mes::BOOLEAN[]
+           ) AS items (provider_file_id, name, extension, size, mime_type, parent_folder, is_folder, content_hash, created_time, modified_time, thumbnail_link, preview_link, web_view_link, web_content_link, link_expires_at, owner, is_shared, shared_with_me)
+    ON CONFLICT (account_id, provider_file_id) DO UPDATE SET
+    name = EXCLUDED.name, extension = EXCLUDED.extension, size = EXCLUDED.size, mime_type = EXCLUDED.mime_type, parent_folder = EXCLUDED.parent_folder, is_folder = EXCLUDED.is_folder,
+    content_hash = EXCLUDED.content_hash, created_time = EXCLUDED.created_time, modified_time = EXCLUDED.modified_time, thumbnail_link = EXCLUDED.thumbnail_link, preview_link = EXCLUDED.preview_link,
+    web_view_link = EXCLUDED.web_view_link, web_content_link = EXCLUDED.web_content_link, link_expires_at = EXCLUDED.link_expires_at, owner = EXCLUDED.owner, is_shared = EXCLUDED.is_shared,
+    shared_with_me = EXCLUDED.shared_with_me, updated_at = NOW(),
+    -- a renamed or moved item is resolved again by RefreshItemHierarchy along with everything below it
+    path = CASE WHEN synced_items.name = EXCLUDED.name AND synced_items.parent_folder IS NOT DISTINCT FROM EXCLUDED.parent_folder THEN synced_items.path END
+    -- xmax is only zero on rows the statement inserted
+    RETURNING xmax = 0 AS inserted
+)
+SELECT COUNT(*)::BIGINT AS written, COUNT(*) FILTER (WHERE NOT upserted.inserted)::BIGINT AS replaced FROM upserted;
 
 -- name: GetSyncedItems :many
 SELECT synced_items.id,
@@ -17,14 +34,27 @@ SELECT synced_items.id,
        synced_items.modified_time,
        linked_account.name AS account_name,
        linked_account.avatar_url,
-       linked_account.provider
+       linked_account.provider,
+       synced_items.parent_id,
+       synced_items.path,
+       synced_items.owner,
+       synced_items.is_shared,
+       synced_items.shared_with_me
 FROM   synced_items
        JOIN linked_account
        ON linked_account.id = synced_items.account_id
 WHERE  linked_account.user_id = @user_id
-       AND (NULLIF(@parent_folder, '') IS NULL OR synced_items.parent_folder = @parent_folder)
+       AND (NULLIF(@parent_folder, '') IS NULL
+            OR (@parent_folder = '/' AND synced_items.parent_id IS NULL AND synced_items.path IS NOT NULL)
+            OR synced_items.parent_id::TEXT = @parent_folder
+            -- provider folder ids from before parent references existed are still matched against the stored parent
+            OR (@parent_folder <> '/' AND synced_items.parent_folder = @parent_folder))
+       AND (NULLIF(@path, '') IS NULL OR LOWER(LEFT(synced_items.path, LENGTH(synced_items.path) - LENGTH(synced_items.name) - 1)) = LOWER(RTRIM(@path::TEXT, '/')))
        AND (NULLIF(@provider, '') IS NULL OR linked_account.provider = @provider::provider_enum)
        AND (NULLIF(@search, '') IS NULL OR synced_items.name ILIKE '%' || @search::TEXT || '%')
+       AND (NULLIF(@owner, '') IS NULL OR LOWER(synced_items.owner) = LOWER(@owner::TEXT))
+       AND (sqlc.narg(is_shared)::BOOLEAN IS NULL OR synced_items.is_shared = sqlc.narg(is_shared)::BOOLEAN)
+       AND (sqlc.narg(shared_with_me)::BOOLEAN IS NULL OR synced_items.shared_with_me = sqlc.narg(shared_with_me)::BOOLEAN)
        ORDER BY 
        CASE
            WHEN @sort_on = 'file_name' AND @sort_by = 'asc' THEN synced_items.name
@@ -59,9 +89,145 @@ FROM   synced_items
        JOIN linked_account
        ON linked_account.id = synced_items.account_id
 WHERE  linked_account.user_id = @user_id
-       AND (NULLIF(@parent_folder, '') IS NULL OR synced_items.parent_folder = @parent_folder)
+       AND (NULLIF(@parent_folder, '') IS NULL
+            OR (@parent_folder = '/' AND synced_items.parent_id IS NULL AND synced_items.path IS NOT NULL)
+            OR synced_items.parent_id::TEXT = @parent_folder
+            -- provider folder ids from before parent references existed are still matched against the stored parent
+            OR (@parent_folder <> '/' AND synced_items.parent_folder = @parent_folder))
+       AND (NULLIF(@path, '') IS NULL OR LOWER(LEFT(synced_items.path, LENGTH(synced_items.path) - LENGTH(synced_items.name) - 1)) = LOWER(RTRIM(@path::TEXT, '/')))
        AND (NULLIF(@provider, '') IS NULL OR linked_account.provider = @provider::provider_enum)
-       AND (NULLIF(@search, '') IS NULL OR synced_items.name ILIKE '%' || @search::TEXT || '%');
+       AND (NULLIF(@search, '') IS NULL OR synced_items.name ILIKE '%' || @search::TEXT || '%')
+       AND (NULLIF(@owner, '') IS NULL OR LOWER(synced_items.owner) = LOWER(@owner::TEXT))
+       AND (sqlc.narg(is_shared)::BOOLEAN IS NULL OR synced_items.is_shared = sqlc.narg(is_shared)::BOOLEAN)
+       AND (sqlc.narg(shared_with_me)::BOOLEAN IS NULL OR synced_items.shared_with_me = sqlc.narg(shared_with_me)::BOOLEAN);
+
+-- name: DeleteConflictingItems :execrows
+DELETE FROM synced_items WHERE provider_file_id = ANY(@provider_file_ids::TEXT[]) AND account_id = @account_id;
+
+-- name: GetSyncedItemByID :one
+SELECT synced_items.account_id,
+       synced_items.provider_file_id,
+       synced_items.name,
+       synced_items.extension,
+       synced_items.size,
+       synced_items.mime_type,
+       synced_items.parent_folder,
+       synced_items.is_folder,
+       linked_account.provider
+FROM   synced_items
+       JOIN linked_account
+       ON linked_account.id = synced_items.account_id
+WHERE  synced_items.id = @id AND linked_account.user_id = @user_id;
+
+-- name: GetSyncedItemHashes :many
+SELECT provider_file_id, content_hash FROM synced_items WHERE account_id = @account_id;
+
+-- name: DeleteDescendantItems :execrows
+WITH RECURSIVE descendants AS (
+    SELECT synced_items.id, synced_items.provider_file_id FROM synced_items
+    WHERE  synced_items.account_id = @account_id
+           AND (synced_items.parent_folder = ANY(@parent_ids::TEXT[])
+                OR synced_items.parent_id IN (SELECT parent.id FROM synced_items parent WHERE parent.account_id = @account_id AND parent.provider_file_id = ANY(@parent_ids::TEXT[])))
+    UNION
+    SELECT synced_items.id, synced_items.provider_file_id FROM synced_items JOIN descendants ON synced_items.parent_folder = descendants.provider_file_id OR synced_items.parent_id = descendants.id WHERE synced_items.account_id = @account_id
+)
+DELETE FROM synced_items WHERE account_id = @account_id AND provider_file_id IN (SELECT provider_file_id FROM descendants);
+
+-- name: DeleteItemsByPath :execrows
+DELETE FROM synced_items
+WHERE  account_id = @account_id
+       AND EXISTS (
+           SELECT 1 FROM UNNEST(@paths::TEXT[]) AS deleted(path)
+           WHERE  LOWER(RTRIM(synced_items.parent_folder, '/') || '/' || synced_items.name) = deleted.path
+                  OR LOWER(synced_items.parent_folder) = deleted.path
+                  OR STARTS_WITH(LOWER(synced_items.parent_folder), deleted.path || '/')
+       );
+
+-- name: TouchSyncedItems :exec
+UPDATE synced_items SET updated_at = NOW() WHERE account_id = @account_id AND provider_file_id = ANY(@provider_file_ids::TEXT[]);
+
+-- name: DeleteItemsNotSyncedSince :execrows
+DELETE FROM synced_items WHERE account_id = @account_id AND updated_at < @synced_since;
+
+-- name: RefreshItemHierarchy :execrows
+-- rows written since the last refresh have no path yet, only they and the items below them are resolved again
+WITH RECURSIVE anchors AS (
+    SELECT synced_items.id,
+           synced_items.provider_file_id,
+           parent.id AS parent_id,
+           COALESCE(parent.path, '') || '/' || synced_items.name AS path
+    FROM   synced_items
+           -- dropbox references parents by path, every other provider by the provider file id of the parent
+           LEFT JOIN LATERAL (
+               SELECT candidates.id, candidates.path
+               FROM   (
+                   SELECT candidate.id, candidate.path, 0 AS rank FROM synced_items candidate
+                   WHERE  candidate.account_id = synced_items.account_id AND candidate.provider_file_id = synced_items.parent_folder
+                   UNION ALL
+                   SELECT candidate.id, candidate.path, 1 AS rank FROM synced_items candidate
+                   WHERE  candidate.account_id = synced_items.account_id AND LOWER(candidate.path) = LOWER(synced_items.parent_folder)
+               ) candidates
+               ORDER BY candidates.rank
+               LIMIT 1
+           ) parent ON TRUE
+    WHERE  synced_items.account_id = @account_id
+           AND synced_items.path IS NULL
+           -- items whose parent is unresolved as well are reached from that parent, items whose parent was never
+           -- synced are placed at the root
+           AND (parent.id IS NULL OR parent.path IS NOT NULL)
+), tree AS (
+    SELECT anchors.id, anchors.provider_file_id, anchors.parent_id, anchors.path, 0 AS depth
+    FROM   anchors
+    UNION ALL
+    SELECT children.id, children.provider_file_id, tree.id, tree.path || '/' || children.name, tree.depth + 1
+    FROM   tree
+           CROSS JOIN LATERAL (
+               SELECT child.id, child.provider_file_id, child.name FROM synced_items child
+               WHERE  child.account_id = @account_id AND child.parent_folder = tree.provider_file_id
+               UNION ALL
+               SELECT child.id, child.provider_file_id, child.name FROM synced_items child
+               WHERE  child.account_id = @account_id
+                      AND LOWER(child.parent_folder) = LOWER(tree.path)
+                      AND NOT EXISTS (
+                          SELECT 1 FROM synced_items parent
+                          WHERE  parent.account_id = child.account_id AND parent.provider_file_id = child.parent_folder
+                      )
+           ) children
+    WHERE  tree.depth < 256
+) CYCLE id SET is_cycle USING visited, resolved AS (
+    -- an item below another unresolved item is reached from both, the longest chain starts at the topmost one
+    SELECT DISTINCT ON (tree.id) tree.id, tree.parent_id, tree.path
+    FROM   tree
+    WHERE  NOT tree.is_cycle
+    ORDER BY tree.id, tree.depth DESC
+)
+UPDATE synced_items
+SET    parent_id = resolved.parent_id, path = resolved.path
+FROM   resolved
+WHERE  synced_items.id = resolved.id
+       AND (synced_items.parent_id IS DISTINCT FROM resolved.parent_id OR synced_items.path IS DISTINCT FROM resolved.path);
+
+-- name: GetItemBreadcrumbs :many
+WITH RECURSIVE ancestors AS (
+    SELECT synced_items.id, synced_items.parent_id, synced_items.name, synced_items.path, 0 AS depth
+    FROM   synced_items
+           JOIN linked_account
+           ON linked_account.id = synced_items.account_id
+    WHERE  synced_items.id = @id AND linked_account.user_id = @user_id
+    UNION ALL
+    SELECT synced_items.id, synced_items.parent_id, synced_items.name, synced_items.path, ancestors.depth + 1
+    FROM   synced_items
+           JOIN ancestors
+           ON synced_items.id = ancestors.parent_id
+    WHERE  ancestors.depth < 256
+)
+SELECT id, name, path FROM ancestors ORDER BY depth DESC;
 
--- name: DeleteConflictingItems :exec
-DELETE FROM synced_items WHERE provider_file_id = ANY(@provider_file_ids::TEXT[]) AND account_id = @account_id;
\ No newline at end of file
+-- name: DeleteItemsUnderPaths :execrows
+DELETE FROM synced_items
+WHERE  account_id = @account_id
+       AND EXISTS (
+           SELECT 1 FROM UNNEST(@paths::TEXT[]) AS excluded(path)
+           WHERE  LOWER(synced_items.path) = excluded.path
+                  OR STARTS_WITH(LOWER(synced_items.path), excluded.path || '/')
+       );
\ No newline at end of file